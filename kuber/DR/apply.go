@@ -0,0 +1,108 @@
+package DR
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// FieldManager owns every field DR writes on a destination cluster.
+const FieldManager = "kuber-dr"
+
+// JobLabel carries the ID of the DR job that last wrote an object. Every job
+// shares FieldManager, so reconciliation relies on the label to delete only
+// the orphans of its own job.
+const JobLabel = "dr.kuber.io/job-id"
+
+// Conflict policies decide what happens when a field DR wants to write is
+// owned by another manager on the destination.
+const (
+	// ConflictForce takes ownership of the conflicting fields.
+	ConflictForce = "force"
+	// ConflictSkip leaves the destination object untouched.
+	ConflictSkip = "skip"
+	// ConflictReport leaves the destination object untouched and records the
+	// conflict on the job.
+	ConflictReport = "report"
+)
+
+// ValidateConflictPolicy accepts an empty policy, which means ConflictReport.
+func ValidateConflictPolicy(policy string) error {
+	switch policy {
+	case "", ConflictForce, ConflictSkip, ConflictReport:
+		return nil
+	}
+	return fmt.Errorf("invalid conflict policy %q: must be one of %s, %s or %s", policy, ConflictForce, ConflictSkip, ConflictReport)
+}
+
+// Conflict describes one destination object whose fields are owned by another
+// field manager.
+type Conflict struct {
+	Resource   string    `json:"resource"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	Fields     []string  `json:"fields"`
+	Message    string    `json:"message"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// applyToDestination server-side applies u to the destination, labelled with
+// jobID unless it is empty. A field ownership conflict is returned as a
+// *Conflict, not as an error, unless the policy is ConflictForce, in which
+// case the apply never conflicts.
+func applyToDestination(client dynamic.Interface, gvr schema.GroupVersionResource, namespace string, u *unstructured.Unstructured, policy, jobID string) (*Conflict, error) {
+	cleanObject(u)
+	setJobLabel(u, jobID)
+	_, err := client.Resource(gvr).Namespace(namespace).Apply(context.TODO(), u.GetName(), u, metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        policy == ConflictForce,
+	})
+	if err == nil {
+		return nil, nil
+	}
+	if !apierrors.IsConflict(err) {
+		return nil, err
+	}
+	return conflictFromError(gvr, namespace, u.GetName(), err)
+}
+
+// setJobLabel marks u as written by a DR job. Objects written outside a job,
+// such as restored snapshots, are left unmarked so no job ever deletes them.
+func setJobLabel(u *unstructured.Unstructured, jobID string) {
+	if jobID == "" {
+		return
+	}
+	labels := u.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[JobLabel] = jobID
+	u.SetLabels(labels)
+}
+
+// conflictFromError describes a field manager conflict returned by an apply.
+func conflictFromError(gvr schema.GroupVersionResource, namespace, name string, err error) (*Conflict, error) {
+	conflict := &Conflict{
+		Resource:   gvrKey(gvr),
+		Namespace:  namespace,
+		Name:       name,
+		Message:    err.Error(),
+		DetectedAt: time.Now(),
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			if cause.Type == metav1.CauseTypeFieldManagerConflict {
+				conflict.Fields = append(conflict.Fields, cause.Field)
+			}
+		}
+	}
+	return conflict, nil
+}
@@ -0,0 +1,204 @@
+package DR
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// unifiedDiff renders the line difference between before and after in the
+// unified format understood by diff and patch tools. It returns an empty
+// string when the two are identical.
+func unifiedDiff(fromName, toName string, before, after []string) string {
+	ops := diffLines(before, after)
+	changed := false
+	for _, op := range ops {
+		if op.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+	for start := 0; start < len(ops); {
+		// Find the next change and grow the hunk until changes are more than
+		// two contexts apart.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		hunkStart := max(first-diffContext, start)
+		hunkEnd := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				hunkEnd = i + 1
+			} else if i-hunkEnd >= 2*diffContext {
+				break
+			}
+		}
+		hunkEnd = min(hunkEnd+diffContext, len(ops))
+
+		oldStart, newStart := ops[hunkStart].oldLine, ops[hunkStart].newLine
+		oldCount, newCount := 0, 0
+		for _, op := range ops[hunkStart:hunkEnd] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, op := range ops[hunkStart:hunkEnd] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.text)
+			b.WriteByte('\n')
+		}
+		start = hunkEnd
+	}
+	return b.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range names the line before it.
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed or '+' added.
+// oldLine and newLine are the zero-based positions it starts at in each input.
+type diffOp struct {
+	kind             byte
+	text             string
+	oldLine, newLine int
+}
+
+// maxDiffEdits bounds the edit distance diffLines searches for, and with it
+// its time and memory. Inputs further apart are diffed as a whole block
+// removed and replaced.
+const maxDiffEdits = 1000
+
+// diffLines computes a shortest edit script with Myers' O(ND) algorithm,
+// after setting aside the common prefix and suffix.
+func diffLines(before, after []string) []diffOp {
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix && before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, max(len(before), len(after)))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{' ', before[i], i, i})
+	}
+	ops = append(ops, myersDiff(before[prefix:len(before)-suffix], after[prefix:len(after)-suffix], prefix, prefix)...)
+	for k := suffix; k > 0; k-- {
+		i, j := len(before)-k, len(after)-k
+		ops = append(ops, diffOp{' ', before[i], i, j})
+	}
+	return ops
+}
+
+// myersDiff diffs a and b, which start at line oldStart and newStart of the
+// full inputs.
+func myersDiff(a, b []string, oldStart, newStart int) []diffOp {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	// v[offset+k] is the furthest x reached on diagonal k = x-y. trace[d]
+	// keeps v for the diagonals -(d-1)..d-1 as it was before step d.
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		if d > 0 {
+			trace = append(trace, append([]int(nil), v[offset-d+1:offset+d]...))
+		} else {
+			trace = append(trace, nil)
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return myersBacktrack(a, b, trace, oldStart, newStart)
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	for i := range a {
+		ops = append(ops, diffOp{'-', a[i], oldStart + i, newStart})
+	}
+	for j := range b {
+		ops = append(ops, diffOp{'+', b[j], oldStart + n, newStart + j})
+	}
+	return ops
+}
+
+// myersBacktrack walks trace back from the end of both inputs and returns the
+// edit script in order.
+func myersBacktrack(a, b []string, trace [][]int, oldStart, newStart int) []diffOp {
+	var reversed []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		if d == 0 {
+			for x > 0 {
+				reversed = append(reversed, diffOp{' ', a[x-1], oldStart + x - 1, newStart + y - 1})
+				x--
+				y--
+			}
+			break
+		}
+		// at reads diagonal k of the window trace[d] holds.
+		at := func(k int) int { return trace[d][k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffOp{' ', a[x-1], oldStart + x - 1, newStart + y - 1})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, diffOp{'+', b[y-1], oldStart + x, newStart + y - 1})
+		} else {
+			reversed = append(reversed, diffOp{'-', a[x-1], oldStart + x - 1, newStart + y})
+		}
+		x, y = prevX, prevY
+	}
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
@@ -2,154 +2,721 @@ package DR
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/discovery"
-	memory "k8s.io/client-go/discovery/cached"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/utils/ptr"
 )
 
-func GetDynamicClient(kubeconfigPath string) (dynamic.Interface, *restmapper.DeferredDiscoveryRESTMapper, *kubernetes.Clientset, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+const (
+	DRTypeActiveActive  = "active-active"
+	DRTypeActivePassive = "active-passive"
+
+	// ReplicasAnnotation records the source replica count of a workload that was
+	// scaled to zero on a passive destination, so failover can restore it.
+	ReplicasAnnotation = "dr.kuber.io/source-replicas"
+)
+
+// PerformClusterDR starts replicating from source to destination in the
+// background: the destination is first seeded in dependency tiers, then kept in
+// sync by informers. When gvrs is empty the resources are discovered on the source and
+// narrowed by options.Resources; custom resources bring their CRD along.
+// report, if set, is called with the session status whenever the state changes
+// and periodically while it runs.
+func PerformClusterDR(jobID string, SourceClient, DestinationClient dynamic.Interface, provisioner string, DRType string, gvrs []schema.GroupVersionResource, sourceK8sClient, destinationK8sClient *kubernetes.Clientset, options Options, report func(Status)) error {
+	s, err := newSession(jobID, SourceClient, DestinationClient, provisioner, DRType, gvrs, sourceK8sClient, destinationK8sClient, options, report)
 	if err != nil {
-		return nil, nil, nil, err
+		return err
 	}
-	dc, err := discovery.NewDiscoveryClientForConfig(config)
-	if err != nil {
-		return nil, nil, nil, err
+	return s.run()
+}
+
+// newSession validates the arguments of PerformClusterDR and builds the
+// session without starting it.
+func newSession(jobID string, SourceClient, DestinationClient dynamic.Interface, provisioner string, DRType string, gvrs []schema.GroupVersionResource, sourceK8sClient, destinationK8sClient *kubernetes.Clientset, options Options, report func(Status)) (*session, error) {
+	if SourceClient == nil || DestinationClient == nil {
+		return nil, fmt.Errorf("source or destination client is nil")
+	}
+	if provisioner == "" {
+		return nil, fmt.Errorf("provisioner cannot be empty")
+	}
+	if DRType == "" {
+		return nil, fmt.Errorf("DRType cannot be empty")
+	}
+	if DRType != DRTypeActiveActive && DRType != DRTypeActivePassive {
+		return nil, fmt.Errorf("DRType %s not supported", DRType)
+	}
+	if DRType == DRTypeActivePassive && destinationK8sClient == nil {
+		return nil, fmt.Errorf("destination k8s client is required for active-passive DR")
 	}
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
-	client, err := dynamic.NewForConfig(config)
+	transform, err := resolveOptions(provisioner, &options)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
+	}
+	if len(gvrs) == 0 {
+		discovered, err := DiscoverResources(sourceK8sClient.Discovery(), options.Resources)
+		if err != nil {
+			return nil, err
+		}
+		gvrs = discovered
+	}
+	if err := ensureCRDs(SourceClient, DestinationClient, gvrs); err != nil {
+		return nil, err
 	}
-	k8sClient, err := kubernetes.NewForConfig(config)
+	secrets, err := newSecretHandler(options, destinationK8sClient)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
+	healthCheck := options.HealthCheck
+	if healthCheck.Interval <= 0 {
+		healthCheck.Interval = 10 * time.Second
+	}
+	if healthCheck.FailureThreshold <= 0 {
+		healthCheck.FailureThreshold = 3
+	}
+	return &session{
+		sourceClient:      SourceClient,
+		destClient:        DestinationClient,
+		sourceK8sClient:   sourceK8sClient,
+		destK8sClient:     destinationK8sClient,
+		drType:            DRType,
+		scope:             options.Scope,
+		resources:         options.Resources,
+		gvrs:              gvrs,
+		conflictPolicy:    options.ConflictPolicy,
+		transform:         transform,
+		healthCheck:       healthCheck,
+		jobID:             jobID,
+		hub:               newInformerHub(SourceClient),
+		report:            report,
+		audit:             options.Audit,
+		secrets:           secrets,
+		secretAudit:       options.SecretAudit,
+		reconcileInterval: options.ReconcileInterval,
+		state:             StatePending,
+		objectCounts:      map[string]int64{},
+		errorCounts:       map[string]int64{},
+		conflicts:         map[string]Conflict{},
+		objects:           map[string]*ObjectStatus{},
+		watchers:          map[string]*informerWatch{},
+		seeded:            map[string]string{},
+		held:              map[string]bool{},
+		stop:              make(chan struct{}),
+	}, nil
+}
 
-	return client, mapper, k8sClient, nil
+// run registers the session and starts it in the background.
+func (s *session) run() error {
+	if err := registerSession(s); err != nil {
+		return err
+	}
+	s.begin()
+	return nil
 }
 
-func PerformClusterDR(SourceClient, DestinationClient dynamic.Interface, provisioner string, DRType string, gvrs []schema.GroupVersionResource, sourceK8sClient *kubernetes.Clientset) error {
-	if SourceClient == nil || DestinationClient == nil {
-		return fmt.Errorf("source or destination client is nil")
+// begin starts a registered session.
+func (s *session) begin() {
+	s.setState(StateSeeding)
+	go s.reportPeriodically()
+	go s.start()
+}
+
+// start seeds the destination and then keeps it in sync until the session is
+// stopped.
+func (s *session) start() {
+	s.seed(s.resources)
+	if s.stopped() {
+		return
 	}
-	if provisioner == "" {
-		return fmt.Errorf("provisioner cannot be empty")
+	if err := watchNamespacesAndSyncResources(s); err != nil {
+		log.Printf("❌ DR session %s cannot watch the source: %v", s.jobID, err)
+		s.recordError(err)
+		unregisterSession(s)
+		s.shutdown()
+		s.setState(StateFailed)
+		return
 	}
-	if DRType == "" {
-		return fmt.Errorf("DRType cannot be empty")
+	watchClusterScopedResources(s, s.resources)
+	if !s.paused.Load() {
+		s.setState(StateRunning)
+	}
+	if s.reconcileInterval > 0 {
+		go s.reconcilePeriodically()
+	}
+
+	if s.drType == DRTypeActivePassive && !s.reverse {
+		healthCheck := s.healthCheck
+		go monitorClusterHealth(s.sourceK8sClient, healthCheck, s.stop, func() {
+			log.Printf("🚨 Source cluster unreachable after %d probes, promoting destination", healthCheck.FailureThreshold)
+			s.promoted.Store(true)
+			replicas, err := s.initiateFailover()
+			s.mu.Lock()
+			s.failoverReplicas = replicas
+			s.mu.Unlock()
+			if err != nil {
+				log.Printf("❌ Failover failed: %v", err)
+				s.recordError(err)
+				s.setState(StateFailed)
+				return
+			}
+			log.Println("✅ Destination cluster promoted")
+			s.setState(StateFailedOver)
+		})
+	}
+}
+
+// seed copies the in-scope state of the source in dependency tiers before any
+// watcher starts, so the initial copy does not depend on the order in which
+// informers happen to sync. The objects it writes are remembered so that their
+// initial informer events do not apply them a second time.
+func (s *session) seed(filter ResourceFilter) {
+	namespaces, err := s.sourceK8sClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		log.Printf("❌ Failed to list namespaces for seeding: %v", err)
+		s.recordError(err)
+		return
+	}
+	inScope := map[string]map[string]string{}
+	var items []ApplyItem
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if !s.scope.IncludesNamespace(ns.Name, ns.Annotations) {
+			continue
+		}
+		inScope[ns.Name] = ns.Annotations
+		items = append(items, ApplyItem{GVR: namespaceGVR, Object: namespaceObject(ns)})
+	}
+	for _, r := range clusterScopedResources {
+		if !filter.matches(r.gvr, r.kind) {
+			continue
+		}
+		list, err := s.sourceClient.Resource(r.gvr).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			log.Printf("❌ Failed to list %s for seeding: %v", gvrKey(r.gvr), err)
+			s.recordError(err)
+			continue
+		}
+		for i := range list.Items {
+			items = append(items, ApplyItem{GVR: r.gvr, Object: &list.Items[i]})
+		}
 	}
-	if DRType == "active-passive" {
-		return fmt.Errorf("DRType %s not supported yet", DRType)
+	for _, gvr := range s.gvrs {
+		list, err := s.sourceClient.Resource(gvr).List(context.TODO(), metav1.ListOptions{LabelSelector: s.scope.LabelSelector})
+		if err != nil {
+			log.Printf("❌ Failed to list %s for seeding: %v", gvrKey(gvr), err)
+			s.recordError(err)
+			continue
+		}
+		for i := range list.Items {
+			u := &list.Items[i]
+			annotations, ok := inScope[u.GetNamespace()]
+			if !ok || namespaceExcludesResource(annotations, gvr) {
+				continue
+			}
+			items = append(items, ApplyItem{GVR: gvr, Namespace: u.GetNamespace(), Object: u})
+		}
 	}
-	watchNamespacesAndSyncResources(SourceClient, DestinationClient, sourceK8sClient)
 
+	log.Printf("🌱 Seeding %d objects for DR session %s", len(items), s.jobID)
+	for _, e := range ApplyInTiers(items, s.seedObject, s.stop) {
+		log.Printf("❌ Seeding failed for %v", e)
+		s.recordObjectError(e.Item.GVR, e.Item.Namespace, e.Item.Object.GetName(), e.Err)
+	}
+}
+
+func (s *session) seedObject(item ApplyItem) error {
+	if item.GVR == namespaceGVR {
+		return s.createNamespace(item.Object)
+	}
+	if err := s.writeObject(item.GVR, item.Namespace, item.Object, 1); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seeded[objectKey(gvrKey(item.GVR), item.Namespace, item.Object.GetName())] = item.Object.GetResourceVersion()
 	return nil
 }
 
-func watchAndSync(gvr schema.GroupVersionResource, sourceClient, destClient dynamic.Interface, namespace string) {
-	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(sourceClient, 0, namespace, nil)
-	informer := factory.ForResource(gvr).Informer()
+// takeSeeded forgets and returns the resource version an object was seeded at.
+func (s *session) takeSeeded(gvr schema.GroupVersionResource, namespace, name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := objectKey(gvrKey(gvr), namespace, name)
+	resourceVersion, ok := s.seeded[key]
+	delete(s.seeded, key)
+	return resourceVersion, ok
+}
+
+// resolveOptions validates options, fills in defaults and returns the
+// transformation for the provisioner pair with the caller's rules on top.
+func resolveOptions(provisioner string, options *Options) (TransformRules, error) {
+	if err := options.Scope.Validate(); err != nil {
+		return TransformRules{}, err
+	}
+	if err := options.Resources.Validate(); err != nil {
+		return TransformRules{}, err
+	}
+	if err := ValidateConflictPolicy(options.ConflictPolicy); err != nil {
+		return TransformRules{}, err
+	}
+	if options.ConflictPolicy == "" {
+		options.ConflictPolicy = ConflictReport
+	}
+	if err := options.Transform.Validate(); err != nil {
+		return TransformRules{}, err
+	}
+	if err := validateReconcileInterval(options.ReconcileInterval); err != nil {
+		return TransformRules{}, err
+	}
+	if options.ReconcileInterval == 0 {
+		options.ReconcileInterval = DefaultReconcileInterval
+	}
+	return PresetRules(provisioner, options.DestinationProvisioner).Merge(options.Transform), nil
+}
+
+// prepareObject runs a copy of a source object through the steps that make it
+// fit for the destination and reports false when it must not be replicated.
+// With passive set, workloads are kept at zero replicas.
+func prepareObject(gvr schema.GroupVersionResource, u *unstructured.Unstructured, transform TransformRules, passive bool) (bool, error) {
+	if objectExcluded(u) || !applyCleanupRules(gvr, u) {
+		return false, nil
+	}
+	if err := transform.Apply(gvr, u); err != nil {
+		return false, err
+	}
+	if passive {
+		scaleToZero(gvr, u)
+	}
+	return true, nil
+}
 
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+// writable reports whether source changes may reach the destination: not while
+// paused or stopped, and not once the destination is promoted, so a source
+// that comes back cannot overwrite it.
+func (s *session) writable() bool {
+	return !s.paused.Load() && !s.promoted.Load() && !s.stopped()
+}
+
+// passive reports whether workloads are currently held at zero replicas: in
+// active-passive mode until the destination is promoted.
+func (s *session) passive() bool {
+	return s.drType == DRTypeActivePassive && !s.promoted.Load()
+}
+
+// scaleToZero records the replica count of a scalable workload in
+// ReplicasAnnotation and sets it to zero.
+func scaleToZero(gvr schema.GroupVersionResource, u *unstructured.Unstructured) {
+	if !isScalable(gvr) {
+		return
+	}
+	replicas, found, err := unstructured.NestedInt64(u.Object, "spec", "replicas")
+	if err != nil {
+		return
+	}
+	if !found {
+		replicas = 1
+	}
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[ReplicasAnnotation] = strconv.FormatInt(replicas, 10)
+	u.SetAnnotations(annotations)
+	_ = unstructured.SetNestedField(u.Object, int64(0), "spec", "replicas")
+}
+
+func isScalable(gvr schema.GroupVersionResource) bool {
+	return gvr.Group == "apps" && (gvr.Resource == "deployments" || gvr.Resource == "statefulsets")
+}
+
+func watchAndSync(gvr schema.GroupVersionResource, s *session, namespace string) {
+	// The label selector scopes workloads; cluster-scoped kinds are not filtered by it.
+	labelSelector := s.scope.LabelSelector
+	if namespace == "" {
+		labelSelector = ""
+	}
+	w := &informerWatch{gvr: gvr, namespace: namespace, queue: newEventQueue(), stop: make(chan struct{})}
+	w.informer = s.hub.acquire(gvr, namespace, labelSelector)
+	if !s.trackWatch(w) {
+		s.hub.release(gvr, namespace, labelSelector)
+		return
+	}
+
+	registration, err := w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			u := obj.(*unstructured.Unstructured)
-			u.SetResourceVersion("")
-			_, err := destClient.Resource(gvr).Namespace(namespace).Create(context.TODO(), u, metav1.CreateOptions{})
-			if err != nil {
-				log.Printf("Add error: %v", err)
-			} else {
-				log.Printf("✅ Created %s in %s", u.GetName(), namespace)
-			}
+			s.enqueue(w, eventAdd, obj)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			u := newObj.(*unstructured.Unstructured)
-			cleanObject(u)
-
-			_, err := destClient.Resource(gvr).Namespace(namespace).Update(context.TODO(), u, metav1.UpdateOptions{})
-			if err != nil {
-				// fallback to delete and create
-				_ = destClient.Resource(gvr).Namespace(namespace).Delete(context.TODO(), u.GetName(), metav1.DeleteOptions{})
-				_, err = destClient.Resource(gvr).Namespace(namespace).Create(context.TODO(), u, metav1.CreateOptions{})
-				if err != nil {
-					log.Printf("❌ Fallback create failed for %s in %s: %v", u.GetName(), namespace, err)
-				} else {
-					log.Printf("✅ Fallback recreated %s in %s", u.GetName(), namespace)
-				}
-			} else {
-				log.Printf("🔄 Updated %s in %s", u.GetName(), namespace)
-			}
+			s.enqueue(w, eventUpdate, newObj)
 		},
-
 		DeleteFunc: func(obj interface{}) {
-			u := obj.(*unstructured.Unstructured)
-			err := destClient.Resource(gvr).Namespace(namespace).Delete(context.TODO(), u.GetName(), metav1.DeleteOptions{})
-			if err != nil {
-				log.Printf("Delete error: %v", err)
-			} else {
-				log.Printf("🗑️ Deleted %s from %s", u.GetName(), namespace)
-			}
+			s.enqueue(w, eventDelete, obj)
 		},
 	})
+	if err != nil {
+		log.Printf("❌ Failed to watch %s in namespace %s: %v", gvrKey(gvr), namespace, err)
+		s.recordError(err)
+		s.stopWatch(namespace, gvr)
+		s.hub.release(gvr, namespace, labelSelector)
+		return
+	}
+	s.mu.Lock()
+	w.synced = registration.HasSynced
+	s.mu.Unlock()
 
-	stop := make(chan struct{})
-	go informer.Run(stop)
-	if !cache.WaitForCacheSync(stop, informer.HasSynced) {
-		log.Fatalf("Failed to sync cache for %v in namespace %s", gvr, namespace)
+	go s.processEvents(w)
+	go func() {
+		<-w.stop
+		if err := w.informer.RemoveEventHandler(registration); err != nil {
+			log.Printf("Failed to remove handler for %s in namespace %s: %v", gvrKey(gvr), namespace, err)
+		}
+		s.hub.release(gvr, namespace, labelSelector)
+	}()
+	if !cache.WaitForCacheSync(w.stop, registration.HasSynced) {
+		log.Printf("Stopped before cache synced for %v in namespace %s", gvr, namespace)
 	}
 }
 
-func watchNamespacesAndSyncResources(sourceClient, destClient dynamic.Interface, sourceK8sClient *kubernetes.Clientset) {
-	nsWatcher, err := sourceK8sClient.CoreV1().Namespaces().Watch(context.TODO(), metav1.ListOptions{})
+func (s *session) enqueue(w *informerWatch, kind eventType, obj interface{}) {
+	s.recordSourceEvent()
+	w.queue.push(syncEvent{kind: kind, obj: obj, receivedAt: time.Now()})
+}
+
+// processEvents writes the queued events of one informer to the destination
+// until the informer is stopped.
+func (s *session) processEvents(w *informerWatch) {
+	for {
+		event, ok := w.queue.peek()
+		if !ok {
+			return
+		}
+		switch event.kind {
+		case eventAdd:
+			s.createObject(w.gvr, w.namespace, event.obj)
+		case eventUpdate:
+			s.syncObject(w.gvr, w.namespace, event.obj)
+		case eventDelete:
+			s.deleteObject(w.gvr, w.namespace, event.obj)
+		}
+		w.queue.done()
+	}
+}
+
+func (s *session) createObject(gvr schema.GroupVersionResource, namespace string, obj interface{}) {
+	delta := int64(1)
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		if resourceVersion, seeded := s.takeSeeded(gvr, namespace, u.GetName()); seeded {
+			if resourceVersion == u.GetResourceVersion() {
+				return
+			}
+			delta = 0
+		}
+	}
+	s.applyObject(gvr, namespace, obj, delta)
+}
+
+func (s *session) syncObject(gvr schema.GroupVersionResource, namespace string, obj interface{}) {
+	s.applyObject(gvr, namespace, obj, 0)
+}
+
+// applyObject server-side applies a source object to the destination under the
+// session's conflict policy. delta is added to the object count on success.
+func (s *session) applyObject(gvr schema.GroupVersionResource, namespace string, obj interface{}, delta int64) {
+	if err := s.writeObject(gvr, namespace, obj, delta); err != nil {
+		log.Printf("❌ Apply failed in %s: %v", namespace, err)
+		s.recordObjectError(gvr, namespace, obj.(*unstructured.Unstructured).GetName(), err)
+	}
+}
+
+// writeObject does the work of applyObject and returns its error instead of
+// recording it.
+func (s *session) writeObject(gvr schema.GroupVersionResource, namespace string, obj interface{}, delta int64) error {
+	if !s.writable() {
+		return nil
+	}
+	u := obj.(*unstructured.Unstructured).DeepCopy()
+	if s.isHeld(gvr, namespace, u.GetName()) {
+		return nil
+	}
+	keep, err := prepareObject(gvr, u, s.transform, s.passive())
 	if err != nil {
-		log.Fatalf("Failed to watch namespaces: %v", err)
+		return fmt.Errorf("transform failed for %s: %w", u.GetName(), err)
+	}
+	if !keep {
+		return nil
+	}
+	target := gvr
+	var transfer *SecretTransfer
+	if isSecret(gvr) {
+		var secret SecretTransfer
+		target, u, secret, err = s.secrets.prepare(u, obj.(*unstructured.Unstructured).GetResourceVersion())
+		if err != nil {
+			return fmt.Errorf("secret policy failed for %s: %w", secret.Name, err)
+		}
+		if u == nil {
+			s.recordSecretTransfer(secret)
+			return nil
+		}
+		transfer = &secret
 	}
 
-	// Define resources to sync
-	gvrs := []schema.GroupVersionResource{
-		{Group: "apps", Version: "v1", Resource: "deployments"},
-		{Group: "", Version: "v1", Resource: "services"},
-		{Group: "", Version: "v1", Resource: "configmaps"},
-		{Group: "", Version: "v1", Resource: "secrets"},
-		{Group: "", Version: "v1", Resource: "persistentvolumeclaims"},
-		{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	conflict, err := applyToDestination(s.destClient, target, namespace, u, s.conflictPolicy, s.jobID)
+	if err != nil {
+		return err
+	}
+	if conflict != nil {
+		log.Printf("⚠️ Field conflict on %s %s in %s: %v", gvrKey(gvr), u.GetName(), namespace, conflict.Fields)
+		s.recordConflict(gvr, conflict)
+		return nil
+	}
+	log.Printf("🔄 Applied %s in %s", u.GetName(), namespace)
+	s.recordApplied(gvr, namespace, u.GetName(), delta)
+	if transfer != nil {
+		s.recordSecretTransfer(*transfer)
+	}
+	return nil
+}
+
+func (s *session) deleteObject(gvr schema.GroupVersionResource, namespace string, obj interface{}) {
+	if !s.writable() {
+		return
+	}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || objectExcluded(u) || !applyCleanupRules(gvr, u.DeepCopy()) {
+		return
+	}
+	target := gvr
+	if isSecret(gvr) {
+		var replicated bool
+		// A skipped Secret may share its name with one the destination
+		// created itself, which must stay.
+		if target, replicated = s.secrets.deleteTarget(u); !replicated {
+			return
+		}
+	}
+	err := s.destClient.Resource(target).Namespace(namespace).Delete(context.TODO(), u.GetName(), metav1.DeleteOptions{})
+	if err != nil {
+		log.Printf("Delete error: %v", err)
+		s.recordObjectError(gvr, namespace, u.GetName(), err)
+	} else {
+		log.Printf("🗑️ Deleted %s from %s", u.GetName(), namespace)
+		s.recordSync(gvr, -1)
+		s.forgetObject(gvr, namespace, u.GetName())
+		if isSecret(gvr) {
+			s.recordSecretTransfer(SecretTransfer{Namespace: namespace, Name: u.GetName(), Type: secretType(u), Action: SecretDeleted})
+		}
+	}
+}
+
+// watchNamespacesAndSyncResources follows the source namespaces through the
+// hub: in-scope namespaces are created on the destination and get an informer
+// per resource, namespaces leaving the scope or deleted lose theirs.
+func watchNamespacesAndSyncResources(s *session) error {
+	informer := s.hub.acquire(namespaceGVR, "", "")
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			s.namespaceChanged(obj, "Added")
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			s.namespaceChanged(newObj, "Modified")
+		},
+		DeleteFunc: func(obj interface{}) {
+			s.namespaceDeleted(obj)
+		},
+	})
+	if err != nil {
+		s.hub.release(namespaceGVR, "", "")
+		return fmt.Errorf("failed to watch namespaces: %w", err)
 	}
 
 	log.Println("📡 Watching for namespace changes...")
 	go func() {
-		for event := range nsWatcher.ResultChan() {
-			ns, ok := event.Object.(*corev1.Namespace)
-			if !ok {
-				log.Printf("Failed to cast namespace object, got type: %T", event.Object)
-				continue
-			}
-			namespace := ns.GetName()
-			fmt.Printf("Namespace event: %s (%s)\n", namespace, event.Type)
-			if event.Type == watch.Added || event.Type == watch.Modified {
-				log.Printf("🔍 Namespace change detected: %s (%s)", namespace, event.Type)
-				for _, gvr := range gvrs {
-					go watchAndSync(gvr, sourceClient, destClient, namespace)
-				}
-			}
+		<-s.stop
+		if err := informer.RemoveEventHandler(registration); err != nil {
+			log.Printf("Failed to remove namespace handler of DR session %s: %v", s.jobID, err)
 		}
+		s.hub.release(namespaceGVR, "", "")
 	}()
+	return nil
+}
+
+func (s *session) namespaceChanged(obj interface{}, eventType string) {
+	if s.stopped() {
+		return
+	}
+	ns, err := toNamespace(obj)
+	if err != nil {
+		log.Printf("Failed to convert namespace object: %v", err)
+		return
+	}
+	namespace := ns.GetName()
+	if !s.scope.IncludesNamespace(namespace, ns.Annotations) {
+		s.stopNamespaceWatches(namespace)
+		return
+	}
+	log.Printf("🔍 Namespace change detected: %s (%s)", namespace, eventType)
+	// Namespaced objects can only be created once their namespace exists.
+	if err := s.ensureNamespace(ns); err != nil {
+		log.Printf("❌ Failed to create namespace %s on destination: %v", namespace, err)
+		s.recordObjectError(namespaceGVR, "", namespace, err)
+		return
+	}
+	for _, gvr := range s.gvrs {
+		if namespaceExcludesResource(ns.Annotations, gvr) {
+			s.stopWatch(namespace, gvr)
+			continue
+		}
+		go watchAndSync(gvr, s, namespace)
+	}
+}
+
+func (s *session) namespaceDeleted(obj interface{}) {
+	if s.stopped() {
+		return
+	}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ns, err := toNamespace(obj)
+	if err != nil {
+		log.Printf("Failed to convert namespace object: %v", err)
+		return
+	}
+	s.stopNamespaceWatches(ns.Name)
+	if s.scope.IncludesNamespace(ns.Name, ns.Annotations) {
+		s.deleteNamespace(ns.Name)
+	}
+}
+
+func toNamespace(obj interface{}) (*corev1.Namespace, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected namespace object type %T", obj)
+	}
+	ns := &corev1.Namespace{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, ns); err != nil {
+		return nil, err
+	}
+	return ns, nil
 }
 
+var namespaceGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+
+// ensureNamespace creates or updates the namespace on the destination with the
+// source's labels and annotations.
+func (s *session) ensureNamespace(ns *corev1.Namespace) error {
+	return s.createNamespace(namespaceObject(ns))
+}
+
+// ensureNamespaces creates every in-scope source namespace on the destination.
+func (s *session) ensureNamespaces() {
+	namespaces, err := s.sourceK8sClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		log.Printf("❌ Failed to list namespaces of DR session %s: %v", s.jobID, err)
+		s.recordError(err)
+		return
+	}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if !s.scope.IncludesNamespace(ns.Name, ns.Annotations) {
+			continue
+		}
+		if err := s.ensureNamespace(ns); err != nil {
+			log.Printf("❌ Failed to create namespace %s on destination: %v", ns.Name, err)
+			s.recordObjectError(namespaceGVR, "", ns.Name, err)
+		}
+	}
+}
+
+func namespaceObject(ns *corev1.Namespace) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("Namespace")
+	u.SetName(ns.Name)
+	u.SetLabels(ns.Labels)
+	u.SetAnnotations(ns.Annotations)
+	return u
+}
+
+// createNamespace server-side applies a namespace like any other object, so
+// label and annotation changes on the source, including the scope
+// annotations, reach the destination too.
+func (s *session) createNamespace(u *unstructured.Unstructured) error {
+	if !s.writable() {
+		return nil
+	}
+	u = u.DeepCopy()
+	applyCleanupRules(namespaceGVR, u)
+	delta := int64(0)
+	_, err := s.destClient.Resource(namespaceGVR).Get(context.TODO(), u.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		delta = 1
+	} else if err != nil {
+		return err
+	}
+	conflict, err := applyToDestination(s.destClient, namespaceGVR, "", u, s.conflictPolicy, s.jobID)
+	if err != nil {
+		return err
+	}
+	if conflict != nil {
+		log.Printf("⚠️ Field conflict on namespace %s: %v", u.GetName(), conflict.Fields)
+		s.recordConflict(namespaceGVR, conflict)
+		return nil
+	}
+	if delta > 0 {
+		log.Printf("✅ Created namespace %s", u.GetName())
+	}
+	s.recordApplied(namespaceGVR, "", u.GetName(), delta)
+	return nil
+}
+
+func (s *session) deleteNamespace(namespace string) {
+	if !s.writable() {
+		return
+	}
+	err := s.destClient.Resource(namespaceGVR).Delete(context.TODO(), namespace, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Delete error: %v", err)
+		s.recordObjectError(namespaceGVR, "", namespace, err)
+		return
+	}
+	log.Printf("🗑️ Deleted namespace %s", namespace)
+	s.recordSync(namespaceGVR, -1)
+	s.forgetObject(namespaceGVR, "", namespace)
+}
+
+// watchClusterScopedResources starts one informer per cluster-scoped kind that
+// passes the session's resource filter.
+func watchClusterScopedResources(s *session, filter ResourceFilter) {
+	for _, r := range clusterScopedResources {
+		if !filter.matches(r.gvr, r.kind) {
+			continue
+		}
+		go watchAndSync(r.gvr, s, "")
+	}
+}
+
+// cleanObject drops the metadata that belongs to the cluster an object was
+// read from. Owner UIDs do not exist on the destination either; a stale
+// reference would let its garbage collector delete the object. The JobLabel
+// of a source that is itself a DR destination is dropped too.
 func cleanObject(u *unstructured.Unstructured) {
 	unstructured.RemoveNestedField(u.Object, "metadata", "resourceVersion")
 	unstructured.RemoveNestedField(u.Object, "metadata", "uid")
@@ -157,33 +724,309 @@ func cleanObject(u *unstructured.Unstructured) {
 	unstructured.RemoveNestedField(u.Object, "metadata", "managedFields")
 	unstructured.RemoveNestedField(u.Object, "metadata", "selfLink")
 	unstructured.RemoveNestedField(u.Object, "metadata", "generation")
+	unstructured.RemoveNestedField(u.Object, "metadata", "ownerReferences")
+	if labels := u.GetLabels(); labels[JobLabel] != "" {
+		delete(labels, JobLabel)
+		if len(labels) == 0 {
+			labels = nil
+		}
+		u.SetLabels(labels)
+	}
+}
+
+// clusterScopedResources are replicated once per session, before and
+// independently of any namespace.
+var clusterScopedResources = []struct {
+	gvr  schema.GroupVersionResource
+	kind string
+}{
+	{schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}, "CustomResourceDefinition"},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}, "ClusterRole"},
+	{schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}, "ClusterRoleBinding"},
+	{schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"}, "StorageClass"},
+	{schema.GroupVersionResource{Group: "scheduling.k8s.io", Version: "v1", Resource: "priorityclasses"}, "PriorityClass"},
+	{schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingressclasses"}, "IngressClass"},
 }
 
-func monitorClusterHealth(client *kubernetes.Clientset, onFailure func()) {
+// cleanupRules prepare objects for the destination by dropping what the source
+// cluster allocated for them. A rule returns false when the object belongs to
+// the destination cluster itself and must not be replicated at all.
+var cleanupRules = map[string]func(u *unstructured.Unstructured) bool{
+	"namespaces": func(u *unstructured.Unstructured) bool {
+		unstructured.RemoveNestedField(u.Object, "spec", "finalizers")
+		unstructured.RemoveNestedField(u.Object, "status")
+		return true
+	},
+	"customresourcedefinitions.apiextensions.k8s.io": func(u *unstructured.Unstructured) bool {
+		unstructured.RemoveNestedField(u.Object, "status")
+		return true
+	},
+	"clusterroles.rbac.authorization.k8s.io": func(u *unstructured.Unstructured) bool {
+		if isBootstrapRBAC(u) {
+			return false
+		}
+		// Aggregated roles get their rules filled in by the destination's controller.
+		if _, found, _ := unstructured.NestedMap(u.Object, "aggregationRule"); found {
+			unstructured.RemoveNestedField(u.Object, "rules")
+		}
+		return true
+	},
+	"clusterrolebindings.rbac.authorization.k8s.io": func(u *unstructured.Unstructured) bool {
+		return !isBootstrapRBAC(u)
+	},
+	"storageclasses.storage.k8s.io": func(u *unstructured.Unstructured) bool {
+		// The destination keeps its own default class.
+		removeAnnotations(u, "storageclass.kubernetes.io/is-default-class", "storageclass.beta.kubernetes.io/is-default-class")
+		return true
+	},
+	"priorityclasses.scheduling.k8s.io": func(u *unstructured.Unstructured) bool {
+		return !strings.HasPrefix(u.GetName(), "system-")
+	},
+	"ingressclasses.networking.k8s.io": func(u *unstructured.Unstructured) bool {
+		removeAnnotations(u, "ingressclass.kubernetes.io/is-default-class")
+		return true
+	},
+	"services": func(u *unstructured.Unstructured) bool {
+		// The API server's own Service is maintained by the destination.
+		if u.GetNamespace() == "default" && u.GetName() == "kubernetes" {
+			return false
+		}
+		// Cluster IPs come from the source's service CIDR and node ports may be
+		// taken on the destination; both are allocated there instead. A
+		// headless Service keeps its "None".
+		if clusterIP, _, _ := unstructured.NestedString(u.Object, "spec", "clusterIP"); clusterIP != corev1.ClusterIPNone {
+			unstructured.RemoveNestedField(u.Object, "spec", "clusterIP")
+			unstructured.RemoveNestedField(u.Object, "spec", "clusterIPs")
+		}
+		unstructured.RemoveNestedField(u.Object, "spec", "healthCheckNodePort")
+		if ports, found, _ := unstructured.NestedSlice(u.Object, "spec", "ports"); found {
+			for _, p := range ports {
+				if port, ok := p.(map[string]interface{}); ok {
+					delete(port, "nodePort")
+				}
+			}
+			_ = unstructured.SetNestedSlice(u.Object, ports, "spec", "ports")
+		}
+		return true
+	},
+	"persistentvolumeclaims": func(u *unstructured.Unstructured) bool {
+		// The source volume does not exist on the destination, which binds
+		// the claim to a volume of its own.
+		unstructured.RemoveNestedField(u.Object, "spec", "volumeName")
+		annotations := u.GetAnnotations()
+		for key := range annotations {
+			if strings.HasPrefix(key, "pv.kubernetes.io/") {
+				delete(annotations, key)
+			}
+		}
+		u.SetAnnotations(annotations)
+		removeAnnotations(u,
+			"volume.kubernetes.io/selected-node",
+			"volume.kubernetes.io/storage-provisioner",
+			"volume.beta.kubernetes.io/storage-provisioner")
+		return true
+	},
+}
+
+// applyCleanupRules runs the cleanup rule for gvr, if any, and reports whether
+// the object should be replicated.
+func applyCleanupRules(gvr schema.GroupVersionResource, u *unstructured.Unstructured) bool {
+	rule, ok := cleanupRules[gvrKey(gvr)]
+	if !ok {
+		return true
+	}
+	return rule(u)
+}
+
+func isBootstrapRBAC(u *unstructured.Unstructured) bool {
+	return strings.HasPrefix(u.GetName(), "system:") || u.GetLabels()["kubernetes.io/bootstrapping"] == "rbac-defaults"
+}
+
+func removeAnnotations(u *unstructured.Unstructured, keys ...string) {
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		return
+	}
+	for _, key := range keys {
+		delete(annotations, key)
+	}
+	u.SetAnnotations(annotations)
+}
+
+// monitorClusterHealth probes the API server every interval and calls onFailure
+// once FailureThreshold consecutive probes have failed.
+func monitorClusterHealth(client *kubernetes.Clientset, hc HealthCheck, stop <-chan struct{}, onFailure func()) {
+	failures := 0
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
 	for {
-		_, err := client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), hc.Interval)
+		_, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{Limit: 1})
+		cancel()
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		log.Printf("⚠️ Source health probe failed (%d/%d): %v", failures, hc.FailureThreshold, err)
+		if failures >= hc.FailureThreshold {
 			onFailure()
 			return
 		}
-		time.Sleep(10 * time.Second)
 	}
 }
-func initiateFailover(dst *kubernetes.Clientset) error {
-	// Sample: scale replicas of all deployments to 1
-	nsList, err := dst.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+
+// initiateFailover scales the workloads the session replicated in passive mode
+// back to the replica count recorded from the source and returns the counts
+// it restored, keyed by objectKey.
+func (s *session) initiateFailover() (map[string]int32, error) {
+	return restoreReplicas(s.destK8sClient, s.jobID, s.scope, nil)
+}
+
+// restoreReplicas scales the in-scope workloads of a job that carry
+// ReplicasAnnotation back up and removes the annotation. The count is taken
+// from replicas, keyed by objectKey, when it has an entry and from the
+// annotation otherwise. Workloads other DR jobs replicated are left alone.
+func restoreReplicas(dst kubernetes.Interface, jobID string, scope Scope, replicas map[string]int32) (map[string]int32, error) {
+	restored := map[string]int32{}
+	inScope, err := scopedNamespaces(dst, scope)
 	if err != nil {
-		return err
+		return restored, err
 	}
-	for _, ns := range nsList.Items {
-		deployments, _ := dst.AppsV1().Deployments(ns.Name).List(context.TODO(), metav1.ListOptions{})
-		for _, d := range deployments.Items {
-			d.Spec.Replicas = ptr.To(int32(1)) // Scale to 1 replica
-			_, err := dst.AppsV1().Deployments(ns.Name).Update(context.TODO(), &d, metav1.UpdateOptions{})
-			if err != nil {
-				fmt.Printf("⚠️ Failover update failed for %s: %v\n", d.Name, err)
-			}
+	listOptions := metav1.ListOptions{LabelSelector: jobSelector(jobID, scope)}
+
+	var errs []error
+	deployments, err := dst.AppsV1().Deployments("").List(context.TODO(), listOptions)
+	if err != nil {
+		return restored, err
+	}
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		count, ok := recordedReplicas(d.Annotations)
+		if !ok || !inScope[d.Namespace] {
+			continue
+		}
+		key := objectKey(gvrKey(deploymentsGVR), d.Namespace, d.Name)
+		if recorded, ok := replicas[key]; ok {
+			count = recorded
 		}
+		if err := applyDeploymentReplicas(dst, d, jobID, count, ""); err != nil {
+			log.Printf("⚠️ Replica restore failed for %s: %v", d.Name, err)
+			errs = append(errs, err)
+			continue
+		}
+		restored[key] = count
 	}
-	return nil
+	statefulSets, err := dst.AppsV1().StatefulSets("").List(context.TODO(), listOptions)
+	if err != nil {
+		return restored, errors.Join(append(errs, err)...)
+	}
+	for i := range statefulSets.Items {
+		sts := &statefulSets.Items[i]
+		count, ok := recordedReplicas(sts.Annotations)
+		if !ok || !inScope[sts.Namespace] {
+			continue
+		}
+		key := objectKey(gvrKey(statefulSetsGVR), sts.Namespace, sts.Name)
+		if recorded, ok := replicas[key]; ok {
+			count = recorded
+		}
+		if err := applyStatefulSetReplicas(dst, sts, jobID, count, ""); err != nil {
+			log.Printf("⚠️ Replica restore failed for %s: %v", sts.Name, err)
+			errs = append(errs, err)
+			continue
+		}
+		restored[key] = count
+	}
+	return restored, errors.Join(errs...)
+}
+
+// scopedNamespaces reports for every namespace of a cluster whether it is in
+// scope.
+func scopedNamespaces(client kubernetes.Interface, scope Scope) (map[string]bool, error) {
+	namespaces, err := client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	inScope := map[string]bool{}
+	for _, ns := range namespaces.Items {
+		inScope[ns.Name] = scope.IncludesNamespace(ns.Name, ns.Annotations)
+	}
+	return inScope, nil
+}
+
+// jobSelector selects the objects a job wrote that match its scope's label
+// selector.
+func jobSelector(jobID string, scope Scope) string {
+	selector := JobLabel + "=" + jobID
+	if scope.LabelSelector != "" {
+		selector += "," + scope.LabelSelector
+	}
+	return selector
+}
+
+// applyDeploymentReplicas server-side applies a replica count to d as FieldManager,
+// with recorded stored in ReplicasAnnotation or the annotation removed when
+// recorded is empty. The rest of the apply is what DR already owns on d, so
+// the next replication apply and the scaling never take fields from each
+// other.
+func applyDeploymentReplicas(client kubernetes.Interface, d *appsv1.Deployment, jobID string, replicas int32, recorded string) error {
+	config, err := appsv1ac.ExtractDeployment(d, FieldManager)
+	if err != nil {
+		return err
+	}
+	if config.Spec == nil {
+		config.WithSpec(appsv1ac.DeploymentSpec())
+	}
+	config.Spec.WithReplicas(replicas)
+	config.WithLabels(map[string]string{JobLabel: jobID})
+	if recorded == "" {
+		delete(config.Annotations, ReplicasAnnotation)
+	} else {
+		config.WithAnnotations(map[string]string{ReplicasAnnotation: recorded})
+	}
+	_, err = client.AppsV1().Deployments(d.Namespace).Apply(context.TODO(), config, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
+
+// applyStatefulSetReplicas is applyDeploymentReplicas for a StatefulSet.
+func applyStatefulSetReplicas(client kubernetes.Interface, sts *appsv1.StatefulSet, jobID string, replicas int32, recorded string) error {
+	config, err := appsv1ac.ExtractStatefulSet(sts, FieldManager)
+	if err != nil {
+		return err
+	}
+	if config.Spec == nil {
+		config.WithSpec(appsv1ac.StatefulSetSpec())
+	}
+	config.Spec.WithReplicas(replicas)
+	config.WithLabels(map[string]string{JobLabel: jobID})
+	if recorded == "" {
+		delete(config.Annotations, ReplicasAnnotation)
+	} else {
+		config.WithAnnotations(map[string]string{ReplicasAnnotation: recorded})
+	}
+	_, err = client.AppsV1().StatefulSets(sts.Namespace).Apply(context.TODO(), config, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	return err
+}
+
+var (
+	deploymentsGVR  = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	statefulSetsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+)
+
+func recordedReplicas(annotations map[string]string) (int32, bool) {
+	value, ok := annotations[ReplicasAnnotation]
+	if !ok {
+		return 0, false
+	}
+	replicas, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(replicas), true
 }
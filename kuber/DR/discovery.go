@@ -0,0 +1,163 @@
+package DR
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+var crdGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// DefaultExcludedResources are namespaced kinds owned by controllers or by the
+// API server itself; copying them would fight the destination's controllers.
+var DefaultExcludedResources = []string{
+	"events",
+	"events.events.k8s.io",
+	"pods",
+	"replicasets.apps",
+	"controllerrevisions.apps",
+	"endpoints",
+	"endpointslices.discovery.k8s.io",
+	"leases.coordination.k8s.io",
+	"*.metrics.k8s.io",
+}
+
+// ResourceFilter selects which discovered resources a DR session replicates.
+// A pattern is a path.Match glob compared against the Kind ("Certificate"),
+// the resource ("certificates"), the resource and group
+// ("certificates.cert-manager.io") and the group alone ("*.cert-manager.io").
+type ResourceFilter struct {
+	Include []string `json:"include_resources"`
+	Exclude []string `json:"exclude_resources"`
+}
+
+// Validate checks that every pattern is a well-formed glob.
+func (f ResourceFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid resource pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (f ResourceFilter) matches(gvr schema.GroupVersionResource, kind string) bool {
+	names := []string{kind, gvr.Resource, gvrKey(gvr)}
+	if gvr.Group != "" {
+		names = append(names, gvr.Group)
+	}
+	matchAny := func(patterns []string) bool {
+		for _, name := range names {
+			if matchesAny(name, patterns) {
+				return true
+			}
+		}
+		return false
+	}
+	if matchAny(DefaultExcludedResources) || matchAny(f.Exclude) {
+		return false
+	}
+	return len(f.Include) == 0 || matchAny(f.Include)
+}
+
+// DiscoverResources returns the preferred version of every namespaced resource
+// on the cluster that can be listed, watched and created and that passes the
+// filter.
+func DiscoverResources(dc discovery.DiscoveryInterface, filter ResourceFilter) ([]schema.GroupVersionResource, error) {
+	lists, err := discovery.ServerPreferredNamespacedResources(dc)
+	if err != nil {
+		// Unavailable aggregated APIs only cost us their own resources.
+		if !discovery.IsGroupDiscoveryFailedError(err) || len(lists) == 0 {
+			return nil, fmt.Errorf("failed to discover resources: %w", err)
+		}
+		log.Printf("⚠️ Partial discovery: %v", err)
+	}
+	lists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "watch", "create"}}, lists)
+
+	var gvrs []schema.GroupVersionResource
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			gvr := gv.WithResource(resource.Name)
+			if filter.matches(gvr, resource.Kind) {
+				gvrs = append(gvrs, gvr)
+			}
+		}
+	}
+	return gvrs, nil
+}
+
+// ensureCRDs copies the definition of every custom resource in gvrs from the
+// source to the destination when the destination does not have it yet.
+func ensureCRDs(sourceClient, destClient dynamic.Interface, gvrs []schema.GroupVersionResource) error {
+	seen := sets.New[string]()
+	for _, gvr := range gvrs {
+		if gvr.Group == "" || !strings.Contains(gvr.Group, ".") || seen.Has(gvrKey(gvr)) {
+			continue
+		}
+		name := gvrKey(gvr)
+		seen.Insert(name)
+
+		crd, err := sourceClient.Resource(crdGVR).Get(context.TODO(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// Built-in or aggregated API rather than a CRD.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CRD %s from source: %w", name, err)
+		}
+		_, err = destClient.Resource(crdGVR).Get(context.TODO(), name, metav1.GetOptions{})
+		if err == nil {
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to read CRD %s from destination: %w", name, err)
+		}
+
+		cleanObject(crd)
+		unstructured.RemoveNestedField(crd.Object, "status")
+		if _, err := destClient.Resource(crdGVR).Create(context.TODO(), crd, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create CRD %s on destination: %w", name, err)
+		}
+		log.Printf("📐 Copied CRD %s to destination", name)
+		if err := waitForCRDEstablished(destClient, name, 30*time.Second); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func waitForCRDEstablished(client dynamic.Interface, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		crd, err := client.Resource(crdGVR).Get(context.TODO(), name, metav1.GetOptions{})
+		if err == nil {
+			conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+			for _, c := range conditions {
+				condition, ok := c.(map[string]interface{})
+				if ok && condition["type"] == "Established" && condition["status"] == "True" {
+					return nil
+				}
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("CRD %s was not established on destination within %s", name, timeout)
+}
@@ -0,0 +1,407 @@
+package DR
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultDrillTimeout bounds how long a drill waits for its Deployments
+	// to become Available when DrillOptions.Timeout is zero.
+	DefaultDrillTimeout = 10 * time.Minute
+	// drillPollInterval is how often Deployment availability is checked.
+	drillPollInterval = 2 * time.Second
+	// drillProbeTimeout bounds each Service probe.
+	drillProbeTimeout = 5 * time.Second
+)
+
+// DrillOptions select what a drill exercises on the destination of a job.
+type DrillOptions struct {
+	// Scope picks the passive Deployments to scale up. It must name
+	// namespaces to include or a label selector, so a drill never wakes the
+	// whole destination.
+	Scope   Scope
+	Timeout time.Duration
+}
+
+// Validate checks that the drill is scoped.
+func (o DrillOptions) Validate() error {
+	if len(o.Scope.IncludeNamespaces) == 0 && o.Scope.LabelSelector == "" {
+		return errors.New("a drill needs include_namespaces or a label_selector")
+	}
+	if o.Timeout < 0 {
+		return errors.New("drill timeout cannot be negative")
+	}
+	return o.Scope.Validate()
+}
+
+// DrillReport is the outcome of one drill. Durations are in milliseconds.
+type DrillReport struct {
+	JobID      string    `json:"job_id"`
+	Passed     bool      `json:"passed"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+	// TimeToAvailableMs is how long the slowest Deployment took to become
+	// Available after the scale-up: the recovery time the drill measured.
+	TimeToAvailableMs int64           `json:"time_to_available_ms"`
+	ScaleDownMs       int64           `json:"scale_down_ms"`
+	Workloads         []DrillWorkload `json:"workloads"`
+	Services          []DrillProbe    `json:"services"`
+	Error             string          `json:"error,omitempty"`
+}
+
+// DrillWorkload is one Deployment a drill scaled up.
+type DrillWorkload struct {
+	Namespace        string `json:"namespace"`
+	Name             string `json:"name"`
+	Replicas         int32  `json:"replicas"`
+	Available        bool   `json:"available"`
+	AvailableAfterMs int64  `json:"available_after_ms,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// DrillProbe is one Service a drill checked once its Deployments were up.
+type DrillProbe struct {
+	Namespace      string `json:"namespace"`
+	Name           string `json:"name"`
+	Port           string `json:"port,omitempty"`
+	ReadyEndpoints int    `json:"ready_endpoints"`
+	Passed         bool   `json:"passed"`
+	LatencyMs      int64  `json:"latency_ms,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+var (
+	drillsMu      sync.Mutex
+	runningDrills = map[string]bool{}
+)
+
+// RunDrill simulates a failover of the job without touching the source: the
+// passive Deployments in options.Scope are scaled up on the destination to
+// their recorded source replica count and the drill waits for them to become
+// Available. Then the Services in their namespaces are probed through the API
+// server proxy, and everything is scaled back to zero. While the job's session
+// runs on this server, it leaves the drilled Deployments alone until the drill
+// ends. Only one drill runs per job at a time.
+func RunDrill(jobID string, destination *kubernetes.Clientset, options DrillOptions) *DrillReport {
+	report := &DrillReport{JobID: jobID, StartedAt: time.Now()}
+	defer func() {
+		report.FinishedAt = time.Now()
+		report.DurationMs = report.FinishedAt.Sub(report.StartedAt).Milliseconds()
+		log.Printf("🧪 DR drill for job %s finished, passed: %t", jobID, report.Passed)
+	}()
+	if err := options.Validate(); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if options.Timeout == 0 {
+		options.Timeout = DefaultDrillTimeout
+	}
+
+	drillsMu.Lock()
+	if runningDrills[jobID] {
+		drillsMu.Unlock()
+		report.Error = "another drill is running for this DR job"
+		return report
+	}
+	runningDrills[jobID] = true
+	drillsMu.Unlock()
+	defer func() {
+		drillsMu.Lock()
+		delete(runningDrills, jobID)
+		drillsMu.Unlock()
+	}()
+
+	if isFanOut(jobID) {
+		report.Error = "drills are not supported for DR jobs with several destinations"
+		return report
+	}
+	deployments, err := drillDeployments(destination, options.Scope)
+	if err != nil {
+		report.Error = "failed to list drill deployments: " + err.Error()
+		return report
+	}
+	if len(deployments) == 0 {
+		report.Error = "no passive deployments in the drill scope"
+		return report
+	}
+	s, _ := lookupSession(jobID)
+	if s != nil && s.promoted.Load() {
+		report.Error = "the destination has been promoted"
+		return report
+	}
+
+	log.Printf("🧪 DR drill for job %s scaling up %d deployments", jobID, len(deployments))
+	var scaled []*appsv1.Deployment
+	defer func() {
+		started := time.Now()
+		for _, d := range scaled {
+			if err := scaleDeployment(destination, d, 0); err != nil {
+				log.Printf("❌ Drill scale down failed for %s/%s: %v", d.Namespace, d.Name, err)
+				report.Passed = false
+				report.Error = joinDrillError(report.Error, fmt.Sprintf("failed to scale %s/%s back down: %v", d.Namespace, d.Name, err))
+			}
+			if s != nil {
+				s.releaseObject(deploymentsGVR, d.Namespace, d.Name)
+			}
+		}
+		report.ScaleDownMs = time.Since(started).Milliseconds()
+	}()
+
+	scaleUpAt := time.Now()
+	for _, d := range deployments {
+		replicas, _ := recordedReplicas(d.Annotations)
+		workload := DrillWorkload{Namespace: d.Namespace, Name: d.Name, Replicas: replicas}
+		if s != nil {
+			s.holdObject(deploymentsGVR, d.Namespace, d.Name)
+		}
+		if err := scaleDeployment(destination, d, replicas); err != nil {
+			workload.Error = err.Error()
+			if s != nil {
+				s.releaseObject(deploymentsGVR, d.Namespace, d.Name)
+			}
+		} else {
+			scaled = append(scaled, d)
+		}
+		report.Workloads = append(report.Workloads, workload)
+	}
+
+	waitForAvailable(destination, report, scaleUpAt, scaleUpAt.Add(options.Timeout))
+	namespaces := map[string]bool{}
+	for _, d := range scaled {
+		namespaces[d.Namespace] = true
+	}
+	for namespace := range namespaces {
+		report.Services = append(report.Services, probeServices(destination, namespace)...)
+	}
+
+	report.Passed = report.Error == ""
+	for _, w := range report.Workloads {
+		if !w.Available {
+			report.Passed = false
+		}
+	}
+	for _, p := range report.Services {
+		if !p.Passed {
+			report.Passed = false
+		}
+	}
+	return report
+}
+
+// drillDeployments returns the in-scope Deployments held at zero replicas by
+// passive replication.
+func drillDeployments(client *kubernetes.Clientset, scope Scope) ([]*appsv1.Deployment, error) {
+	namespaces, err := client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var deployments []*appsv1.Deployment
+	for _, ns := range namespaces.Items {
+		if !scope.IncludesNamespace(ns.Name, ns.Annotations) {
+			continue
+		}
+		list, err := client.AppsV1().Deployments(ns.Name).List(context.TODO(), metav1.ListOptions{LabelSelector: scope.LabelSelector})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			d := &list.Items[i]
+			replicas, ok := recordedReplicas(d.Annotations)
+			if !ok || replicas == 0 || (d.Spec.Replicas != nil && *d.Spec.Replicas != 0) {
+				continue
+			}
+			deployments = append(deployments, d)
+		}
+	}
+	return deployments, nil
+}
+
+func scaleDeployment(client *kubernetes.Clientset, d *appsv1.Deployment, replicas int32) error {
+	scale, err := client.AppsV1().Deployments(d.Namespace).GetScale(context.TODO(), d.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	scale.Spec.Replicas = replicas
+	_, err = client.AppsV1().Deployments(d.Namespace).UpdateScale(context.TODO(), d.Name, scale, metav1.UpdateOptions{})
+	return err
+}
+
+// waitForAvailable polls the scaled Deployments of report until they are all
+// Available or deadline passes.
+func waitForAvailable(client *kubernetes.Clientset, report *DrillReport, since, deadline time.Time) {
+	for {
+		pending := 0
+		for i := range report.Workloads {
+			w := &report.Workloads[i]
+			if w.Available || w.Error != "" {
+				continue
+			}
+			d, err := client.AppsV1().Deployments(w.Namespace).Get(context.TODO(), w.Name, metav1.GetOptions{})
+			if err == nil && deploymentAvailable(d, w.Replicas) {
+				w.Available = true
+				w.AvailableAfterMs = time.Since(since).Milliseconds()
+				if w.AvailableAfterMs > report.TimeToAvailableMs {
+					report.TimeToAvailableMs = w.AvailableAfterMs
+				}
+				continue
+			}
+			pending++
+		}
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			for i := range report.Workloads {
+				w := &report.Workloads[i]
+				if !w.Available && w.Error == "" {
+					w.Error = "not available within the drill timeout"
+				}
+			}
+			return
+		}
+		time.Sleep(drillPollInterval)
+	}
+}
+
+func deploymentAvailable(d *appsv1.Deployment, replicas int32) bool {
+	if d.Status.ObservedGeneration < d.Generation || d.Status.AvailableReplicas < replicas {
+		return false
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentAvailable {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// probeServices checks every Service with a selector in namespace: it must
+// have ready endpoints and answer an HTTP GET on its first TCP port through
+// the API server proxy. Any response below 500 counts, since the drill only
+// needs to know that a backend is serving.
+func probeServices(client *kubernetes.Clientset, namespace string) []DrillProbe {
+	services, err := client.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return []DrillProbe{{Namespace: namespace, Error: "failed to list services: " + err.Error()}}
+	}
+	var probes []DrillProbe
+	for _, svc := range services.Items {
+		if len(svc.Spec.Selector) == 0 || svc.Spec.Type == corev1.ServiceTypeExternalName {
+			continue
+		}
+		probe := DrillProbe{Namespace: namespace, Name: svc.Name}
+		slices, err := client.DiscoveryV1().EndpointSlices(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: discoveryv1.LabelServiceName + "=" + svc.Name,
+		})
+		if err != nil {
+			probe.Error = "failed to list endpoints: " + err.Error()
+			probes = append(probes, probe)
+			continue
+		}
+		for _, slice := range slices.Items {
+			for _, endpoint := range slice.Endpoints {
+				if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+					probe.ReadyEndpoints++
+				}
+			}
+		}
+		if probe.ReadyEndpoints == 0 {
+			probe.Error = "no ready endpoints"
+			probes = append(probes, probe)
+			continue
+		}
+		for _, port := range svc.Spec.Ports {
+			if port.Protocol == "" || port.Protocol == corev1.ProtocolTCP {
+				probe.Port = fmt.Sprint(port.Port)
+				break
+			}
+		}
+		if probe.Port == "" {
+			// Without a TCP port ready endpoints are all that can be checked.
+			probe.Passed = true
+			probes = append(probes, probe)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), drillProbeTimeout)
+		started := time.Now()
+		_, err = client.CoreV1().Services(namespace).ProxyGet("", svc.Name, probe.Port, "/", nil).DoRaw(ctx)
+		cancel()
+		probe.LatencyMs = time.Since(started).Milliseconds()
+		var status apierrors.APIStatus
+		switch {
+		case err == nil:
+			probe.Passed = true
+		case errors.As(err, &status) && status.Status().Code > 0 && status.Status().Code < 500:
+			probe.Passed = true
+		default:
+			probe.Error = err.Error()
+		}
+		probes = append(probes, probe)
+	}
+	return probes
+}
+
+func joinDrillError(existing, message string) string {
+	if existing == "" {
+		return message
+	}
+	return existing + "; " + message
+}
+
+var (
+	schedulesMu sync.Mutex
+	schedules   = map[string]chan struct{}{}
+)
+
+// ScheduleDrill calls run every time schedule comes due, until UnscheduleDrill
+// is called with the same id. Scheduling an id again replaces its schedule.
+func ScheduleDrill(id string, schedule *CronSchedule, run func()) {
+	stop := make(chan struct{})
+	schedulesMu.Lock()
+	if previous, ok := schedules[id]; ok {
+		close(previous)
+	}
+	schedules[id] = stop
+	schedulesMu.Unlock()
+
+	go func() {
+		for {
+			next := schedule.Next(time.Now())
+			if next.IsZero() {
+				log.Printf("Drill schedule %s (%s) never comes due again", id, schedule)
+				return
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			go run()
+		}
+	}()
+}
+
+// UnscheduleDrill stops the schedule registered under id, if any.
+func UnscheduleDrill(id string) {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	if stop, ok := schedules[id]; ok {
+		close(stop)
+		delete(schedules, id)
+	}
+}
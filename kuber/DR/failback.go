@@ -0,0 +1,273 @@
+package DR
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// failbackPollInterval is how often a failback checks whether the reverse
+	// replication has caught up, and failbackSettlePolls how many checks in a
+	// row must find it idle before the roles are swapped back.
+	failbackPollInterval = 2 * time.Second
+	failbackSettlePolls  = 3
+)
+
+// Endpoint is one cluster of a DR job.
+type Endpoint struct {
+	Client      dynamic.Interface
+	K8sClient   *kubernetes.Clientset
+	Provisioner string
+}
+
+// Failback moves a failed-over active-passive job back to its original source.
+// source and destination keep their roles from the original job and options
+// are the options it was started with.
+//
+// The promoted destination is first replicated back to the source, which is
+// held passive meanwhile. The reverse replication force-applies, undoes the
+// renames of options.Transform and never fails over. Once it has caught up
+// and a reconciliation has run, the destination is scaled back to zero, the
+// source workloads get the replica counts recorded at failover and forward
+// replication restarts under the same job ID. failoverReplicas is used when
+// the job's session is no longer running on this server.
+//
+// Failback returns once the reverse replication has started. The job reports
+// StateFailingBack until forward replication runs again. If the source cannot
+// catch up the job returns to StateFailedOver, with the destination still
+// serving.
+func Failback(jobID string, source, destination Endpoint, options Options, failoverReplicas map[string]int32, report func(Status)) error {
+	if source.Client == nil || destination.Client == nil || source.K8sClient == nil || destination.K8sClient == nil {
+		return fmt.Errorf("source and destination clients are required for failback")
+	}
+	if _, err := source.K8sClient.Discovery().ServerVersion(); err != nil {
+		return fmt.Errorf("original source cluster is not reachable: %w", err)
+	}
+	if isFanOut(jobID) {
+		return errors.New("failback is not supported for DR jobs with several destinations")
+	}
+	forward, err := lookupSession(jobID)
+	if err == nil {
+		if forward.reverse {
+			return errors.New("DR session " + jobID + " is already failing back")
+		}
+		if !forward.promoted.Load() {
+			return errors.New("DR session " + jobID + " has not failed over")
+		}
+		forward.mu.Lock()
+		if len(forward.failoverReplicas) > 0 {
+			failoverReplicas = forward.failoverReplicas
+		}
+		forward.mu.Unlock()
+	}
+	options.DestinationProvisioner = destination.Provisioner
+
+	reverseOptions := options
+	reverseOptions.DestinationProvisioner = source.Provisioner
+	reverseOptions.Transform = options.Transform.Inverse()
+	// The promoted destination is authoritative, so the fields other managers
+	// own on the original source are taken over.
+	reverseOptions.ConflictPolicy = ConflictForce
+	// The original source gets its Secrets back as they were: the overrides
+	// and the sealing belong to the destination.
+	reverseOptions.Secrets.Mode = SecretCopy
+	reverseOptions.SecretOverrides = nil
+	reverse, err := newSession(jobID, destination.Client, source.Client, destination.Provisioner, DRTypeActivePassive, nil, destination.K8sClient, source.K8sClient, reverseOptions, report)
+	if err != nil {
+		return err
+	}
+	reverse.reverse = true
+	reverse.failoverReplicas = failoverReplicas
+
+	// The forward session keeps the job until the reverse one takes its
+	// place, so a failed start leaves the promoted cluster protected.
+	if err := replaceSession(forward, reverse); err != nil {
+		return err
+	}
+	if forward != nil {
+		forward.shutdown()
+	}
+	reverse.begin()
+	log.Printf("↩️ DR session %s failing back", jobID)
+	go reverse.failback(source, destination, options, failoverReplicas)
+	return nil
+}
+
+// failback waits for a reverse session to catch up and then swaps the roles of
+// the two clusters back.
+func (s *session) failback(source, destination Endpoint, options Options, failoverReplicas map[string]int32) {
+	if !s.waitForCatchUp() {
+		log.Printf("Failback of DR session %s stopped before it caught up", s.jobID)
+		return
+	}
+	s.reconcile()
+	if failed := s.failedObjects(); failed > 0 {
+		s.abortFailback(fmt.Errorf("%d objects could not be replicated back to the original source", failed))
+		return
+	}
+	if s.stopped() {
+		return
+	}
+	unregisterSession(s)
+	s.shutdown()
+
+	log.Printf("🔁 DR session %s caught up, swapping roles back", s.jobID)
+	if err := demoteCluster(destination.K8sClient, s.jobID, s.scope, failoverReplicas); err != nil {
+		// Bring back whatever was already scaled down so the destination keeps serving.
+		if _, undoErr := restoreReplicas(destination.K8sClient, s.jobID, s.scope, nil); undoErr != nil {
+			err = errors.Join(err, undoErr)
+		}
+		s.abortFailback(fmt.Errorf("failed to demote the promoted cluster: %w", err))
+		return
+	}
+	if _, err := restoreReplicas(source.K8sClient, s.jobID, s.scope, failoverReplicas); err != nil {
+		log.Printf("❌ Failback of DR session %s could not restore the source: %v", s.jobID, err)
+		s.recordError(fmt.Errorf("failed to restore workloads on the original source: %w", err))
+		s.setState(StateFailed)
+		return
+	}
+
+	forward, err := newSession(s.jobID, source.Client, destination.Client, source.Provisioner, DRTypeActivePassive, nil, source.K8sClient, destination.K8sClient, options, s.report)
+	if err == nil {
+		err = forward.run()
+	}
+	if err != nil {
+		log.Printf("❌ Failback of DR session %s could not restart replication: %v", s.jobID, err)
+		s.recordError(fmt.Errorf("failed to restart replication: %w", err))
+		s.setState(StateFailed)
+		return
+	}
+	log.Printf("✅ DR session %s failed back to the original source", s.jobID)
+}
+
+// abortFailback stops a reverse session and leaves the job failed over.
+func (s *session) abortFailback(err error) {
+	log.Printf("❌ Failback of DR session %s aborted: %v", s.jobID, err)
+	s.recordError(fmt.Errorf("failback aborted: %w", err))
+	unregisterSession(s)
+	s.shutdown()
+	s.setState(StateFailedOver)
+}
+
+// waitForCatchUp blocks until the session has been idle for
+// failbackSettlePolls checks in a row and reports false if it is stopped first.
+func (s *session) waitForCatchUp() bool {
+	ticker := time.NewTicker(failbackPollInterval)
+	defer ticker.Stop()
+	for settled := 0; settled < failbackSettlePolls; {
+		select {
+		case <-s.stop:
+			return false
+		case <-ticker.C:
+		}
+		if s.caughtUp() {
+			settled++
+		} else {
+			settled = 0
+		}
+	}
+	return true
+}
+
+// caughtUp reports whether the session is running and every informer has
+// synced and written all of its events.
+func (s *session) caughtUp() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != StateRunning {
+		return false
+	}
+	for _, w := range s.watchers {
+		if w.synced == nil || !w.synced() {
+			return false
+		}
+		if depth, _ := w.queue.depth(); depth > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *session) failedObjects() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := 0
+	for _, status := range s.objects {
+		if status.State == ObjectFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// demoteCluster turns a promoted cluster passive again: every in-scope
+// Deployment and StatefulSet is scaled to zero with its replica count recorded
+// in ReplicasAnnotation, taken from replicas when it has an entry. Workloads
+// created on the cluster since failover are claimed for the job, so that
+// restoreReplicas can scale them back up.
+func demoteCluster(client kubernetes.Interface, jobID string, scope Scope, replicas map[string]int32) error {
+	inScope, err := scopedNamespaces(client, scope)
+	if err != nil {
+		return err
+	}
+	listOptions := metav1.ListOptions{LabelSelector: scope.LabelSelector}
+
+	var errs []error
+	deployments, err := client.AppsV1().Deployments("").List(context.TODO(), listOptions)
+	if err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		if !inScope[d.Namespace] {
+			continue
+		}
+		if _, ok := d.Annotations[ReplicasAnnotation]; ok {
+			continue
+		}
+		count := int32(1)
+		if d.Spec.Replicas != nil {
+			count = *d.Spec.Replicas
+		}
+		if recorded, ok := replicas[objectKey(gvrKey(deploymentsGVR), d.Namespace, d.Name)]; ok {
+			count = recorded
+		}
+		if err := applyDeploymentReplicas(client, d, jobID, 0, strconv.FormatInt(int64(count), 10)); err != nil {
+			log.Printf("⚠️ Demotion failed for %s: %v", d.Name, err)
+			errs = append(errs, err)
+		}
+	}
+	statefulSets, err := client.AppsV1().StatefulSets("").List(context.TODO(), listOptions)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for i := range statefulSets.Items {
+		sts := &statefulSets.Items[i]
+		if !inScope[sts.Namespace] {
+			continue
+		}
+		if _, ok := sts.Annotations[ReplicasAnnotation]; ok {
+			continue
+		}
+		count := int32(1)
+		if sts.Spec.Replicas != nil {
+			count = *sts.Spec.Replicas
+		}
+		if recorded, ok := replicas[objectKey(gvrKey(statefulSetsGVR), sts.Namespace, sts.Name)]; ok {
+			count = recorded
+		}
+		if err := applyStatefulSetReplicas(client, sts, jobID, 0, strconv.FormatInt(int64(count), 10)); err != nil {
+			log.Printf("⚠️ Demotion failed for %s: %v", sts.Name, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
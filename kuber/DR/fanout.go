@@ -0,0 +1,114 @@
+package DR
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Destination is one target of a fan-out DR job.
+type Destination struct {
+	Endpoint
+	// ID names the destination within the job, e.g. its cluster ID.
+	ID string
+	// Scope, when set, replaces the job's scope for this destination.
+	Scope *Scope
+	// Transform is layered on top of the job's transform.
+	Transform TransformRules
+	// SecretOverrides, when set, replaces the job's overrides store.
+	SecretOverrides func(namespace, name string) (map[string][]byte, error)
+}
+
+// Options returns the options of the job adjusted for this destination.
+func (d Destination) Options(options Options) Options {
+	if d.Scope != nil {
+		options.Scope = *d.Scope
+	}
+	options.Transform = options.Transform.Merge(d.Transform)
+	options.DestinationProvisioner = d.Provisioner
+	if d.SecretOverrides != nil {
+		options.SecretOverrides = d.SecretOverrides
+	}
+	return options
+}
+
+// PerformFanOutDR replicates one source to several destinations under a
+// single job. Every destination runs as a session of its own, with its own
+// scope, transformation, status and, in active-passive mode, failover, but
+// all of them share the source informers, so the source API server carries
+// the watches of one replication whatever the number of destinations.
+// Destinations whose scopes use different label selectors cannot share the
+// informers of namespaced resources. report receives the status of each
+// destination, with Status.DestinationID set.
+func PerformFanOutDR(jobID string, source Endpoint, DRType string, destinations []Destination, options Options, report func(Status)) error {
+	if len(destinations) == 0 {
+		return errors.New("at least one destination is required")
+	}
+	if source.Client == nil || source.K8sClient == nil {
+		return errors.New("source client is nil")
+	}
+	seen := map[string]bool{}
+	for _, d := range destinations {
+		if d.ID == "" {
+			return errors.New("every destination needs an ID")
+		}
+		if seen[d.ID] {
+			return fmt.Errorf("destination %s is listed more than once", d.ID)
+		}
+		seen[d.ID] = true
+	}
+	if _, err := jobSessions(jobID); err == nil {
+		return errors.New("DR session " + jobID + " is already running")
+	}
+	if err := options.Resources.Validate(); err != nil {
+		return err
+	}
+	gvrs, err := DiscoverResources(source.K8sClient.Discovery(), options.Resources)
+	if err != nil {
+		return err
+	}
+
+	hub := newInformerHub(source.Client)
+	created := make([]*session, 0, len(destinations))
+	for _, d := range destinations {
+		s, err := newSession(jobID, source.Client, d.Client, source.Provisioner, DRType, gvrs, source.K8sClient, d.K8sClient, d.Options(options), report)
+		if err != nil {
+			return fmt.Errorf("destination %s: %w", d.ID, err)
+		}
+		s.destinationID = d.ID
+		s.hub = hub
+		created = append(created, s)
+	}
+	for i, s := range created {
+		if err := s.run(); err != nil {
+			for _, started := range created[:i] {
+				unregisterSession(started)
+				started.shutdown()
+				started.setState(StateStopped)
+			}
+			return fmt.Errorf("destination %s: %w", s.destinationID, err)
+		}
+	}
+	return nil
+}
+
+// statePriority orders states from the one that most needs attention, for
+// summing up the destinations of a fan-out job.
+var statePriority = []string{StateFailed, StateFailingBack, StateFailedOver, StateSeeding, StatePending, StatePaused, StateRunning, StateStopped}
+
+// AggregateState sums up the states of the destinations of a fan-out job as
+// the one that most needs attention.
+func AggregateState(states []string) string {
+	present := map[string]bool{}
+	for _, state := range states {
+		present[state] = true
+	}
+	for _, state := range statePriority {
+		if present[state] {
+			return state
+		}
+	}
+	if len(states) > 0 {
+		return states[0]
+	}
+	return StatePending
+}
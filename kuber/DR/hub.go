@@ -0,0 +1,71 @@
+package DR
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerHub shares source informers between the sessions of one job, so a
+// fan-out to several destinations lists and watches the source only once.
+// Informers are keyed by resource, namespace and label selector, started on
+// first use and stopped when the last session releases them.
+type informerHub struct {
+	client dynamic.Interface
+
+	mu        sync.Mutex
+	informers map[string]*hubInformer
+}
+
+type hubInformer struct {
+	informer cache.SharedIndexInformer
+	stop     chan struct{}
+	refs     int
+}
+
+func newInformerHub(client dynamic.Interface) *informerHub {
+	return &informerHub{client: client, informers: map[string]*hubInformer{}}
+}
+
+func hubKey(gvr schema.GroupVersionResource, namespace, labelSelector string) string {
+	return namespace + "/" + gvrKey(gvr) + "?" + labelSelector
+}
+
+// acquire returns the running informer for gvr in namespace, starting it if
+// no session uses it yet. Every acquire must be paired with a release.
+func (h *informerHub) acquire(gvr schema.GroupVersionResource, namespace, labelSelector string) cache.SharedIndexInformer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := hubKey(gvr, namespace, labelSelector)
+	if shared, ok := h.informers[key]; ok {
+		shared.refs++
+		return shared.informer
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(h.client, 0, namespace, func(options *metav1.ListOptions) {
+		options.LabelSelector = labelSelector
+	})
+	shared := &hubInformer{informer: factory.ForResource(gvr).Informer(), stop: make(chan struct{}), refs: 1}
+	h.informers[key] = shared
+	go shared.informer.Run(shared.stop)
+	return shared.informer
+}
+
+// release drops one reference to an informer and stops it after the last.
+func (h *informerHub) release(gvr schema.GroupVersionResource, namespace, labelSelector string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := hubKey(gvr, namespace, labelSelector)
+	shared, ok := h.informers[key]
+	if !ok {
+		return
+	}
+	shared.refs--
+	if shared.refs == 0 {
+		close(shared.stop)
+		delete(h.informers, key)
+	}
+}
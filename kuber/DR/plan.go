@@ -0,0 +1,286 @@
+package DR
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Actions a DR plan reports for a source object.
+const (
+	PlanCreate    = "create"
+	PlanUpdate    = "update"
+	PlanUnchanged = "unchanged"
+	PlanConflict  = "conflict"
+	PlanError     = "error"
+)
+
+// PlanReport is the outcome of a DR dry run.
+type PlanReport struct {
+	Summary map[string]int `json:"summary"`
+	Entries []PlanEntry    `json:"entries"`
+}
+
+// PlanEntry is what replication would do to one object.
+type PlanEntry struct {
+	Resource  string        `json:"resource"`
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name"`
+	Action    string        `json:"action"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+	// ConflictFields are the fields owned by another manager on the destination.
+	ConflictFields []string `json:"conflict_fields,omitempty"`
+	Error          string   `json:"error,omitempty"`
+
+	before, after map[string]interface{}
+}
+
+// FieldChange is one differing field between the destination and what DR
+// would write there. Old or New is absent when the field is added or removed.
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Plan lists what PerformClusterDR would do with the same arguments without
+// writing anything: every in-scope source object is prepared as replication
+// would prepare it and server-side applied to the destination in dry-run mode.
+func Plan(sourceClient, destClient dynamic.Interface, sourceK8sClient *kubernetes.Clientset, provisioner, drType string, options Options) (*PlanReport, error) {
+	transform, err := resolveOptions(provisioner, &options)
+	if err != nil {
+		return nil, err
+	}
+	// Planning never seals, so it needs no sealing certificate.
+	secrets, err := newSecretHandler(options, nil)
+	if err != nil {
+		return nil, err
+	}
+	gvrs, err := DiscoverResources(sourceK8sClient.Discovery(), options.Resources)
+	if err != nil {
+		return nil, err
+	}
+	passive := drType == DRTypeActivePassive
+	report := &PlanReport{Summary: map[string]int{}}
+	add := func(entry PlanEntry) {
+		report.Summary[entry.Action]++
+		report.Entries = append(report.Entries, entry)
+	}
+
+	for _, r := range clusterScopedResources {
+		if !options.Resources.matches(r.gvr, r.kind) {
+			continue
+		}
+		list, err := sourceClient.Resource(r.gvr).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", gvrKey(r.gvr), err)
+		}
+		for i := range list.Items {
+			if entry, ok := planObject(destClient, r.gvr, "", &list.Items[i], transform, secrets, passive, options.ConflictPolicy, ""); ok {
+				add(entry)
+			}
+		}
+	}
+
+	namespaces, err := sourceK8sClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	for _, ns := range namespaces.Items {
+		if !options.Scope.IncludesNamespace(ns.Name, ns.Annotations) {
+			continue
+		}
+		nsObject := &unstructured.Unstructured{}
+		nsObject.SetAPIVersion("v1")
+		nsObject.SetKind("Namespace")
+		nsObject.SetName(ns.Name)
+		nsObject.SetLabels(ns.Labels)
+		nsObject.SetAnnotations(ns.Annotations)
+		if entry, ok := planObject(destClient, namespaceGVR, "", nsObject, transform, secrets, passive, options.ConflictPolicy, ""); ok {
+			add(entry)
+		}
+		for _, gvr := range gvrs {
+			if namespaceExcludesResource(ns.Annotations, gvr) {
+				continue
+			}
+			list, err := sourceClient.Resource(gvr).Namespace(ns.Name).List(context.TODO(), metav1.ListOptions{LabelSelector: options.Scope.LabelSelector})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s in %s: %w", gvrKey(gvr), ns.Name, err)
+			}
+			for i := range list.Items {
+				if entry, ok := planObject(destClient, gvr, ns.Name, &list.Items[i], transform, secrets, passive, options.ConflictPolicy, ""); ok {
+					add(entry)
+				}
+			}
+		}
+	}
+	return report, nil
+}
+
+// planObject compares one source object with the destination as the given
+// job would write it. It reports false when the object is out of scope.
+func planObject(destClient dynamic.Interface, gvr schema.GroupVersionResource, namespace string, source *unstructured.Unstructured, transform TransformRules, secrets *secretHandler, passive bool, policy, jobID string) (PlanEntry, bool) {
+	u := source.DeepCopy()
+	entry := PlanEntry{Resource: gvrKey(gvr), Namespace: namespace, Name: u.GetName()}
+	keep, err := prepareObject(gvr, u, transform, passive)
+	if !keep && err == nil {
+		return entry, false
+	}
+	if err != nil {
+		entry.Action, entry.Error = PlanError, err.Error()
+		return entry, true
+	}
+	if isSecret(gvr) {
+		if secrets.skips(u) {
+			return entry, false
+		}
+		if secrets.seal {
+			return planSealedSecret(destClient, entry, source.GetResourceVersion()), true
+		}
+		if _, err := secrets.override(u); err != nil {
+			entry.Action, entry.Error = PlanError, err.Error()
+			return entry, true
+		}
+	}
+	cleanObject(u)
+	setJobLabel(u, jobID)
+
+	current, err := destClient.Resource(gvr).Namespace(namespace).Get(context.TODO(), u.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		entry.Action = PlanCreate
+		entry.after = normalizeForDiff(u.Object)
+		return entry, true
+	}
+	if err != nil {
+		entry.Action, entry.Error = PlanError, err.Error()
+		return entry, true
+	}
+
+	applied, err := destClient.Resource(gvr).Namespace(namespace).Apply(context.TODO(), u.GetName(), u, metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        policy == ConflictForce,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if apierrors.IsConflict(err) {
+		entry.Action = PlanConflict
+		if conflict, _ := conflictFromError(gvr, namespace, u.GetName(), err); conflict != nil {
+			entry.ConflictFields = conflict.Fields
+		}
+		return entry, true
+	}
+	if err != nil {
+		entry.Action, entry.Error = PlanError, err.Error()
+		return entry, true
+	}
+
+	entry.before = normalizeForDiff(current.Object)
+	entry.after = normalizeForDiff(applied.Object)
+	entry.Changes = diffFields("", entry.before, entry.after)
+	if len(entry.Changes) == 0 {
+		entry.Action = PlanUnchanged
+	} else {
+		entry.Action = PlanUpdate
+	}
+	return entry, true
+}
+
+// normalizeForDiff drops the server-maintained fields that always differ
+// between two clusters.
+func normalizeForDiff(obj map[string]interface{}) map[string]interface{} {
+	u := &unstructured.Unstructured{Object: runtime.DeepCopyJSON(obj)}
+	cleanObject(u)
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u.Object
+}
+
+// diffFields walks two decoded objects and lists every leaf that differs.
+func diffFields(prefix string, before, after interface{}) []FieldChange {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		keys := map[string]bool{}
+		for k := range beforeMap {
+			keys[k] = true
+		}
+		for k := range afterMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		var changes []FieldChange
+		for _, k := range sorted {
+			changes = append(changes, diffFields(joinFieldPath(prefix, k), beforeMap[k], afterMap[k])...)
+		}
+		return changes
+	}
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList && len(beforeList) == len(afterList) {
+		var changes []FieldChange
+		for i := range beforeList {
+			changes = append(changes, diffFields(fmt.Sprintf("%s[%d]", prefix, i), beforeList[i], afterList[i])...)
+		}
+		return changes
+	}
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	return []FieldChange{{Path: prefix, Old: before, New: after}}
+}
+
+func joinFieldPath(prefix, key string) string {
+	if strings.ContainsAny(key, "./") {
+		return fmt.Sprintf("%s['%s']", prefix, key)
+	}
+	return prefix + "." + key
+}
+
+// UnifiedDiff renders every create and update of the plan as a unified diff
+// of the destination YAML against what DR would write.
+func (r *PlanReport) UnifiedDiff() (string, error) {
+	var b strings.Builder
+	for _, entry := range r.Entries {
+		if entry.Action != PlanCreate && entry.Action != PlanUpdate {
+			continue
+		}
+		before, err := toYAMLLines(entry.before)
+		if err != nil {
+			return "", err
+		}
+		after, err := toYAMLLines(entry.after)
+		if err != nil {
+			return "", err
+		}
+		name := entry.Resource + "/" + entry.Name
+		if entry.Namespace != "" {
+			name = entry.Resource + "/" + entry.Namespace + "/" + entry.Name
+		}
+		b.WriteString(unifiedDiff("destination/"+name, "source/"+name, before, after))
+	}
+	return b.String(), nil
+}
+
+func toYAMLLines(obj map[string]interface{}) ([]string, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
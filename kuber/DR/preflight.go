@@ -0,0 +1,564 @@
+package DR
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Checks a preflight finding can come from.
+const (
+	PreflightAPIVersion   = "api-version"
+	PreflightCRD          = "crd"
+	PreflightStorageClass = "storage-class"
+	PreflightIngressClass = "ingress-class"
+	PreflightCapacity     = "capacity"
+)
+
+// PreflightReport tells whether a destination can host what a DR job would
+// replicate to it. Errors block the job; warnings do not.
+type PreflightReport struct {
+	Passed   bool               `json:"passed"`
+	Errors   []PreflightFinding `json:"errors"`
+	Warnings []PreflightFinding `json:"warnings"`
+	// Requests are the CPU and memory requested by the replicated Deployments
+	// and StatefulSets at their source replica counts.
+	Requests ResourceTotals `json:"requests"`
+	// Available is what the destination has left, when it is known.
+	Available *ResourceTotals `json:"available,omitempty"`
+}
+
+// PreflightFinding is one problem found by a preflight check.
+type PreflightFinding struct {
+	Check     string `json:"check"`
+	Resource  string `json:"resource,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Message   string `json:"message"`
+}
+
+// ResourceTotals are amounts of CPU and memory.
+type ResourceTotals struct {
+	CPU    resource.Quantity `json:"cpu"`
+	Memory resource.Quantity `json:"memory"`
+}
+
+var (
+	persistentVolumeClaimsGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "persistentvolumeclaims"}
+	ingressesGVR              = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	storageClassesGVR         = schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"}
+	ingressClassesGVR         = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingressclasses"}
+)
+
+// preflight collects the findings of the checks and the objects they share.
+type preflight struct {
+	source      Endpoint
+	destination Endpoint
+	options     Options
+	transform   TransformRules
+	gvrs        []schema.GroupVersionResource
+	namespaces  map[string]map[string]string
+	report      *PreflightReport
+}
+
+// Preflight checks, without writing anything, whether destination can host
+// the replication of source with options: the API versions and CRDs of the
+// replicated resources, the StorageClasses and IngressClasses they reference
+// once transformed, and the CPU and memory their workloads request against
+// available. A nil available skips the capacity comparison.
+func Preflight(source, destination Endpoint, options Options, available *ResourceTotals) (*PreflightReport, error) {
+	if source.Client == nil || source.K8sClient == nil || destination.Client == nil || destination.K8sClient == nil {
+		return nil, fmt.Errorf("source and destination clients are required for preflight")
+	}
+	options.DestinationProvisioner = destination.Provisioner
+	transform, err := resolveOptions(source.Provisioner, &options)
+	if err != nil {
+		return nil, err
+	}
+	gvrs, err := DiscoverResources(source.K8sClient.Discovery(), options.Resources)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := source.K8sClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	p := &preflight{
+		source:      source,
+		destination: destination,
+		options:     options,
+		transform:   transform,
+		gvrs:        gvrs,
+		namespaces:  map[string]map[string]string{},
+		report:      &PreflightReport{Errors: []PreflightFinding{}, Warnings: []PreflightFinding{}, Available: available},
+	}
+	for _, ns := range namespaces.Items {
+		if options.Scope.IncludesNamespace(ns.Name, ns.Annotations) {
+			p.namespaces[ns.Name] = ns.Annotations
+		}
+	}
+
+	checks := []func() error{p.checkAPIVersions, p.checkStorageClasses, p.checkIngressClasses, p.checkCapacity}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return nil, err
+		}
+	}
+	p.report.Passed = len(p.report.Errors) == 0
+	return p.report, nil
+}
+
+func (p *preflight) fail(f PreflightFinding) {
+	p.report.Errors = append(p.report.Errors, f)
+}
+
+func (p *preflight) warn(f PreflightFinding) {
+	p.report.Warnings = append(p.report.Warnings, f)
+}
+
+// replicated reports whether gvr is among the resources the job replicates.
+func (p *preflight) replicated(gvr schema.GroupVersionResource) bool {
+	for _, candidate := range p.gvrs {
+		if candidate == gvr {
+			return true
+		}
+	}
+	return false
+}
+
+// objects lists the in-scope source objects of gvr, prepared as they would be
+// written to the destination.
+func (p *preflight) objects(gvr schema.GroupVersionResource) ([]*unstructured.Unstructured, error) {
+	list, err := p.source.Client.Resource(gvr).List(context.TODO(), metav1.ListOptions{LabelSelector: p.options.Scope.LabelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", gvrKey(gvr), err)
+	}
+	var objects []*unstructured.Unstructured
+	for i := range list.Items {
+		u := &list.Items[i]
+		annotations, ok := p.namespaces[u.GetNamespace()]
+		if !ok || namespaceExcludesResource(annotations, gvr) {
+			continue
+		}
+		keep, err := prepareObject(gvr, u, p.transform, false)
+		if err != nil || !keep {
+			continue
+		}
+		objects = append(objects, u)
+	}
+	return objects, nil
+}
+
+// checkAPIVersions makes sure the destination serves every replicated
+// resource at the version it is read at on the source. A missing CRD is only
+// a warning since replication copies it, but its controller is not.
+func (p *preflight) checkAPIVersions() error {
+	_, lists, err := discovery.ServerGroupsAndResources(p.destination.K8sClient.Discovery())
+	if err != nil {
+		if !discovery.IsGroupDiscoveryFailedError(err) || len(lists) == 0 {
+			return fmt.Errorf("failed to discover destination resources: %w", err)
+		}
+		log.Printf("⚠️ Partial discovery of the destination: %v", err)
+	}
+	served := sets.New[schema.GroupVersionResource]()
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			served.Insert(gv.WithResource(r.Name))
+		}
+	}
+
+	for _, gvr := range p.gvrs {
+		if served.Has(gvr) {
+			continue
+		}
+		name := gvrKey(gvr)
+		if strings.Contains(gvr.Group, ".") {
+			_, err := p.source.Client.Resource(crdGVR).Get(context.TODO(), name, metav1.GetOptions{})
+			if err == nil {
+				p.checkCRD(gvr)
+				continue
+			}
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to read CRD %s from source: %w", name, err)
+			}
+		}
+		objects, err := p.objects(gvr)
+		if err != nil {
+			return err
+		}
+		finding := PreflightFinding{
+			Check:    PreflightAPIVersion,
+			Resource: name,
+			Message:  fmt.Sprintf("the destination does not serve %s/%s", gvr.GroupVersion(), gvr.Resource),
+		}
+		if len(objects) == 0 {
+			finding.Message += "; no object in scope uses it yet"
+			p.warn(finding)
+			continue
+		}
+		finding.Message += fmt.Sprintf(", used by %d objects in scope", len(objects))
+		p.fail(finding)
+	}
+	return nil
+}
+
+// checkCRD reports a custom resource the destination does not serve: either
+// its CRD is missing and will be copied, or it lacks the source version.
+func (p *preflight) checkCRD(gvr schema.GroupVersionResource) {
+	name := gvrKey(gvr)
+	_, err := p.destination.Client.Resource(crdGVR).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		p.warn(PreflightFinding{
+			Check:    PreflightCRD,
+			Resource: name,
+			Message:  "the CRD is missing on the destination and will be copied from the source; its controller must be installed there",
+		})
+		return
+	}
+	message := fmt.Sprintf("the destination CRD does not serve version %s", gvr.Version)
+	if err != nil {
+		message = "cannot read the CRD on the destination: " + err.Error()
+	}
+	p.fail(PreflightFinding{Check: PreflightCRD, Resource: name, Message: message})
+}
+
+// classReference is one object naming a StorageClass or an IngressClass.
+type classReference struct {
+	resource, namespace, name string
+}
+
+// checkStorageClasses looks for the StorageClass of every replicated PVC and
+// StatefulSet volume claim template on the destination.
+func (p *preflight) checkStorageClasses() error {
+	references := map[string][]classReference{}
+	usesDefault := false
+	collect := func(resource, namespace, name string, claim map[string]interface{}) {
+		class, found, _ := unstructured.NestedString(claim, "spec", "storageClassName")
+		switch {
+		case !found:
+			usesDefault = true
+		case class != "":
+			references[class] = append(references[class], classReference{resource, namespace, name})
+		}
+	}
+	if p.replicated(persistentVolumeClaimsGVR) {
+		claims, err := p.objects(persistentVolumeClaimsGVR)
+		if err != nil {
+			return err
+		}
+		for _, u := range claims {
+			collect(gvrKey(persistentVolumeClaimsGVR), u.GetNamespace(), u.GetName(), u.Object)
+		}
+	}
+	if p.replicated(statefulSetsGVR) {
+		statefulSets, err := p.objects(statefulSetsGVR)
+		if err != nil {
+			return err
+		}
+		for _, u := range statefulSets {
+			templates, _, _ := unstructured.NestedSlice(u.Object, "spec", "volumeClaimTemplates")
+			for _, template := range templates {
+				if claim, ok := template.(map[string]interface{}); ok {
+					collect(gvrKey(statefulSetsGVR), u.GetNamespace(), u.GetName(), claim)
+				}
+			}
+		}
+	}
+	if len(references) == 0 && !usesDefault {
+		return nil
+	}
+
+	classes, err := p.destination.K8sClient.StorageV1().StorageClasses().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list destination storage classes: %w", err)
+	}
+	existing := sets.New[string]()
+	hasDefault := false
+	for _, class := range classes.Items {
+		existing.Insert(class.Name)
+		if class.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" {
+			hasDefault = true
+		}
+	}
+	if usesDefault && !hasDefault {
+		p.warn(PreflightFinding{
+			Check:   PreflightStorageClass,
+			Message: "some volume claims use the default StorageClass but the destination has none",
+		})
+	}
+	copied, err := p.copiedClasses(storageClassesGVR, "StorageClass", func() ([]string, error) {
+		list, err := p.source.K8sClient.StorageV1().StorageClasses().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(list.Items))
+		for _, class := range list.Items {
+			names = append(names, class.Name)
+		}
+		return names, nil
+	})
+	if err != nil {
+		return err
+	}
+	p.reportMissingClasses(PreflightStorageClass, "StorageClass", references, existing, copied)
+	return nil
+}
+
+// checkIngressClasses looks for the IngressClass of every replicated Ingress
+// on the destination.
+func (p *preflight) checkIngressClasses() error {
+	if !p.replicated(ingressesGVR) {
+		return nil
+	}
+	ingresses, err := p.objects(ingressesGVR)
+	if err != nil {
+		return err
+	}
+	references := map[string][]classReference{}
+	usesDefault := false
+	for _, u := range ingresses {
+		class, _, _ := unstructured.NestedString(u.Object, "spec", "ingressClassName")
+		if class == "" {
+			class = u.GetAnnotations()["kubernetes.io/ingress.class"]
+		}
+		if class == "" {
+			usesDefault = true
+			continue
+		}
+		references[class] = append(references[class], classReference{gvrKey(ingressesGVR), u.GetNamespace(), u.GetName()})
+	}
+	if len(references) == 0 && !usesDefault {
+		return nil
+	}
+
+	classes, err := p.destination.K8sClient.NetworkingV1().IngressClasses().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list destination ingress classes: %w", err)
+	}
+	existing := sets.New[string]()
+	hasDefault := false
+	for _, class := range classes.Items {
+		existing.Insert(class.Name)
+		if class.Annotations["ingressclass.kubernetes.io/is-default-class"] == "true" {
+			hasDefault = true
+		}
+	}
+	if usesDefault && !hasDefault {
+		p.warn(PreflightFinding{
+			Check:   PreflightIngressClass,
+			Message: "some Ingresses use the default IngressClass but the destination has none",
+		})
+	}
+	copied, err := p.copiedClasses(ingressClassesGVR, "IngressClass", func() ([]string, error) {
+		list, err := p.source.K8sClient.NetworkingV1().IngressClasses().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(list.Items))
+		for _, class := range list.Items {
+			names = append(names, class.Name)
+		}
+		return names, nil
+	})
+	if err != nil {
+		return err
+	}
+	p.reportMissingClasses(PreflightIngressClass, "IngressClass", references, existing, copied)
+	return nil
+}
+
+// copiedClasses returns the classes replication copies from the source,
+// none when the job does not replicate the class resource.
+func (p *preflight) copiedClasses(gvr schema.GroupVersionResource, kind string, list func() ([]string, error)) (sets.Set[string], error) {
+	if !p.options.Resources.matches(gvr, kind) {
+		return sets.New[string](), nil
+	}
+	names, err := list()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source %s: %w", gvrKey(gvr), err)
+	}
+	return sets.New(names...), nil
+}
+
+// reportMissingClasses fails for every referenced class the destination
+// lacks, or warns when replication copies it from the source, since the
+// provisioner or controller behind it must still exist on the destination.
+func (p *preflight) reportMissingClasses(check, kind string, references map[string][]classReference, existing, copied sets.Set[string]) {
+	classes := make([]string, 0, len(references))
+	for class := range references {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		if existing.Has(class) {
+			continue
+		}
+		refs := references[class]
+		first := refs[0]
+		finding := PreflightFinding{
+			Check:     check,
+			Resource:  first.resource,
+			Namespace: first.namespace,
+			Name:      first.name,
+		}
+		usedBy := fmt.Sprintf("used by %s %s/%s", first.resource, first.namespace, first.name)
+		if len(refs) > 1 {
+			usedBy += fmt.Sprintf(" and %d more", len(refs)-1)
+		}
+		if copied.Has(class) {
+			finding.Message = fmt.Sprintf("%s %q, %s, will be copied from the source; what backs it must exist on the destination", kind, class, usedBy)
+			p.warn(finding)
+			continue
+		}
+		finding.Message = fmt.Sprintf("%s %q, %s, does not exist on the destination", kind, class, usedBy)
+		p.fail(finding)
+	}
+}
+
+// checkCapacity sums the requests of the replicated Deployments and
+// StatefulSets at their source replica counts and compares them with what the
+// destination has available. DaemonSets, Jobs and CronJobs are left out: the
+// former scale with the nodes, the latter do not run all the time.
+func (p *preflight) checkCapacity() error {
+	totals := ResourceTotals{CPU: *resource.NewQuantity(0, resource.DecimalSI), Memory: *resource.NewQuantity(0, resource.BinarySI)}
+	for _, gvr := range []schema.GroupVersionResource{deploymentsGVR, statefulSetsGVR} {
+		if !p.replicated(gvr) {
+			continue
+		}
+		workloads, err := p.objects(gvr)
+		if err != nil {
+			return err
+		}
+		for _, u := range workloads {
+			replicas, found, _ := unstructured.NestedInt64(u.Object, "spec", "replicas")
+			if !found {
+				replicas = 1
+			}
+			podSpec, _, _ := unstructured.NestedMap(u.Object, "spec", "template", "spec")
+			cpu, memory := podRequests(podSpec)
+			cpu.Mul(replicas)
+			memory.Mul(replicas)
+			totals.CPU.Add(cpu)
+			totals.Memory.Add(memory)
+		}
+	}
+	p.report.Requests = totals
+	available := p.report.Available
+	if available == nil {
+		return nil
+	}
+	if totals.CPU.Cmp(available.CPU) > 0 {
+		p.fail(PreflightFinding{
+			Check:   PreflightCapacity,
+			Message: fmt.Sprintf("workloads request %s CPU but the destination has %s available", totals.CPU.String(), available.CPU.String()),
+		})
+	}
+	if totals.Memory.Cmp(available.Memory) > 0 {
+		p.fail(PreflightFinding{
+			Check:   PreflightCapacity,
+			Message: fmt.Sprintf("workloads request %s of memory but the destination has %s available", totals.Memory.String(), available.Memory.String()),
+		})
+	}
+	return nil
+}
+
+// AvailableCapacity is the CPU and memory the schedulable nodes of a cluster
+// can still give to new pods: their allocatable resources less the requests of
+// the pods scheduled on them, as the scheduler counts it.
+func AvailableCapacity(client kubernetes.Interface) (*ResourceTotals, error) {
+	nodes, err := client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	available := ResourceTotals{CPU: *resource.NewQuantity(0, resource.DecimalSI), Memory: *resource.NewQuantity(0, resource.BinarySI)}
+	schedulable := sets.New[string]()
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		schedulable.Insert(node.Name)
+		available.CPU.Add(*node.Status.Allocatable.Cpu())
+		available.Memory.Add(*node.Status.Allocatable.Memory())
+	}
+
+	pods, err := client.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !schedulable.Has(pod.Spec.NodeName) {
+			continue
+		}
+		podSpec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pod.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+		cpu, memory := podRequests(podSpec)
+		available.CPU.Sub(cpu)
+		available.Memory.Sub(memory)
+		available.CPU.Sub(*pod.Spec.Overhead.Cpu())
+		available.Memory.Sub(*pod.Spec.Overhead.Memory())
+	}
+	return &available, nil
+}
+
+// podRequests returns the effective CPU and memory requests of one pod: the
+// sum over its containers, or the largest init container if that is more.
+func podRequests(podSpec map[string]interface{}) (resource.Quantity, resource.Quantity) {
+	sum := func(field string, largest bool) (resource.Quantity, resource.Quantity) {
+		cpu := *resource.NewQuantity(0, resource.DecimalSI)
+		memory := *resource.NewQuantity(0, resource.BinarySI)
+		containers, _, _ := unstructured.NestedSlice(podSpec, field)
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			requests, _, _ := unstructured.NestedStringMap(container, "resources", "requests")
+			if q, err := resource.ParseQuantity(requests[string(corev1.ResourceCPU)]); err == nil {
+				if !largest {
+					cpu.Add(q)
+				} else if q.Cmp(cpu) > 0 {
+					cpu = q
+				}
+			}
+			if q, err := resource.ParseQuantity(requests[string(corev1.ResourceMemory)]); err == nil {
+				if !largest {
+					memory.Add(q)
+				} else if q.Cmp(memory) > 0 {
+					memory = q
+				}
+			}
+		}
+		return cpu, memory
+	}
+	cpu, memory := sum("containers", false)
+	initCPU, initMemory := sum("initContainers", true)
+	if initCPU.Cmp(cpu) > 0 {
+		cpu = initCPU
+	}
+	if initMemory.Cmp(memory) > 0 {
+		memory = initMemory
+	}
+	return cpu, memory
+}
@@ -0,0 +1,79 @@
+package DR
+
+// platformDefaults describe what a provisioner's clusters ship with out of the
+// box and what only makes sense on that platform.
+type platformDefaults struct {
+	storageClasses      []string
+	defaultStorageClass string
+	annotations         []string
+}
+
+var platforms = map[string]platformDefaults{
+	"aws": {
+		storageClasses:      []string{"gp2", "gp3", "io1", "io2", "ebs-sc"},
+		defaultStorageClass: "gp3",
+		annotations: []string{
+			"service.beta.kubernetes.io/aws-*",
+			"alb.ingress.kubernetes.io/*",
+			"eks.amazonaws.com/*",
+		},
+	},
+	"azure": {
+		storageClasses:      []string{"default", "managed", "managed-csi", "managed-premium", "managed-csi-premium", "azurefile", "azurefile-csi"},
+		defaultStorageClass: "managed-csi",
+		annotations: []string{
+			"service.beta.kubernetes.io/azure-*",
+			"appgw.ingress.kubernetes.io/*",
+			"azure.workload.identity/*",
+		},
+	},
+	"gcp": {
+		storageClasses:      []string{"standard", "standard-rwo", "premium-rwo"},
+		defaultStorageClass: "standard-rwo",
+		annotations: []string{
+			"cloud.google.com/*",
+			"networking.gke.io/*",
+			"iam.gke.io/*",
+		},
+	},
+	"nutanix": {
+		storageClasses:      []string{"default-storageclass", "nutanix-volume", "nutanix-files"},
+		defaultStorageClass: "default-storageclass",
+		annotations: []string{
+			"nutanix.com/*",
+		},
+	},
+	"vmware": {
+		storageClasses:      []string{"vsphere-sc", "vsan-default-storage-policy", "thin", "thin-csi"},
+		defaultStorageClass: "vsphere-sc",
+		annotations: []string{
+			"vmware-system-*",
+			"nsx.vmware.com/*",
+		},
+	},
+}
+
+// PresetRules returns the built-in transformation for replicating from a
+// cluster of one provisioner to another: the source platform's storage classes
+// map to the destination default and its platform-specific annotations are
+// dropped. Registries and hosts are site specific and have no preset, and
+// neither do provisioners without platform defaults, such as kind: the rules
+// are empty then.
+func PresetRules(sourceProvisioner, destinationProvisioner string) TransformRules {
+	source, ok := platforms[sourceProvisioner]
+	if !ok {
+		return TransformRules{}
+	}
+	destination, ok := platforms[destinationProvisioner]
+	if !ok || sourceProvisioner == destinationProvisioner {
+		return TransformRules{}
+	}
+	rules := TransformRules{
+		StorageClasses:  map[string]string{},
+		DropAnnotations: append([]string{}, source.annotations...),
+	}
+	for _, class := range source.storageClasses {
+		rules.StorageClasses[class] = destination.defaultStorageClass
+	}
+	return rules
+}
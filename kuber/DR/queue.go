@@ -0,0 +1,91 @@
+package DR
+
+import (
+	"sync"
+	"time"
+)
+
+type eventType int
+
+const (
+	eventAdd eventType = iota
+	eventUpdate
+	eventDelete
+)
+
+// syncEvent is one informer notification waiting to be written to the
+// destination.
+type syncEvent struct {
+	kind       eventType
+	obj        interface{}
+	receivedAt time.Time
+}
+
+// eventQueue is an unbounded FIFO between an informer and the worker that
+// writes its events to the destination. The event being processed stays at
+// the head until done is called, so depth and age include it.
+type eventQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []syncEvent
+	closed bool
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *eventQueue) push(e syncEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, e)
+	q.cond.Signal()
+}
+
+// peek blocks until an event is queued and returns it without removing it. It
+// reports false once the queue is closed.
+func (q *eventQueue) peek() (syncEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return syncEvent{}, false
+	}
+	return q.items[0], true
+}
+
+// done removes the event returned by peek.
+func (q *eventQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) > 0 {
+		q.items[0] = syncEvent{}
+		q.items = q.items[1:]
+	}
+}
+
+// close drops every queued event and releases the worker.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.items = nil
+	q.cond.Broadcast()
+}
+
+// depth returns the number of queued events and when the oldest was received.
+func (q *eventQueue) depth() (int, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return 0, time.Time{}
+	}
+	return len(q.items), q.items[0].receivedAt
+}
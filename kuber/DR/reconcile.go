@@ -0,0 +1,199 @@
+package DR
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// DefaultReconcileInterval is used when Options.ReconcileInterval is zero.
+	DefaultReconcileInterval = 10 * time.Minute
+	// MinReconcileInterval keeps a full comparison from running back to back.
+	MinReconcileInterval = 30 * time.Second
+)
+
+// Actions a reconciliation takes on a drifted destination object.
+const (
+	RepairCreate = "create"
+	RepairUpdate = "update"
+	RepairDelete = "delete"
+)
+
+// Repair records one destination object that had drifted from the source and
+// was put back in line by a reconciliation.
+type Repair struct {
+	JobID      string        `json:"job_id"`
+	Resource   string        `json:"resource"`
+	Namespace  string        `json:"namespace,omitempty"`
+	Name       string        `json:"name"`
+	Action     string        `json:"action"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+	RepairedAt time.Time     `json:"repaired_at"`
+}
+
+func validateReconcileInterval(interval time.Duration) error {
+	if interval > 0 && interval < MinReconcileInterval {
+		return fmt.Errorf("reconcile interval %s is shorter than the minimum of %s", interval, MinReconcileInterval)
+	}
+	return nil
+}
+
+func (s *session) reconcilePeriodically() {
+	ticker := time.NewTicker(s.reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.reconcile()
+		}
+	}
+}
+
+// reconcile compares every object held by the session's informers with the
+// destination, re-applies those that drifted or disappeared and deletes the
+// objects the job created whose source no longer exists. It does nothing while
+// the session is paused or after failover, when the destination is
+// authoritative.
+func (s *session) reconcile() {
+	if s.paused.Load() || s.promoted.Load() || s.stopped() {
+		return
+	}
+	s.mu.Lock()
+	watchers := make([]*informerWatch, 0, len(s.watchers))
+	for _, w := range s.watchers {
+		watchers = append(watchers, w)
+	}
+	s.mu.Unlock()
+
+	log.Printf("🔁 Reconciling DR session %s", s.jobID)
+	for _, w := range watchers {
+		if s.stopped() {
+			return
+		}
+		s.reconcileWatch(w)
+	}
+	s.reconcileNamespaces()
+
+	s.mu.Lock()
+	s.lastReconcileTime = time.Now()
+	s.mu.Unlock()
+	s.reportStatus()
+}
+
+func (s *session) reconcileWatch(w *informerWatch) {
+	store := w.informer.GetStore()
+	for _, obj := range store.List() {
+		source, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		entry, ok := planObject(s.destClient, w.gvr, w.namespace, source, s.transform, s.secrets, s.passive(), s.conflictPolicy, s.jobID)
+		if !ok {
+			continue
+		}
+		switch entry.Action {
+		case PlanCreate, PlanUpdate:
+			delta := int64(0)
+			if entry.Action == PlanCreate {
+				delta = 1
+			}
+			if err := s.writeObject(w.gvr, w.namespace, source, delta); err != nil {
+				log.Printf("❌ Repair failed in %s: %v", w.namespace, err)
+				s.recordObjectError(w.gvr, w.namespace, source.GetName(), err)
+				continue
+			}
+			s.recordRepair(Repair{
+				Resource:  entry.Resource,
+				Namespace: entry.Namespace,
+				Name:      entry.Name,
+				Action:    entry.Action,
+				Changes:   entry.Changes,
+			})
+		case PlanError:
+			s.recordObjectError(w.gvr, entry.Namespace, entry.Name, fmt.Errorf("reconcile: %s", entry.Error))
+		}
+	}
+
+	list, err := s.destClient.Resource(w.gvr).Namespace(w.namespace).List(context.TODO(), s.ownedListOptions())
+	if err != nil {
+		log.Printf("❌ Failed to list %s on destination: %v", gvrKey(w.gvr), err)
+		s.recordError(err)
+		return
+	}
+	for i := range list.Items {
+		u := &list.Items[i]
+		key, err := cache.MetaNamespaceKeyFunc(u)
+		if err != nil {
+			continue
+		}
+		if _, exists, _ := store.GetByKey(key); exists {
+			continue
+		}
+		err = s.destClient.Resource(w.gvr).Namespace(w.namespace).Delete(context.TODO(), u.GetName(), metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("❌ Failed to delete orphaned %s %s: %v", gvrKey(w.gvr), u.GetName(), err)
+			s.recordObjectError(w.gvr, w.namespace, u.GetName(), err)
+			continue
+		}
+		s.recordSync(w.gvr, -1)
+		s.forgetObject(w.gvr, w.namespace, u.GetName())
+		s.recordRepair(Repair{
+			Resource:  gvrKey(w.gvr),
+			Namespace: w.namespace,
+			Name:      u.GetName(),
+			Action:    RepairDelete,
+		})
+	}
+}
+
+// reconcileNamespaces deletes the in-scope namespaces this job created on the
+// destination whose source namespace is gone.
+func (s *session) reconcileNamespaces() {
+	destination, err := s.destClient.Resource(namespaceGVR).List(context.TODO(), s.ownedListOptions())
+	if err != nil {
+		log.Printf("❌ Failed to list namespaces on destination: %v", err)
+		s.recordError(err)
+		return
+	}
+	for i := range destination.Items {
+		ns := &destination.Items[i]
+		if !s.scope.IncludesNamespace(ns.GetName(), ns.GetAnnotations()) {
+			continue
+		}
+		_, err := s.sourceK8sClient.CoreV1().Namespaces().Get(context.TODO(), ns.GetName(), metav1.GetOptions{})
+		if !apierrors.IsNotFound(err) {
+			continue
+		}
+		s.deleteNamespace(ns.GetName())
+		s.recordRepair(Repair{
+			Resource: gvrKey(namespaceGVR),
+			Name:     ns.GetName(),
+			Action:   RepairDelete,
+		})
+	}
+}
+
+// ownedListOptions selects the destination objects this job wrote, so that
+// reconciliation never deletes objects created on the destination directly or
+// by another DR job or snapshot restore.
+func (s *session) ownedListOptions() metav1.ListOptions {
+	return metav1.ListOptions{LabelSelector: JobLabel + "=" + s.jobID}
+}
+
+func (s *session) recordRepair(r Repair) {
+	r.JobID = s.jobID
+	r.RepairedAt = time.Now()
+	log.Printf("🩹 Repaired drift: %s %s", r.Action, objectKey(r.Resource, r.Namespace, r.Name))
+	if s.audit != nil {
+		s.audit(r)
+	}
+}
@@ -0,0 +1,88 @@
+package DR
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ExcludeAnnotation set to "true" on a namespace or on any object keeps it
+	// out of DR replication.
+	ExcludeAnnotation = "dr.kuber.io/exclude"
+
+	// ExcludeResourcesAnnotation on a namespace lists the resource kinds, as
+	// "resource" or "resource.group", that are not replicated from it,
+	// e.g. "secrets,ingresses.networking.k8s.io".
+	ExcludeResourcesAnnotation = "dr.kuber.io/exclude-resources"
+)
+
+// DefaultExcludedNamespaces hold cluster components that are never copied to a
+// DR target, whatever the scope says.
+var DefaultExcludedNamespaces = []string{"kube-system", "kube-public", "kube-node-lease", "local-path-storage"}
+
+// Scope limits which namespaces and objects a DR session replicates.
+// Namespace patterns use path.Match globs such as "team-*".
+type Scope struct {
+	IncludeNamespaces []string `json:"include_namespaces"`
+	ExcludeNamespaces []string `json:"exclude_namespaces"`
+	LabelSelector     string   `json:"label_selector"`
+}
+
+// Validate checks the glob patterns and the label selector.
+func (sc Scope) Validate() error {
+	for _, pattern := range append(append([]string{}, sc.IncludeNamespaces...), sc.ExcludeNamespaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern %q: %w", pattern, err)
+		}
+	}
+	if _, err := labels.Parse(sc.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label selector %q: %w", sc.LabelSelector, err)
+	}
+	return nil
+}
+
+// IncludesNamespace reports whether a namespace with the given annotations is
+// in scope.
+func (sc Scope) IncludesNamespace(namespace string, annotations map[string]string) bool {
+	if annotations[ExcludeAnnotation] == "true" {
+		return false
+	}
+	if matchesAny(namespace, DefaultExcludedNamespaces) || matchesAny(namespace, sc.ExcludeNamespaces) {
+		return false
+	}
+	return len(sc.IncludeNamespaces) == 0 || matchesAny(namespace, sc.IncludeNamespaces)
+}
+
+// namespaceExcludesResource reports whether the namespace annotations opt the
+// given resource kind out of replication.
+func namespaceExcludesResource(annotations map[string]string, gvr schema.GroupVersionResource) bool {
+	for _, kind := range strings.Split(annotations[ExcludeResourcesAnnotation], ",") {
+		kind = strings.TrimSpace(kind)
+		if kind != "" && (kind == gvrKey(gvr) || kind == gvr.Resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// objectExcluded reports whether an object is kept out of replication: it
+// opted out, or a controller owns it, e.g. the Job of a CronJob, and the
+// destination's copy of that controller recreates it.
+func objectExcluded(u *unstructured.Unstructured) bool {
+	return u.GetAnnotations()[ExcludeAnnotation] == "true" || metav1.GetControllerOf(u) != nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,417 @@
+package DR
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Secret modes: how the Secrets that are replicated reach the destination.
+const (
+	// SecretCopy writes Secrets as they are on the source, the default.
+	SecretCopy = "copy"
+	// SecretSeal writes a Bitnami SealedSecret instead, encrypted with the
+	// certificate of the destination's sealed-secrets controller, so the
+	// values only exist in clear on the two clusters.
+	SecretSeal = "seal"
+)
+
+// Actions recorded in a SecretTransfer.
+const (
+	SecretCopied  = "copied"
+	SecretSealed  = "sealed"
+	SecretSkipped = "skipped"
+	SecretDeleted = "deleted"
+)
+
+// DefaultSealingController is the namespace and name of the sealed-secrets
+// controller service the sealing certificate is fetched from.
+const DefaultSealingController = "kube-system/sealed-secrets-controller"
+
+// SealedVersionAnnotation records on a SealedSecret the resource version of the
+// source Secret it was sealed from, since the sealed values cannot be compared.
+const SealedVersionAnnotation = "dr.kuber.io/source-resource-version"
+
+var (
+	secretsGVR       = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}
+	sealedSecretsGVR = schema.GroupVersionResource{Group: "bitnami.com", Version: "v1alpha1", Resource: "sealedsecrets"}
+)
+
+// SecretPolicy controls how Secrets are replicated.
+type SecretPolicy struct {
+	// Mode is SecretCopy, the default, or SecretSeal.
+	Mode string `json:"mode,omitempty"`
+	// SkipTypes are Secret types that are never replicated, e.g.
+	// "kubernetes.io/service-account-token" or "helm.sh/release.v1".
+	SkipTypes []string `json:"skip_types,omitempty"`
+	// SealingCertificate is the PEM certificate Secrets are sealed with. When
+	// empty it is fetched from SealingController on the destination.
+	SealingCertificate string `json:"sealing_certificate,omitempty"`
+	// SealingController is the "namespace/name" of the sealed-secrets
+	// controller service, DefaultSealingController when empty.
+	SealingController string `json:"sealing_controller,omitempty"`
+}
+
+// Validate checks the mode, the skipped types and the sealing settings.
+func (p SecretPolicy) Validate() error {
+	switch p.Mode {
+	case "", SecretCopy, SecretSeal:
+	default:
+		return fmt.Errorf("invalid secret mode %q: must be %s or %s", p.Mode, SecretCopy, SecretSeal)
+	}
+	for _, secretType := range p.SkipTypes {
+		if strings.TrimSpace(secretType) == "" {
+			return errors.New("skipped secret types cannot be empty")
+		}
+	}
+	if p.SealingController != "" {
+		if namespace, name, ok := strings.Cut(p.SealingController, "/"); !ok || namespace == "" || name == "" {
+			return fmt.Errorf("invalid sealing controller %q: must be namespace/name", p.SealingController)
+		}
+	}
+	if p.SealingCertificate != "" {
+		if _, err := parseSealingCertificate([]byte(p.SealingCertificate)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SecretTransfer records what replication did with one Secret on the
+// destination.
+type SecretTransfer struct {
+	JobID         string `json:"job_id"`
+	DestinationID string `json:"destination_id,omitempty"`
+	Namespace     string `json:"namespace"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Action        string `json:"action"`
+	// OverriddenKeys are the data keys whose values came from the overrides
+	// store instead of the source.
+	OverriddenKeys []string `json:"overridden_keys,omitempty"`
+	// Reverse is set during a failback, when the Secret was written to the
+	// original source.
+	Reverse       bool      `json:"reverse,omitempty"`
+	TransferredAt time.Time `json:"transferred_at"`
+}
+
+// secretHandler applies the secret policy of a session to the Secrets it
+// writes.
+type secretHandler struct {
+	seal bool
+	skip map[string]bool
+	// sealingKey is nil when only planning, which never seals anything.
+	sealingKey *rsa.PublicKey
+	overrides  func(namespace, name string) (map[string][]byte, error)
+}
+
+// newSecretHandler builds the handler for options. With destination set and
+// sealing on, the sealing certificate is fetched from the destination unless
+// the policy carries one.
+func newSecretHandler(options Options, destination *kubernetes.Clientset) (*secretHandler, error) {
+	policy := options.Secrets
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	h := &secretHandler{
+		seal:      policy.Mode == SecretSeal,
+		skip:      map[string]bool{},
+		overrides: options.SecretOverrides,
+	}
+	for _, secretType := range policy.SkipTypes {
+		h.skip[secretType] = true
+	}
+	if !h.seal {
+		return h, nil
+	}
+	certificate := []byte(policy.SealingCertificate)
+	if len(certificate) == 0 {
+		if destination == nil {
+			return h, nil
+		}
+		controller := policy.SealingController
+		if controller == "" {
+			controller = DefaultSealingController
+		}
+		fetched, err := fetchSealingCertificate(destination, controller)
+		if err != nil {
+			return nil, err
+		}
+		certificate = fetched
+	}
+	key, err := parseSealingCertificate(certificate)
+	if err != nil {
+		return nil, err
+	}
+	h.sealingKey = key
+	return h, nil
+}
+
+// fetchSealingCertificate asks the sealed-secrets controller of a cluster for
+// its current certificate, like kubeseal --fetch-cert does.
+func fetchSealingCertificate(client *kubernetes.Clientset, controller string) ([]byte, error) {
+	namespace, name, _ := strings.Cut(controller, "/")
+	service, err := client.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find sealed-secrets controller %s: %w", controller, err)
+	}
+	if len(service.Spec.Ports) == 0 {
+		return nil, fmt.Errorf("sealed-secrets controller %s exposes no port", controller)
+	}
+	port := service.Spec.Ports[0].Name
+	if port == "" {
+		port = strconv.Itoa(int(service.Spec.Ports[0].Port))
+	}
+	certificate, err := client.CoreV1().Services(namespace).ProxyGet("http", name, port, "/v1/cert.pem", nil).DoRaw(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch the sealing certificate from %s: %w", controller, err)
+	}
+	return certificate, nil
+}
+
+func parseSealingCertificate(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("sealing certificate is not PEM encoded")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealing certificate: %w", err)
+	}
+	key, ok := certificate.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("sealing certificate does not hold an RSA key")
+	}
+	return key, nil
+}
+
+func isSecret(gvr schema.GroupVersionResource) bool {
+	return gvr == secretsGVR
+}
+
+func secretType(u *unstructured.Unstructured) string {
+	secretType, _, _ := unstructured.NestedString(u.Object, "type")
+	if secretType == "" {
+		return "Opaque"
+	}
+	return secretType
+}
+
+// skips reports whether the Secret has a type the policy does not replicate.
+func (h *secretHandler) skips(u *unstructured.Unstructured) bool {
+	return h.skip[secretType(u)]
+}
+
+// override replaces the values of a prepared Secret with those of the
+// overrides store and returns the keys it replaced.
+func (h *secretHandler) override(u *unstructured.Unstructured) ([]string, error) {
+	if h.overrides == nil {
+		return nil, nil
+	}
+	values, err := h.overrides(u.GetNamespace(), u.GetName())
+	if err != nil {
+		return nil, fmt.Errorf("cannot load secret overrides: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	data, _, _ := unstructured.NestedMap(u.Object, "data")
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		data[key] = base64.StdEncoding.EncodeToString(value)
+		unstructured.RemoveNestedField(u.Object, "stringData", key)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if err := unstructured.SetNestedMap(u.Object, data, "data"); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// prepare applies the policy to a Secret that is about to be written and
+// returns the resource and object to write, nil when the Secret is skipped,
+// together with the transfer to audit.
+func (h *secretHandler) prepare(u *unstructured.Unstructured, sourceVersion string) (schema.GroupVersionResource, *unstructured.Unstructured, SecretTransfer, error) {
+	transfer := SecretTransfer{Namespace: u.GetNamespace(), Name: u.GetName(), Type: secretType(u)}
+	if h.skips(u) {
+		transfer.Action = SecretSkipped
+		return secretsGVR, nil, transfer, nil
+	}
+	keys, err := h.override(u)
+	if err != nil {
+		return secretsGVR, nil, transfer, err
+	}
+	transfer.OverriddenKeys = keys
+	if !h.seal {
+		transfer.Action = SecretCopied
+		return secretsGVR, u, transfer, nil
+	}
+	sealed, err := h.sealSecret(u, sourceVersion)
+	if err != nil {
+		return secretsGVR, nil, transfer, err
+	}
+	transfer.Action = SecretSealed
+	return sealedSecretsGVR, sealed, transfer, nil
+}
+
+// sealSecret turns a prepared Secret into a strict-scoped SealedSecret the
+// destination's controller decrypts back into the same Secret.
+func (h *secretHandler) sealSecret(u *unstructured.Unstructured, sourceVersion string) (*unstructured.Unstructured, error) {
+	if h.sealingKey == nil {
+		return nil, errors.New("no sealing certificate")
+	}
+	plaintext := map[string][]byte{}
+	data, _, _ := unstructured.NestedMap(u.Object, "data")
+	for key, value := range data {
+		encoded, _ := value.(string)
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of key %s: %w", key, err)
+		}
+		plaintext[key] = decoded
+	}
+	stringData, _, _ := unstructured.NestedStringMap(u.Object, "stringData")
+	for key, value := range stringData {
+		plaintext[key] = []byte(value)
+	}
+	label := []byte(u.GetNamespace() + "/" + u.GetName())
+	encrypted := map[string]interface{}{}
+	for key, value := range plaintext {
+		ciphertext, err := hybridEncrypt(rand.Reader, h.sealingKey, value, label)
+		if err != nil {
+			return nil, fmt.Errorf("cannot seal key %s: %w", key, err)
+		}
+		encrypted[key] = base64.StdEncoding.EncodeToString(ciphertext)
+	}
+
+	annotations := map[string]string{SealedVersionAnnotation: sourceVersion}
+	sealed := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "bitnami.com/v1alpha1",
+		"kind":       "SealedSecret",
+		"spec": map[string]interface{}{
+			"encryptedData": encrypted,
+			"template": map[string]interface{}{
+				"type": secretType(u),
+			},
+		},
+	}}
+	sealed.SetName(u.GetName())
+	sealed.SetNamespace(u.GetNamespace())
+	sealed.SetLabels(u.GetLabels())
+	sealed.SetAnnotations(annotations)
+	template := map[string]interface{}{}
+	if labels := u.GetLabels(); len(labels) > 0 {
+		template["labels"] = toInterfaceMap(labels)
+	}
+	if secretAnnotations := u.GetAnnotations(); len(secretAnnotations) > 0 {
+		template["annotations"] = toInterfaceMap(secretAnnotations)
+	}
+	if len(template) > 0 {
+		if err := unstructured.SetNestedMap(sealed.Object, template, "spec", "template", "metadata"); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// hybridEncrypt is the encryption of sealed-secrets: a random AES-256-GCM
+// session key, itself encrypted with RSA-OAEP under label, prefixed with its
+// length, followed by the AES ciphertext.
+func hybridEncrypt(rnd io.Reader, key *rsa.PublicKey, plaintext, label []byte) ([]byte, error) {
+	sessionKey := make([]byte, 32)
+	if _, err := io.ReadFull(rnd, sessionKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rnd, key, sessionKey, label)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, 2, 2+len(encryptedKey)+len(plaintext)+aead.Overhead())
+	binary.BigEndian.PutUint16(ciphertext, uint16(len(encryptedKey)))
+	ciphertext = append(ciphertext, encryptedKey...)
+	// The session key is used once, so a zero nonce is safe.
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Seal(ciphertext, nonce, plaintext, nil), nil
+}
+
+// planSealedSecret compares a Secret that would be sealed with the
+// SealedSecret on the destination. Sealed values cannot be compared, so a
+// SealedSecret is up to date when it was sealed from the current version of
+// the source Secret.
+func planSealedSecret(destClient dynamic.Interface, entry PlanEntry, sourceVersion string) PlanEntry {
+	current, err := destClient.Resource(sealedSecretsGVR).Namespace(entry.Namespace).Get(context.TODO(), entry.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		entry.Action = PlanCreate
+	case err != nil:
+		entry.Action, entry.Error = PlanError, err.Error()
+	case current.GetAnnotations()[SealedVersionAnnotation] == sourceVersion:
+		entry.Action = PlanUnchanged
+	default:
+		entry.Action = PlanUpdate
+	}
+	return entry
+}
+
+// deleteTarget returns the resource a deleted source Secret is removed from on
+// the destination, and false when the Secret was never replicated.
+func (h *secretHandler) deleteTarget(u *unstructured.Unstructured) (schema.GroupVersionResource, bool) {
+	if h.skips(u) {
+		return secretsGVR, false
+	}
+	if h.seal {
+		return sealedSecretsGVR, true
+	}
+	return secretsGVR, true
+}
+
+func (s *session) recordSecretTransfer(t SecretTransfer) {
+	t.JobID = s.jobID
+	t.DestinationID = s.destinationID
+	t.Reverse = s.reverse
+	t.TransferredAt = time.Now()
+	if s.secretAudit != nil {
+		s.secretAudit(t)
+	}
+}
@@ -0,0 +1,673 @@
+package DR
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// States a DR job moves through while it is replicating.
+const (
+	StatePending    = "Pending"
+	StateSeeding    = "Seeding"
+	StateRunning    = "Running"
+	StatePaused     = "Paused"
+	StateStopped    = "Stopped"
+	StateFailedOver = "FailedOver"
+	// StateFailingBack covers a failback, from the start of the reverse
+	// replication until forward replication runs again.
+	StateFailingBack = "FailingBack"
+	StateFailed      = "Failed"
+)
+
+// statusReportInterval is how often a running session reports its progress.
+const statusReportInterval = 10 * time.Second
+
+var ErrSessionNotFound = errors.New("DR session is not running on this server")
+
+// Status is a snapshot of a DR session's progress, handed to the caller's
+// report function so it can be persisted.
+type Status struct {
+	JobID string
+	// DestinationID names the destination of a fan-out job the status is
+	// about; it is empty for a job with a single destination.
+	DestinationID string
+	State         string
+	// LastSyncTime is the last successful write to the destination and
+	// LastSourceEventTime the last change seen on the source.
+	LastSyncTime        time.Time
+	LastSourceEventTime time.Time
+	// ReplicationLag is the age of the oldest source event not yet written to
+	// the destination, zero when nothing is pending. It bounds the RPO.
+	ReplicationLag time.Duration
+	// QueueDepth counts the pending source events per resource.
+	QueueDepth   map[string]int
+	ObjectCounts map[string]int64
+	// ErrorCounts counts failures per resource; errors not tied to an object
+	// are counted under SessionErrorKey.
+	ErrorCounts map[string]int64
+	LastError   string
+	Conflicts   []Conflict
+	// LastReconcileTime is when the last full reconciliation finished.
+	LastReconcileTime time.Time
+	// FailoverReplicas are the replica counts failover restored on the
+	// destination, keyed like ObjectStatus; failback restores them on the
+	// original source. Empty until the session fails over.
+	FailoverReplicas map[string]int32
+}
+
+// SessionErrorKey is the Status.ErrorCounts key of errors not tied to an object.
+const SessionErrorKey = "session"
+
+// Sync states of a replicated object.
+const (
+	ObjectSynced   = "synced"
+	ObjectFailed   = "failed"
+	ObjectConflict = "conflict"
+)
+
+// ObjectStatus is the replication state of one source object.
+type ObjectStatus struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	// LastSyncTime is the last successful write of the object, zero if it
+	// never reached the destination.
+	LastSyncTime time.Time `json:"last_sync_time"`
+	LastError    string    `json:"last_error,omitempty"`
+	// Failures counts the failed attempts since the last successful write.
+	Failures  int       `json:"failures"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HealthCheck controls how the source API server is probed in active-passive mode.
+type HealthCheck struct {
+	Interval         time.Duration
+	FailureThreshold int
+}
+
+// Options are the tunables of one DR session beyond its clients.
+type Options struct {
+	HealthCheck HealthCheck
+	Scope       Scope
+	Resources   ResourceFilter
+	// ConflictPolicy is one of ConflictForce, ConflictSkip or ConflictReport,
+	// the default.
+	ConflictPolicy string
+	// DestinationProvisioner selects, together with the source provisioner,
+	// the preset that Transform is layered on.
+	DestinationProvisioner string
+	Transform              TransformRules
+	// ReconcileInterval is how often the destination is compared with the
+	// source and repaired. Zero means DefaultReconcileInterval and a negative
+	// value turns reconciliation off.
+	ReconcileInterval time.Duration
+	// Audit, if set, is called with every repair a reconciliation makes.
+	Audit   func(Repair)
+	Secrets SecretPolicy
+	// SecretOverrides, if set, returns the values that replace those of a
+	// Secret on the destination, by data key.
+	SecretOverrides func(namespace, name string) (map[string][]byte, error)
+	// SecretAudit, if set, is called with every Secret replication writes,
+	// seals, skips or deletes on the destination.
+	SecretAudit func(SecretTransfer)
+}
+
+// session holds the state shared by every informer of one DR replication.
+type session struct {
+	sourceClient    dynamic.Interface
+	destClient      dynamic.Interface
+	sourceK8sClient *kubernetes.Clientset
+	destK8sClient   *kubernetes.Clientset
+	drType          string
+	scope           Scope
+	resources       ResourceFilter
+	gvrs            []schema.GroupVersionResource
+	conflictPolicy  string
+	transform       TransformRules
+	healthCheck     HealthCheck
+	// reverse marks the session of a failback, which replicates from the
+	// promoted destination to the original source and never fails over.
+	reverse  bool
+	promoted atomic.Bool
+	paused   atomic.Bool
+
+	jobID string
+	// destinationID is set on the sessions of a fan-out job, one per
+	// destination, which share hub.
+	destinationID     string
+	hub               *informerHub
+	report            func(Status)
+	audit             func(Repair)
+	secrets           *secretHandler
+	secretAudit       func(SecretTransfer)
+	reconcileInterval time.Duration
+
+	// stop is closed to tear down the namespace watcher, every informer and
+	// the health monitor of this session.
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu           sync.Mutex
+	state        string
+	lastSyncTime time.Time
+	objectCounts map[string]int64
+	lastError    string
+	errorCounts  map[string]int64
+	conflicts    map[string]Conflict
+	objects      map[string]*ObjectStatus
+	// lastSourceEventTime is when an informer last delivered a source change.
+	lastSourceEventTime time.Time
+	watchers            map[string]*informerWatch
+	// lastReconcileTime is when the last full reconciliation finished.
+	lastReconcileTime time.Time
+	// seeded maps the objects written by the initial seed to the resource
+	// version they were seeded at, until their informer reports them.
+	seeded map[string]string
+	// failoverReplicas are the replica counts restored by failover.
+	failoverReplicas map[string]int32
+	// held are the objects a drill is exercising on the destination, whose
+	// writes are suspended until it ends.
+	held map[string]bool
+}
+
+// informerWatch is one running informer of a session, kept so its cache can be
+// replayed when the session resumes and so it can be stopped on its own when
+// its namespace leaves the scope. Its events are written to the destination
+// from queue by a single worker, in order.
+type informerWatch struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	informer  cache.SharedIndexInformer
+	queue     *eventQueue
+	stop      chan struct{}
+	// synced reports whether the session's handler has received the initial
+	// contents of the shared informer; nil until the handler is added.
+	synced func() bool
+}
+
+func (w *informerWatch) close() {
+	close(w.stop)
+	w.queue.close()
+}
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[string]*session{}
+)
+
+// sessionKey identifies a session in the registry: the job ID, followed by
+// the destination ID for the sessions of a fan-out job.
+func sessionKey(jobID, destinationID string) string {
+	if destinationID == "" {
+		return jobID
+	}
+	return jobID + "/" + destinationID
+}
+
+func registerSession(s *session) error {
+	return replaceSession(nil, s)
+}
+
+// replaceSession registers s in place of old in one step, so the job always
+// has a session. A nil old registers s only if no session holds its key.
+func replaceSession(old, s *session) error {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	key := sessionKey(s.jobID, s.destinationID)
+	if current, ok := sessions[key]; ok && current != old {
+		return errors.New("DR session " + key + " is already running")
+	}
+	sessions[key] = s
+	return nil
+}
+
+func unregisterSession(s *session) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	key := sessionKey(s.jobID, s.destinationID)
+	if sessions[key] == s {
+		delete(sessions, key)
+	}
+}
+
+func lookupSession(jobID string) (*session, error) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[jobID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+// jobSessions returns every running session of a job: one, or one per
+// destination of a fan-out job.
+func jobSessions(jobID string) ([]*session, error) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	var found []*session
+	for _, s := range sessions {
+		if s.jobID == jobID {
+			found = append(found, s)
+		}
+	}
+	if len(found) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].destinationID < found[j].destinationID })
+	return found, nil
+}
+
+// isFanOut reports whether the job runs on this server with several
+// destinations.
+func isFanOut(jobID string) bool {
+	found, err := jobSessions(jobID)
+	return err == nil && found[0].destinationID != ""
+}
+
+// StopSession tears down every watcher of a running DR job, on all of its
+// destinations.
+func StopSession(jobID string) error {
+	found, err := jobSessions(jobID)
+	if err != nil {
+		return err
+	}
+	for _, s := range found {
+		unregisterSession(s)
+		s.shutdown()
+		s.setState(StateStopped)
+	}
+	log.Printf("⏹️ DR session %s stopped", jobID)
+	return nil
+}
+
+// PauseSession keeps the informers of a DR job running but suspends every
+// write to its destinations.
+func PauseSession(jobID string) error {
+	found, err := jobSessions(jobID)
+	if err != nil {
+		return err
+	}
+	paused := 0
+	for _, s := range found {
+		if s.paused.CompareAndSwap(false, true) {
+			s.setState(StatePaused)
+			paused++
+		}
+	}
+	if paused == 0 {
+		return errors.New("DR session " + jobID + " is already paused")
+	}
+	log.Printf("⏸️ DR session %s paused", jobID)
+	return nil
+}
+
+// ResumeSession re-enables writes and resynchronizes the destinations in the
+// background so changes made while paused reach them. A session that failed
+// over while paused goes back to FailedOver and stays read-only.
+func ResumeSession(jobID string) error {
+	found, err := jobSessions(jobID)
+	if err != nil {
+		return err
+	}
+	resumed := 0
+	for _, s := range found {
+		if !s.paused.CompareAndSwap(true, false) {
+			continue
+		}
+		resumed++
+		if s.promoted.Load() {
+			s.setState(StateFailedOver)
+			continue
+		}
+		s.setState(StateRunning)
+		go s.resync()
+	}
+	if resumed == 0 {
+		return errors.New("DR session " + jobID + " is not paused")
+	}
+	log.Printf("▶️ DR session %s resumed", jobID)
+	return nil
+}
+
+// SessionStatus returns the live status of a running DR job with a single
+// destination.
+func SessionStatus(jobID string) (Status, error) {
+	s, err := lookupSession(jobID)
+	if err != nil {
+		return Status{}, err
+	}
+	return s.status(), nil
+}
+
+// DestinationStatuses returns the live status of every destination of a
+// running fan-out DR job.
+func DestinationStatuses(jobID string) ([]Status, error) {
+	found, err := jobSessions(jobID)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(found))
+	for _, s := range found {
+		statuses = append(statuses, s.status())
+	}
+	return statuses, nil
+}
+
+// SessionObjects lists the sync status of every object a running DR session
+// has tried to write, optionally only those in the given state. destinationID
+// picks the destination of a fan-out job and is empty otherwise.
+func SessionObjects(jobID, destinationID string, state string) ([]ObjectStatus, error) {
+	s, err := lookupSession(sessionKey(jobID, destinationID))
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	objects := make([]ObjectStatus, 0, len(s.objects))
+	for _, status := range s.objects {
+		if state == "" || status.State == state {
+			objects = append(objects, *status)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(objects, func(i, j int) bool {
+		return objectKey(objects[i].Resource, objects[i].Namespace, objects[i].Name) <
+			objectKey(objects[j].Resource, objects[j].Namespace, objects[j].Name)
+	})
+	return objects, nil
+}
+
+func (s *session) shutdown() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for key, w := range s.watchers {
+			w.close()
+			delete(s.watchers, key)
+		}
+	})
+}
+
+func (s *session) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// resync brings the destination up to date after a pause. Namespaces created
+// while paused are created first, since their informers were started without
+// them, and everything is then reconciled, which also carries over deletions.
+// A promoted destination is no longer written to.
+func (s *session) resync() {
+	if s.promoted.Load() {
+		return
+	}
+	s.ensureNamespaces()
+	s.reconcile()
+}
+
+// trackWatch records an informer for gvr in namespace and reports false when
+// one is already running or the session has been stopped.
+func (s *session) trackWatch(w *informerWatch) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := w.namespace + "/" + gvrKey(w.gvr)
+	if _, ok := s.watchers[key]; ok || s.stopped() {
+		return false
+	}
+	s.watchers[key] = w
+	return true
+}
+
+// stopWatch stops the informer for gvr in namespace, if one is running.
+func (s *session) stopWatch(namespace string, gvr schema.GroupVersionResource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := namespace + "/" + gvrKey(gvr)
+	if w, ok := s.watchers[key]; ok {
+		w.close()
+		delete(s.watchers, key)
+	}
+}
+
+// stopNamespaceWatches stops every informer running for namespace.
+func (s *session) stopNamespaceWatches(namespace string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, w := range s.watchers {
+		if w.namespace == namespace {
+			w.close()
+			delete(s.watchers, key)
+		}
+	}
+}
+
+// holdObject suspends writes of one object to the destination.
+func (s *session) holdObject(gvr schema.GroupVersionResource, namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held[objectKey(gvrKey(gvr), namespace, name)] = true
+}
+
+// releaseObject lifts a hold and re-applies the object's current source state.
+func (s *session) releaseObject(gvr schema.GroupVersionResource, namespace, name string) {
+	s.mu.Lock()
+	delete(s.held, objectKey(gvrKey(gvr), namespace, name))
+	w := s.watchers[namespace+"/"+gvrKey(gvr)]
+	s.mu.Unlock()
+	if w == nil {
+		return
+	}
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	if obj, exists, _ := w.informer.GetStore().GetByKey(key); exists {
+		s.syncObject(gvr, namespace, obj)
+	}
+}
+
+func (s *session) isHeld(gvr schema.GroupVersionResource, namespace, name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.held[objectKey(gvrKey(gvr), namespace, name)]
+}
+
+func (s *session) recordSync(gvr schema.GroupVersionResource, delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objectCounts[gvrKey(gvr)] += delta
+	s.lastSyncTime = time.Now()
+}
+
+// recordApplied marks an object as written to the destination and adds delta
+// to the object count of its resource.
+func (s *session) recordApplied(gvr schema.GroupVersionResource, namespace, name string, delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.objectCounts[gvrKey(gvr)] += delta
+	s.lastSyncTime = now
+	key := objectKey(gvrKey(gvr), namespace, name)
+	delete(s.conflicts, key)
+	s.objects[key] = &ObjectStatus{
+		Resource:     gvrKey(gvr),
+		Namespace:    namespace,
+		Name:         name,
+		State:        ObjectSynced,
+		LastSyncTime: now,
+		UpdatedAt:    now,
+	}
+}
+
+// forgetObject drops the sync status of an object deleted from the destination.
+func (s *session) forgetObject(gvr schema.GroupVersionResource, namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, objectKey(gvrKey(gvr), namespace, name))
+}
+
+func (s *session) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+	s.errorCounts[SessionErrorKey]++
+}
+
+// recordObjectError records a failed write of one object.
+func (s *session) recordObjectError(gvr schema.GroupVersionResource, namespace, name string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+	s.errorCounts[gvrKey(gvr)]++
+	status := s.objectStatus(gvr, namespace, name)
+	status.State = ObjectFailed
+	status.LastError = err.Error()
+	status.Failures++
+}
+
+// recordConflict keeps the latest conflict per object. Under ConflictSkip the
+// object is skipped without being reported.
+func (s *session) recordConflict(gvr schema.GroupVersionResource, c *Conflict) {
+	if s.conflictPolicy == ConflictSkip {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conflicts[objectKey(c.Resource, c.Namespace, c.Name)] = *c
+	status := s.objectStatus(gvr, c.Namespace, c.Name)
+	status.State = ObjectConflict
+	status.LastError = c.Message
+}
+
+// objectStatus returns the status entry of an object, creating it if needed.
+// The caller holds s.mu.
+func (s *session) objectStatus(gvr schema.GroupVersionResource, namespace, name string) *ObjectStatus {
+	key := objectKey(gvrKey(gvr), namespace, name)
+	status, ok := s.objects[key]
+	if !ok {
+		status = &ObjectStatus{Resource: gvrKey(gvr), Namespace: namespace, Name: name}
+		s.objects[key] = status
+	}
+	status.UpdatedAt = time.Now()
+	return status
+}
+
+func (s *session) recordSourceEvent() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSourceEventTime = time.Now()
+}
+
+func objectKey(resource, namespace, name string) string {
+	return resource + "/" + namespace + "/" + name
+}
+
+func (s *session) setState(state string) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+	s.reportStatus()
+}
+
+func (s *session) status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int64, len(s.objectCounts))
+	for k, v := range s.objectCounts {
+		counts[k] = v
+	}
+	errorCounts := make(map[string]int64, len(s.errorCounts))
+	for k, v := range s.errorCounts {
+		errorCounts[k] = v
+	}
+	conflicts := make([]Conflict, 0, len(s.conflicts))
+	for _, c := range s.conflicts {
+		conflicts = append(conflicts, c)
+	}
+	queueDepth := map[string]int{}
+	var oldest time.Time
+	for _, w := range s.watchers {
+		depth, receivedAt := w.queue.depth()
+		if depth == 0 {
+			continue
+		}
+		queueDepth[gvrKey(w.gvr)] += depth
+		if oldest.IsZero() || receivedAt.Before(oldest) {
+			oldest = receivedAt
+		}
+	}
+	var lag time.Duration
+	if !oldest.IsZero() {
+		lag = time.Since(oldest)
+	}
+	// A failback is one step of the job as a whole, whatever its reverse
+	// session is doing.
+	state := s.state
+	if s.reverse && (state == StatePending || state == StateSeeding || state == StateRunning) {
+		state = StateFailingBack
+	}
+	var failoverReplicas map[string]int32
+	if len(s.failoverReplicas) > 0 {
+		failoverReplicas = make(map[string]int32, len(s.failoverReplicas))
+		for k, v := range s.failoverReplicas {
+			failoverReplicas[k] = v
+		}
+	}
+	return Status{
+		JobID:               s.jobID,
+		DestinationID:       s.destinationID,
+		State:               state,
+		LastSyncTime:        s.lastSyncTime,
+		LastSourceEventTime: s.lastSourceEventTime,
+		ReplicationLag:      lag,
+		QueueDepth:          queueDepth,
+		ObjectCounts:        counts,
+		ErrorCounts:         errorCounts,
+		LastError:           s.lastError,
+		Conflicts:           conflicts,
+		LastReconcileTime:   s.lastReconcileTime,
+		FailoverReplicas:    failoverReplicas,
+	}
+}
+
+func (s *session) reportStatus() {
+	if s.report != nil {
+		s.report(s.status())
+	}
+}
+
+func (s *session) reportPeriodically() {
+	ticker := time.NewTicker(statusReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.reportStatus()
+		}
+	}
+}
+
+// gvrKey renders a GVR as resource.group, e.g. deployments.apps or services.
+func gvrKey(gvr schema.GroupVersionResource) string {
+	if gvr.Group == "" {
+		return gvr.Resource
+	}
+	return gvr.Resource + "." + gvr.Group
+}
@@ -0,0 +1,32 @@
+package DR
+
+import "testing"
+
+func TestResumeAfterFailoverKeepsFailedOver(t *testing.T) {
+	s := &session{jobID: "job-paused-failover", state: StateRunning}
+	if err := registerSession(s); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unregisterSession(s) })
+
+	if err := PauseSession(s.jobID); err != nil {
+		t.Fatalf("PauseSession: %v", err)
+	}
+	// The health monitor fails over while the session is paused.
+	s.promoted.Store(true)
+	s.setState(StateFailedOver)
+	if err := ResumeSession(s.jobID); err != nil {
+		t.Fatalf("ResumeSession: %v", err)
+	}
+
+	status, err := SessionStatus(s.jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != StateFailedOver {
+		t.Errorf("state after resume = %s, want %s", status.State, StateFailedOver)
+	}
+	if s.writable() {
+		t.Error("resumed failed-over session accepts writes")
+	}
+}
@@ -0,0 +1,422 @@
+package DR
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// SnapshotFormatVersion is the archive layout written by TakeSnapshot. Restore
+// refuses archives from a newer layout.
+//
+// Layout of a version 1 archive (tar.gz):
+//
+//	manifest.json
+//	cluster/<group>/<version>/<resource>/<name>.yaml
+//	namespaces/<namespace>/<group>/<version>/<resource>/<name>.yaml
+//
+// The core group is written as "core".
+const SnapshotFormatVersion = 1
+
+const (
+	snapshotManifestFile = "manifest.json"
+	snapshotCoreGroup    = "core"
+	// snapshotSyncTimeout bounds how long a snapshot waits for the source
+	// informers to list everything.
+	snapshotSyncTimeout = 5 * time.Minute
+)
+
+// SnapshotOptions select what a snapshot captures.
+type SnapshotOptions struct {
+	Scope     Scope          `json:"scope"`
+	Resources ResourceFilter `json:"resources"`
+}
+
+// SnapshotManifest is the first entry of every snapshot archive.
+type SnapshotManifest struct {
+	FormatVersion int             `json:"format_version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Options       SnapshotOptions `json:"options"`
+	// ObjectCounts counts the archived objects per resource.
+	ObjectCounts map[string]int `json:"object_counts"`
+}
+
+// snapshotEntry is one object of a snapshot archive.
+type snapshotEntry struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	object    *unstructured.Unstructured
+}
+
+func (e snapshotEntry) path() string {
+	group := e.gvr.Group
+	if group == "" {
+		group = snapshotCoreGroup
+	}
+	gvrPath := path.Join(group, e.gvr.Version, e.gvr.Resource, e.object.GetName()+".yaml")
+	if e.namespace == "" {
+		return path.Join("cluster", gvrPath)
+	}
+	return path.Join("namespaces", e.namespace, gvrPath)
+}
+
+// parseSnapshotPath is the inverse of snapshotEntry.path.
+func parseSnapshotPath(name string) (schema.GroupVersionResource, string, error) {
+	parts := strings.Split(name, "/")
+	var gvrParts []string
+	var namespace string
+	switch {
+	case len(parts) == 5 && parts[0] == "cluster":
+		gvrParts = parts[1:4]
+	case len(parts) == 6 && parts[0] == "namespaces":
+		namespace = parts[1]
+		gvrParts = parts[2:5]
+	default:
+		return schema.GroupVersionResource{}, "", fmt.Errorf("unexpected snapshot entry %q", name)
+	}
+	group := gvrParts[0]
+	if group == snapshotCoreGroup {
+		group = ""
+	}
+	return schema.GroupVersionResource{Group: group, Version: gvrParts[1], Resource: gvrParts[2]}, namespace, nil
+}
+
+// TakeSnapshot writes a point-in-time tar.gz archive of the in-scope objects
+// of the source cluster to w. Objects are read from informer caches once they
+// have synced, so every resource is captured from a complete list.
+func TakeSnapshot(sourceClient dynamic.Interface, sourceK8sClient *kubernetes.Clientset, options SnapshotOptions, w io.Writer) (*SnapshotManifest, error) {
+	if err := options.Scope.Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.Resources.Validate(); err != nil {
+		return nil, err
+	}
+	gvrs, err := DiscoverResources(sourceK8sClient.Discovery(), options.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(snapshotSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+
+	// The label selector scopes workloads; cluster-scoped kinds are not filtered by it.
+	clusterFactory := dynamicinformer.NewDynamicSharedInformerFactory(sourceClient, 0)
+	namespacedFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(sourceClient, 0, "", func(listOptions *metav1.ListOptions) {
+		listOptions.LabelSelector = options.Scope.LabelSelector
+	})
+	clusterGVRs := []schema.GroupVersionResource{namespaceGVR}
+	for _, r := range clusterScopedResources {
+		if options.Resources.matches(r.gvr, r.kind) {
+			clusterGVRs = append(clusterGVRs, r.gvr)
+		}
+	}
+	for _, gvr := range clusterGVRs {
+		clusterFactory.ForResource(gvr)
+	}
+	for _, gvr := range gvrs {
+		namespacedFactory.ForResource(gvr)
+	}
+	clusterFactory.Start(stop)
+	namespacedFactory.Start(stop)
+	for gvr, synced := range clusterFactory.WaitForCacheSync(timeout) {
+		if !synced {
+			return nil, fmt.Errorf("timed out listing %s", gvrKey(gvr))
+		}
+	}
+	for gvr, synced := range namespacedFactory.WaitForCacheSync(timeout) {
+		if !synced {
+			return nil, fmt.Errorf("timed out listing %s", gvrKey(gvr))
+		}
+	}
+
+	namespaces := map[string]map[string]string{}
+	var entries []snapshotEntry
+	for _, gvr := range clusterGVRs {
+		for _, obj := range clusterFactory.ForResource(gvr).Informer().GetStore().List() {
+			u, ok := snapshotObject(gvr, obj)
+			if !ok {
+				continue
+			}
+			if gvr == namespaceGVR {
+				if !options.Scope.IncludesNamespace(u.GetName(), u.GetAnnotations()) {
+					continue
+				}
+				namespaces[u.GetName()] = u.GetAnnotations()
+			}
+			entries = append(entries, snapshotEntry{gvr: gvr, object: u})
+		}
+	}
+	for _, gvr := range gvrs {
+		for _, obj := range namespacedFactory.ForResource(gvr).Informer().GetStore().List() {
+			u, ok := snapshotObject(gvr, obj)
+			if !ok {
+				continue
+			}
+			annotations, inScope := namespaces[u.GetNamespace()]
+			if !inScope || namespaceExcludesResource(annotations, gvr) {
+				continue
+			}
+			entries = append(entries, snapshotEntry{gvr: gvr, namespace: u.GetNamespace(), object: u})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path() < entries[j].path() })
+
+	manifest := &SnapshotManifest{
+		FormatVersion: SnapshotFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Options:       options,
+		ObjectCounts:  map[string]int{},
+	}
+	for _, entry := range entries {
+		manifest.ObjectCounts[gvrKey(entry.gvr)]++
+	}
+	if err := writeSnapshotArchive(w, manifest, entries); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// snapshotObject copies an informer object into the form it is archived in and
+// reports false when it is not archived at all.
+func snapshotObject(gvr schema.GroupVersionResource, obj interface{}) (*unstructured.Unstructured, bool) {
+	source, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false
+	}
+	u := source.DeepCopy()
+	if objectExcluded(u) || !applyCleanupRules(gvr, u) {
+		return nil, false
+	}
+	cleanObject(u)
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u, true
+}
+
+func writeSnapshotArchive(w io.Writer, manifest *SnapshotManifest, entries []snapshotEntry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	writeFile := func(name string, data []byte) error {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot manifest: %w", err)
+	}
+	if err := writeFile(snapshotManifestFile, manifestJSON); err != nil {
+		return fmt.Errorf("failed to write snapshot manifest: %w", err)
+	}
+	for _, entry := range entries {
+		data, err := yaml.Marshal(entry.object.Object)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", entry.path(), err)
+		}
+		if err := writeFile(entry.path(), data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", entry.path(), err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// RestoreOptions control how a snapshot is written to a cluster.
+type RestoreOptions struct {
+	// NamespaceMap renames source namespaces on the way in; namespaces that are
+	// not listed keep their name.
+	NamespaceMap   map[string]string `json:"namespace_map"`
+	ConflictPolicy string            `json:"conflict_policy"`
+}
+
+// RestoreReport is the outcome of a restore. Individual objects that fail do
+// not abort the restore and are listed in Errors.
+type RestoreReport struct {
+	Manifest  SnapshotManifest `json:"manifest"`
+	Applied   map[string]int   `json:"applied"`
+	Conflicts []Conflict       `json:"conflicts,omitempty"`
+	Errors    []string         `json:"errors,omitempty"`
+}
+
+// RestoreSnapshot server-side applies every object of a snapshot archive to
+// the destination in dependency tiers; see ApplyInTiers.
+func RestoreSnapshot(r io.Reader, destClient dynamic.Interface, options RestoreOptions) (*RestoreReport, error) {
+	if err := ValidateConflictPolicy(options.ConflictPolicy); err != nil {
+		return nil, err
+	}
+	if options.ConflictPolicy == "" {
+		options.ConflictPolicy = ConflictReport
+	}
+	manifest, entries, err := readSnapshotArchive(r)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ApplyItem, 0, len(entries))
+	for _, entry := range entries {
+		u := entry.object
+		// Archives taken before a cleanup rule existed still hold what it drops.
+		if !applyCleanupRules(entry.gvr, u) {
+			continue
+		}
+		namespace := entry.namespace
+		if namespace != "" {
+			namespace = mapNamespace(options.NamespaceMap, namespace)
+			u.SetNamespace(namespace)
+		}
+		if entry.gvr == namespaceGVR {
+			u.SetName(mapNamespace(options.NamespaceMap, u.GetName()))
+		}
+		remapSubjectNamespaces(entry.gvr, u, options.NamespaceMap)
+		items = append(items, ApplyItem{GVR: entry.gvr, Namespace: namespace, Object: u})
+	}
+
+	report := &RestoreReport{Manifest: *manifest, Applied: map[string]int{}}
+	var mu sync.Mutex
+	failed := ApplyInTiers(items, func(item ApplyItem) error {
+		conflict, err := applyToDestination(destClient, item.GVR, item.Namespace, item.Object.DeepCopy(), options.ConflictPolicy, "")
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if conflict == nil {
+			report.Applied[gvrKey(item.GVR)]++
+		} else if options.ConflictPolicy == ConflictReport {
+			report.Conflicts = append(report.Conflicts, *conflict)
+		}
+		return nil
+	}, nil)
+	for _, e := range failed {
+		report.Errors = append(report.Errors, e.Error())
+	}
+	return report, nil
+}
+
+// ReadSnapshotManifest returns the manifest of a snapshot archive.
+func ReadSnapshotManifest(r io.Reader) (*SnapshotManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot archive: %w", err)
+	}
+	defer gz.Close()
+	return readManifest(tar.NewReader(gz))
+}
+
+func readManifest(tr *tar.Reader) (*SnapshotManifest, error) {
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot archive: %w", err)
+	}
+	if header.Name != snapshotManifestFile {
+		return nil, fmt.Errorf("invalid snapshot archive: first entry is %q, not %s", header.Name, snapshotManifestFile)
+	}
+	var manifest SnapshotManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid snapshot manifest: %w", err)
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > SnapshotFormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format version %d", manifest.FormatVersion)
+	}
+	return &manifest, nil
+}
+
+func readSnapshotArchive(r io.Reader) (*SnapshotManifest, []snapshotEntry, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	manifest, err := readManifest(tr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []snapshotEntry
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		gvr, namespace, err := parseSnapshotPath(header.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		u := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &u.Object); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode %s: %w", header.Name, err)
+		}
+		entries = append(entries, snapshotEntry{gvr: gvr, namespace: namespace, object: u})
+	}
+	return manifest, entries, nil
+}
+
+func mapNamespace(namespaceMap map[string]string, namespace string) string {
+	if mapped, ok := namespaceMap[namespace]; ok && mapped != "" {
+		return mapped
+	}
+	return namespace
+}
+
+// remapSubjectNamespaces keeps RBAC bindings pointing at service accounts in
+// renamed namespaces.
+func remapSubjectNamespaces(gvr schema.GroupVersionResource, u *unstructured.Unstructured, namespaceMap map[string]string) {
+	if len(namespaceMap) == 0 || gvr.Group != "rbac.authorization.k8s.io" {
+		return
+	}
+	if gvr.Resource != "rolebindings" && gvr.Resource != "clusterrolebindings" {
+		return
+	}
+	subjects, found, _ := unstructured.NestedSlice(u.Object, "subjects")
+	if !found {
+		return
+	}
+	for _, s := range subjects {
+		if subject, ok := s.(map[string]interface{}); ok {
+			if namespace, ok := subject["namespace"].(string); ok {
+				subject["namespace"] = mapNamespace(namespaceMap, namespace)
+			}
+		}
+	}
+	_ = unstructured.SetNestedSlice(u.Object, subjects, "subjects")
+}
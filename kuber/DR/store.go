@@ -0,0 +1,296 @@
+package DR
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of snapshot store.
+const (
+	StoreLocal = "local"
+	StoreS3    = "s3"
+)
+
+// ErrSnapshotNotFound is returned by a SnapshotStore for a missing archive.
+var ErrSnapshotNotFound = errors.New("snapshot archive not found")
+
+// SnapshotStore keeps snapshot archives under slash-separated keys.
+type SnapshotStore interface {
+	Put(key string, r io.Reader, size int64) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// snapshotKeyPattern keeps keys safe both as relative file paths and as
+// unescaped S3 object names.
+var snapshotKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)*$`)
+
+func validateSnapshotKey(key string) error {
+	if !snapshotKeyPattern.MatchString(key) || strings.Contains(key, "..") {
+		return fmt.Errorf("invalid snapshot key %q", key)
+	}
+	return nil
+}
+
+// NewSnapshotStore returns the store of the given kind configured from the
+// environment:
+//
+//	local: KUBER_SNAPSHOT_DIR (default "snapshots")
+//	s3:    KUBER_S3_ENDPOINT, KUBER_S3_BUCKET, KUBER_S3_ACCESS_KEY,
+//	       KUBER_S3_SECRET_KEY and KUBER_S3_REGION (default "us-east-1")
+func NewSnapshotStore(kind string) (SnapshotStore, error) {
+	switch kind {
+	case "", StoreLocal:
+		dir := os.Getenv("KUBER_SNAPSHOT_DIR")
+		if dir == "" {
+			dir = "snapshots"
+		}
+		return &LocalStore{Dir: dir}, nil
+	case StoreS3:
+		store := &S3Store{
+			Endpoint:  os.Getenv("KUBER_S3_ENDPOINT"),
+			Bucket:    os.Getenv("KUBER_S3_BUCKET"),
+			Region:    os.Getenv("KUBER_S3_REGION"),
+			AccessKey: os.Getenv("KUBER_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("KUBER_S3_SECRET_KEY"),
+		}
+		if store.Region == "" {
+			store.Region = "us-east-1"
+		}
+		if store.Endpoint == "" || store.Bucket == "" || store.AccessKey == "" || store.SecretKey == "" {
+			return nil, errors.New("S3 snapshot store is not configured: set KUBER_S3_ENDPOINT, KUBER_S3_BUCKET, KUBER_S3_ACCESS_KEY and KUBER_S3_SECRET_KEY")
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown snapshot store %q: must be %s or %s", kind, StoreLocal, StoreS3)
+}
+
+// LocalStore keeps archives in a directory on the server.
+type LocalStore struct {
+	Dir string
+}
+
+func (l *LocalStore) path(key string) (string, error) {
+	if err := validateSnapshotKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+func (l *LocalStore) Put(key string, r io.Reader, size int64) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	// Write next to the target and rename so a partial archive is never visible.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (l *LocalStore) Get(key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSnapshotNotFound
+	}
+	return f, err
+}
+
+func (l *LocalStore) Delete(key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// s3Client bounds every S3 request, so an endpoint that stops responding
+// fails the snapshot instead of hanging it. Archives are read whole before
+// they are restored, so the overall timeout covers the transfer only.
+var s3Client = &http.Client{
+	Timeout: 30 * time.Minute,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          10,
+	},
+}
+
+// S3Store keeps archives in a bucket of any S3-compatible endpoint, such as
+// MinIO, using path-style addressing and Signature Version 4.
+type S3Store struct {
+	// Endpoint includes the scheme, e.g. "http://minio.local:9000".
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+func (s *S3Store) Put(key string, r io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, key, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, 0)
+	if errors.Is(err, ErrSnapshotNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for one object and turns error responses into
+// errors. The caller closes the body of a successful response.
+func (s *S3Store) do(method, key string, body io.Reader, size int64) (*http.Response, error) {
+	if err := validateSnapshotKey(key); err != nil {
+		return nil, err
+	}
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	endpoint.Path = "/" + s.Bucket + "/" + key
+	req, err := http.NewRequest(method, endpoint.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 %s %s failed: %w", method, key, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrSnapshotNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("S3 %s %s failed: %s: %s", method, key, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header. The payload is
+// sent unsigned so archives can be streamed.
+func (s *S3Store) sign(req *http.Request, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	signV4(req, s.AccessKey, s.SecretKey, s.Region, "s3", payloadHash, now)
+}
+
+// signV4 sets the x-amz-date header of req and signs it, together with the
+// host and every other header already set, for the given service. The query
+// is signed as is, so it must already be in canonical form.
+func signV4(req *http.Request, accessKey, secretKey, region, service, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	credentialScope := date + "/" + region + "/" + service + "/aws4_request"
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + credentialScope + "\n" + hex.EncodeToString(hashedRequest[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, credentialScope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,212 @@
+package DR
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Tier groups kinds that only depend on kinds of earlier tiers. Objects are
+// applied tier by tier so that, for example, a Deployment never reaches the
+// destination before the ConfigMaps and Secrets it mounts.
+type Tier int
+
+const (
+	TierFoundation Tier = iota + 1 // namespaces and CRDs
+	TierRBAC                       // service accounts, roles and bindings
+	TierConfig                     // config maps, secrets, quotas and priority classes
+	TierStorage                    // storage classes, volumes and claims
+	TierWorkloads                  // pods and their controllers
+	TierNetworking                 // services, ingresses and network policies
+	TierOther                      // custom resources and anything unclassified
+)
+
+var tierNames = map[Tier]string{
+	TierFoundation: "foundation",
+	TierRBAC:       "rbac",
+	TierConfig:     "config",
+	TierStorage:    "storage",
+	TierWorkloads:  "workloads",
+	TierNetworking: "networking",
+	TierOther:      "other",
+}
+
+func (t Tier) String() string {
+	if name, ok := tierNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("tier-%d", int(t))
+}
+
+// resourceTiers classify resources by gvrKey; the RBAC group is classified as
+// a whole in TierOf.
+var resourceTiers = map[string]Tier{
+	"namespaces": TierFoundation,
+	"customresourcedefinitions.apiextensions.k8s.io": TierFoundation,
+
+	"serviceaccounts": TierRBAC,
+
+	"configmaps":                        TierConfig,
+	"secrets":                           TierConfig,
+	"limitranges":                       TierConfig,
+	"resourcequotas":                    TierConfig,
+	"priorityclasses.scheduling.k8s.io": TierConfig,
+
+	"storageclasses.storage.k8s.io": TierStorage,
+	"persistentvolumes":             TierStorage,
+	"persistentvolumeclaims":        TierStorage,
+
+	"pods":                                 TierWorkloads,
+	"replicationcontrollers":               TierWorkloads,
+	"deployments.apps":                     TierWorkloads,
+	"statefulsets.apps":                    TierWorkloads,
+	"daemonsets.apps":                      TierWorkloads,
+	"replicasets.apps":                     TierWorkloads,
+	"jobs.batch":                           TierWorkloads,
+	"cronjobs.batch":                       TierWorkloads,
+	"horizontalpodautoscalers.autoscaling": TierWorkloads,
+	"poddisruptionbudgets.policy":          TierWorkloads,
+
+	"services":                          TierNetworking,
+	"ingresses.networking.k8s.io":       TierNetworking,
+	"ingressclasses.networking.k8s.io":  TierNetworking,
+	"networkpolicies.networking.k8s.io": TierNetworking,
+	"endpointslices.discovery.k8s.io":   TierNetworking,
+	"endpoints":                         TierNetworking,
+}
+
+// TierOf returns the dependency tier of a resource.
+func TierOf(gvr schema.GroupVersionResource) Tier {
+	if gvr.Group == "rbac.authorization.k8s.io" {
+		return TierRBAC
+	}
+	if tier, ok := resourceTiers[gvrKey(gvr)]; ok {
+		return tier
+	}
+	return TierOther
+}
+
+const (
+	// tierApplyWorkers bounds the concurrent writes within one tier.
+	tierApplyWorkers = 8
+	// tierRetryAttempts and tierRetryBackoff bound how long an object whose
+	// dependency is not there yet is retried, doubling the wait each round.
+	tierRetryAttempts = 5
+	tierRetryBackoff  = time.Second
+)
+
+// ApplyItem is one object handed to ApplyInTiers.
+type ApplyItem struct {
+	GVR       schema.GroupVersionResource
+	Namespace string
+	Object    *unstructured.Unstructured
+}
+
+// ApplyError is an object that could not be applied.
+type ApplyError struct {
+	Item ApplyItem
+	Err  error
+}
+
+func (e *ApplyError) Error() string {
+	return fmt.Sprintf("%s: %v", objectKey(gvrKey(e.Item.GVR), e.Item.Namespace, e.Item.Object.GetName()), e.Err)
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyInTiers calls apply for every item, one tier at a time, and returns the
+// items that failed. Within a tier items are applied concurrently, so apply
+// must be safe for concurrent use. Items failing with a not-found error, such
+// as a namespace or CRD that is still being created, are retried with backoff
+// before the next tier starts. Closing stop abandons the remaining items.
+func ApplyInTiers(items []ApplyItem, apply func(ApplyItem) error, stop <-chan struct{}) []*ApplyError {
+	byTier := map[Tier][]ApplyItem{}
+	for _, item := range items {
+		tier := TierOf(item.GVR)
+		byTier[tier] = append(byTier[tier], item)
+	}
+	tiers := make([]Tier, 0, len(byTier))
+	for tier := range byTier {
+		tiers = append(tiers, tier)
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i] < tiers[j] })
+
+	var failed []*ApplyError
+	for _, tier := range tiers {
+		select {
+		case <-stop:
+			return failed
+		default:
+		}
+		pending := byTier[tier]
+		backoff := tierRetryBackoff
+		for attempt := 1; len(pending) > 0; attempt++ {
+			errs := applyConcurrently(pending, apply, stop)
+			pending = pending[:0:0]
+			for _, e := range errs {
+				if attempt < tierRetryAttempts && retryableApplyError(e.Err) {
+					pending = append(pending, e.Item)
+					continue
+				}
+				failed = append(failed, e)
+			}
+			if len(pending) == 0 {
+				break
+			}
+			select {
+			case <-stop:
+				return failed
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+	return failed
+}
+
+func applyConcurrently(items []ApplyItem, apply func(ApplyItem) error, stop <-chan struct{}) []*ApplyError {
+	var (
+		mu   sync.Mutex
+		errs []*ApplyError
+		wg   sync.WaitGroup
+	)
+	queue := make(chan ApplyItem)
+	for i := 0; i < tierApplyWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				if err := apply(item); err != nil {
+					mu.Lock()
+					errs = append(errs, &ApplyError{Item: item, Err: err})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+feed:
+	for _, item := range items {
+		select {
+		case <-stop:
+			break feed
+		case queue <- item:
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return errs
+}
+
+// retryableApplyError reports whether an apply may succeed once objects of the
+// same tier, or the CRD of a custom resource, exist.
+func retryableApplyError(err error) bool {
+	return apierrors.IsNotFound(err) || meta.IsNoMatchError(err)
+}
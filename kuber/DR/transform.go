@@ -0,0 +1,376 @@
+package DR
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TransformRules rewrite objects on their way to the destination so they fit
+// the target platform.
+type TransformRules struct {
+	// Fields set a value at a JSONPath such as
+	// "$.spec.template.spec.nodeSelector['topology.kubernetes.io/zone']".
+	Fields []FieldRule `json:"fields"`
+	// StorageClasses maps source storage class names to destination ones on
+	// PersistentVolumeClaims and StatefulSet volume claim templates.
+	StorageClasses map[string]string `json:"storage_classes"`
+	// Registries maps a source image registry prefix to a destination one,
+	// e.g. "123456789.dkr.ecr.us-east-1.amazonaws.com" to "harbor.dr.local/mirror".
+	Registries map[string]string `json:"registries"`
+	// DropAnnotations are annotation key globs removed from every object.
+	DropAnnotations []string `json:"drop_annotations"`
+	// IngressHosts maps Ingress hosts; a key starting with "*." rewrites the
+	// matching suffix, e.g. "*.aws.example.com" to "*.dr.example.com".
+	IngressHosts map[string]string `json:"ingress_hosts"`
+}
+
+// FieldRule sets Path to Value on objects whose kind, resource or group
+// matches one of Resources, or on every object when Resources is empty.
+type FieldRule struct {
+	Resources []string    `json:"resources"`
+	Path      string      `json:"path"`
+	Value     interface{} `json:"value"`
+}
+
+// Validate checks the globs and JSONPaths of the rule set.
+func (t TransformRules) Validate() error {
+	for _, rule := range t.Fields {
+		if _, err := parseFieldPath(rule.Path); err != nil {
+			return err
+		}
+		if err := (ResourceFilter{Include: rule.Resources}).Validate(); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range t.DropAnnotations {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid annotation pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Merge returns t with the rules of other layered on top; map entries in other
+// win over those in t.
+func (t TransformRules) Merge(other TransformRules) TransformRules {
+	merged := TransformRules{
+		Fields:          append(append([]FieldRule{}, t.Fields...), other.Fields...),
+		StorageClasses:  mergeMaps(t.StorageClasses, other.StorageClasses),
+		Registries:      mergeMaps(t.Registries, other.Registries),
+		DropAnnotations: append(append([]string{}, t.DropAnnotations...), other.DropAnnotations...),
+		IngressHosts:    mergeMaps(t.IngressHosts, other.IngressHosts),
+	}
+	return merged
+}
+
+// Inverse returns the rules that undo t's renames, for replicating in the
+// opposite direction. Where several names were mapped to the same one the
+// lexically smallest is restored. Fields and DropAnnotations cannot be undone
+// and are left out.
+func (t TransformRules) Inverse() TransformRules {
+	return TransformRules{
+		StorageClasses: invertMap(t.StorageClasses),
+		Registries:     invertMap(t.Registries),
+		IngressHosts:   invertMap(t.IngressHosts),
+	}
+}
+
+func invertMap(m map[string]string) map[string]string {
+	inverted := make(map[string]string, len(m))
+	for k, v := range m {
+		if existing, ok := inverted[v]; ok && existing < k {
+			continue
+		}
+		inverted[v] = k
+	}
+	return inverted
+}
+
+func mergeMaps(base, override map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Apply rewrites u in place.
+func (t TransformRules) Apply(gvr schema.GroupVersionResource, u *unstructured.Unstructured) error {
+	t.dropAnnotations(u)
+	t.mapStorageClasses(gvr, u)
+	t.rewriteImages(u)
+	t.rewriteIngressHosts(gvr, u)
+	for _, rule := range t.Fields {
+		if len(rule.Resources) > 0 && !(ResourceFilter{Include: rule.Resources}).matches(gvr, u.GetKind()) {
+			continue
+		}
+		segments, err := parseFieldPath(rule.Path)
+		if err != nil {
+			return err
+		}
+		if err := setPath(u.Object, segments, rule.Value); err != nil {
+			return fmt.Errorf("cannot set %s on %s %s: %w", rule.Path, u.GetKind(), u.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func (t TransformRules) dropAnnotations(u *unstructured.Unstructured) {
+	if len(t.DropAnnotations) == 0 {
+		return
+	}
+	annotations := u.GetAnnotations()
+	for key := range annotations {
+		if matchesAny(key, t.DropAnnotations) {
+			delete(annotations, key)
+		}
+	}
+	u.SetAnnotations(annotations)
+}
+
+func (t TransformRules) mapStorageClasses(gvr schema.GroupVersionResource, u *unstructured.Unstructured) {
+	if len(t.StorageClasses) == 0 {
+		return
+	}
+	mapClass := func(obj map[string]interface{}) {
+		class, found, _ := unstructured.NestedString(obj, "spec", "storageClassName")
+		if mapped, ok := t.StorageClasses[class]; found && ok {
+			_ = unstructured.SetNestedField(obj, mapped, "spec", "storageClassName")
+		}
+	}
+	switch gvrKey(gvr) {
+	case "persistentvolumeclaims":
+		mapClass(u.Object)
+	case "statefulsets.apps":
+		templates, found, _ := unstructured.NestedSlice(u.Object, "spec", "volumeClaimTemplates")
+		if !found {
+			return
+		}
+		for _, template := range templates {
+			if obj, ok := template.(map[string]interface{}); ok {
+				mapClass(obj)
+			}
+		}
+		_ = unstructured.SetNestedSlice(u.Object, templates, "spec", "volumeClaimTemplates")
+	}
+}
+
+// podSpecPaths are where a pod spec lives in the workload kinds DR replicates.
+var podSpecPaths = [][]string{
+	{"spec"},
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+func (t TransformRules) rewriteImages(u *unstructured.Unstructured) {
+	if len(t.Registries) == 0 {
+		return
+	}
+	for _, specPath := range podSpecPaths {
+		for _, field := range []string{"containers", "initContainers", "ephemeralContainers"} {
+			containers, found, _ := unstructured.NestedSlice(u.Object, append(append([]string{}, specPath...), field)...)
+			if !found {
+				continue
+			}
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if image, ok := container["image"].(string); ok {
+					container["image"] = t.rewriteImage(image)
+				}
+			}
+			_ = unstructured.SetNestedSlice(u.Object, containers, append(append([]string{}, specPath...), field)...)
+		}
+	}
+}
+
+// rewriteImage maps the registry of an image by the longest matching prefix
+// of Registries, so overlapping prefixes such as "docker.io" and
+// "docker.io/library" rewrite an image the same way on every sync.
+func (t TransformRules) rewriteImage(image string) string {
+	var best, bestTo string
+	for from, to := range t.Registries {
+		prefix := strings.TrimSuffix(from, "/")
+		if image != prefix && !strings.HasPrefix(image, prefix+"/") {
+			continue
+		}
+		if len(prefix) > len(best) || (len(prefix) == len(best) && to < bestTo) {
+			best, bestTo = prefix, to
+		}
+	}
+	if best == "" {
+		return image
+	}
+	return strings.TrimSuffix(bestTo, "/") + strings.TrimPrefix(image, best)
+}
+
+func (t TransformRules) rewriteIngressHosts(gvr schema.GroupVersionResource, u *unstructured.Unstructured) {
+	if len(t.IngressHosts) == 0 || gvr.Resource != "ingresses" {
+		return
+	}
+	rules, found, _ := unstructured.NestedSlice(u.Object, "spec", "rules")
+	if found {
+		for _, r := range rules {
+			if rule, ok := r.(map[string]interface{}); ok {
+				if host, ok := rule["host"].(string); ok {
+					rule["host"] = t.rewriteHost(host)
+				}
+			}
+		}
+		_ = unstructured.SetNestedSlice(u.Object, rules, "spec", "rules")
+	}
+	tls, found, _ := unstructured.NestedSlice(u.Object, "spec", "tls")
+	if found {
+		for _, entry := range tls {
+			spec, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			hosts, _ := spec["hosts"].([]interface{})
+			for i, h := range hosts {
+				if host, ok := h.(string); ok {
+					hosts[i] = t.rewriteHost(host)
+				}
+			}
+		}
+		_ = unstructured.SetNestedSlice(u.Object, tls, "spec", "tls")
+	}
+}
+
+// rewriteHost maps a host exactly or else by the longest matching wildcard
+// suffix.
+func (t TransformRules) rewriteHost(host string) string {
+	if mapped, ok := t.IngressHosts[host]; ok {
+		return mapped
+	}
+	var best, bestTo string
+	for from, to := range t.IngressHosts {
+		if !strings.HasPrefix(from, "*.") {
+			continue
+		}
+		suffix := strings.TrimPrefix(from, "*")
+		if !strings.HasSuffix(host, suffix) {
+			continue
+		}
+		if len(suffix) > len(best) || (len(suffix) == len(best) && to < bestTo) {
+			best, bestTo = suffix, to
+		}
+	}
+	if best == "" {
+		return host
+	}
+	return strings.TrimSuffix(host, best) + strings.TrimPrefix(bestTo, "*")
+}
+
+// pathSegment is one step of a parsed JSONPath: a map key, a list index, or
+// every list element when wildcard is set.
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseFieldPath understands the subset of JSONPath needed to address a field:
+// dotted keys, ['quoted.keys'], [n] and [*].
+func parseFieldPath(p string) ([]pathSegment, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(p, "$"), ".")
+	if rest == "" {
+		return nil, fmt.Errorf("invalid JSONPath %q: empty path", p)
+	}
+	var segments []pathSegment
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: unclosed bracket", p)
+			}
+			inner := rest[1:end]
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+			switch {
+			case inner == "*":
+				segments = append(segments, pathSegment{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid JSONPath %q: bad index %q", p, inner)
+				}
+				segments = append(segments, pathSegment{index: index, isIndex: true})
+			}
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: empty key", p)
+			}
+			segments = append(segments, pathSegment{key: rest[:end]})
+			rest = strings.TrimPrefix(rest[end:], ".")
+		}
+	}
+	return segments, nil
+}
+
+// setPath sets value at segments below obj, creating missing map keys on the
+// way. Missing list elements are an error.
+func setPath(obj interface{}, segments []pathSegment, value interface{}) error {
+	seg := segments[0]
+	last := len(segments) == 1
+	switch {
+	case seg.wildcard || seg.isIndex:
+		list, ok := obj.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list")
+		}
+		if seg.wildcard {
+			for i := range list {
+				if last {
+					list[i] = value
+				} else if err := setPath(list[i], segments[1:], value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if seg.index >= len(list) {
+			return fmt.Errorf("index %d out of range", seg.index)
+		}
+		if last {
+			list[seg.index] = value
+			return nil
+		}
+		return setPath(list[seg.index], segments[1:], value)
+	default:
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object at %q", seg.key)
+		}
+		if last {
+			m[seg.key] = value
+			return nil
+		}
+		next, ok := m[seg.key]
+		if !ok {
+			if segments[1].isIndex || segments[1].wildcard {
+				return fmt.Errorf("field %q does not exist", seg.key)
+			}
+			next = map[string]interface{}{}
+			m[seg.key] = next
+		}
+		return setPath(next, segments[1:], value)
+	}
+}
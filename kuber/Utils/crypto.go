@@ -0,0 +1,121 @@
+package Utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// encryptionVersion prefixes every ciphertext so the format or key can be
+// changed later.
+const encryptionVersion = 1
+
+var (
+	keyOnce sync.Once
+	key     []byte
+	keyErr  error
+)
+
+// encryptionKey is the AES-256 key of the server. It is read from
+// KUBER_ENCRYPTION_KEY (32 bytes, base64 encoded) or else from the file named
+// by KUBER_ENCRYPTION_KEY_FILE (default "kuber.key"), which is generated on
+// first use. Servers sharing a database must share the key.
+func encryptionKey() ([]byte, error) {
+	keyOnce.Do(func() {
+		if encoded := os.Getenv("KUBER_ENCRYPTION_KEY"); encoded != "" {
+			key, keyErr = decodeKey(encoded)
+			return
+		}
+		path := os.Getenv("KUBER_ENCRYPTION_KEY_FILE")
+		if path == "" {
+			path = "kuber.key"
+		}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			key, keyErr = decodeKey(string(data))
+			return
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			keyErr = fmt.Errorf("cannot read encryption key: %w", err)
+			return
+		}
+		generated := make([]byte, 32)
+		if _, err := rand.Read(generated); err != nil {
+			keyErr = fmt.Errorf("cannot generate encryption key: %w", err)
+			return
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			keyErr = fmt.Errorf("cannot store encryption key: %w", err)
+			return
+		}
+		defer file.Close()
+		if _, err := file.WriteString(base64.StdEncoding.EncodeToString(generated) + "\n"); err != nil {
+			keyErr = fmt.Errorf("cannot store encryption key: %w", err)
+			return
+		}
+		key = generated
+	})
+	return key, keyErr
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if len(decoded) != 32 {
+		return nil, fmt.Errorf("invalid encryption key: must be 32 bytes, got %d", len(decoded))
+	}
+	return decoded, nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	k, err := encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext with the server key. associatedData, e.g. the ID of
+// the record the ciphertext is stored in, must be passed again to Decrypt, so
+// a ciphertext copied to another record does not decrypt.
+func Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+	out := append([]byte{encryptionVersion}, nonce...)
+	return gcm.Seal(out, nonce, plaintext, associatedData), nil
+}
+
+func Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < 1+gcm.NonceSize() || ciphertext[0] != encryptionVersion {
+		return nil, errors.New("cannot decrypt: unknown format")
+	}
+	nonce := ciphertext[1 : 1+gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext[1+gcm.NonceSize():], associatedData)
+	if err != nil {
+		return nil, errors.New("cannot decrypt: wrong key or corrupted data")
+	}
+	return plaintext, nil
+}
@@ -75,9 +75,10 @@ func createTables() error {
 	CREATE TABLE IF NOT EXISTS clusters (
 		id TEXT NOT NULL PRIMARY KEY,
 		name TEXT NOT NULL UNIQUE,
-		provisioner TEXT NOT NULL CHECK (provisioner IN ('aws', 'azure', 'gcp', 'nutanix', 'vmware')),
+		provisioner TEXT NOT NULL,
 		region TEXT NOT NULL,
-		kubeconfig TEXT NOT NULL,
+		kubeconfig TEXT NOT NULL DEFAULT '',
+		kubeconfig_data BYTEA,
 		created_at TIMESTAMPTZ DEFAULT now(),
 		updated_at TIMESTAMPTZ DEFAULT now(),
 		user_id INTEGER,
@@ -108,6 +109,271 @@ func createTables() error {
 		return fmt.Errorf("error creating infra table: %w", err)
 	}
 
+	// A DR job outlives its clusters: deleting one leaves the job, with its
+	// history, pointing at no cluster.
+	drJobsTable := `
+	CREATE TABLE IF NOT EXISTS dr_jobs (
+		id TEXT NOT NULL PRIMARY KEY,
+		source_cluster_id TEXT,
+		destination_cluster_id TEXT,
+		dr_type TEXT NOT NULL CHECK (dr_type IN ('active-passive', 'active-active')),
+		state TEXT NOT NULL DEFAULT 'Pending',
+		started_at TIMESTAMPTZ,
+		last_sync_at TIMESTAMPTZ,
+		object_counts JSONB DEFAULT '{}',
+		last_error TEXT NOT NULL DEFAULT '',
+		options JSONB DEFAULT '{}',
+		conflicts JSONB DEFAULT '[]',
+		last_reconcile_at TIMESTAMPTZ,
+		last_source_event_at TIMESTAMPTZ,
+		replication_lag_ms BIGINT DEFAULT 0,
+		queue_depth JSONB DEFAULT '{}',
+		error_counts JSONB DEFAULT '{}',
+		failover_replicas JSONB DEFAULT '{}',
+		user_id INTEGER,
+		created_at TIMESTAMPTZ DEFAULT now(),
+		updated_at TIMESTAMPTZ DEFAULT now(),
+		FOREIGN KEY(source_cluster_id) REFERENCES clusters(id) ON DELETE SET NULL,
+		FOREIGN KEY(destination_cluster_id) REFERENCES clusters(id) ON DELETE SET NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+	);`
+
+	if _, err := DB.Exec(drJobsTable); err != nil {
+		return fmt.Errorf("error creating dr_jobs table: %w", err)
+	}
+
+	// The destinations of a fan-out DR job; dr_jobs.destination_cluster_id
+	// holds the first of them.
+	drJobDestinationsTable := `
+	CREATE TABLE IF NOT EXISTS dr_job_destinations (
+		job_id TEXT NOT NULL,
+		destination_cluster_id TEXT NOT NULL,
+		state TEXT NOT NULL DEFAULT 'Pending',
+		last_sync_at TIMESTAMPTZ,
+		last_reconcile_at TIMESTAMPTZ,
+		replication_lag_ms BIGINT DEFAULT 0,
+		queue_depth JSONB DEFAULT '{}',
+		object_counts JSONB DEFAULT '{}',
+		error_counts JSONB DEFAULT '{}',
+		last_error TEXT NOT NULL DEFAULT '',
+		conflicts JSONB DEFAULT '[]',
+		updated_at TIMESTAMPTZ DEFAULT now(),
+		PRIMARY KEY(job_id, destination_cluster_id),
+		FOREIGN KEY(job_id) REFERENCES dr_jobs(id) ON DELETE CASCADE,
+		FOREIGN KEY(destination_cluster_id) REFERENCES clusters(id) ON DELETE CASCADE
+	);`
+
+	if _, err := DB.Exec(drJobDestinationsTable); err != nil {
+		return fmt.Errorf("error creating dr_job_destinations table: %w", err)
+	}
+
+	// Snapshots outlive the cluster they were taken from, so cluster_id is not
+	// a foreign key and the cluster name is kept alongside it.
+	snapshotsTable := `
+	CREATE TABLE IF NOT EXISTS snapshots (
+		id TEXT NOT NULL PRIMARY KEY,
+		cluster_id TEXT NOT NULL,
+		cluster_name TEXT NOT NULL,
+		store TEXT NOT NULL CHECK (store IN ('local', 's3')),
+		object_key TEXT NOT NULL,
+		size_bytes BIGINT NOT NULL DEFAULT 0,
+		format_version INTEGER NOT NULL,
+		object_counts JSONB DEFAULT '{}',
+		options JSONB DEFAULT '{}',
+		user_id INTEGER,
+		created_at TIMESTAMPTZ DEFAULT now(),
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+	);`
+
+	if _, err := DB.Exec(snapshotsTable); err != nil {
+		return fmt.Errorf("error creating snapshots table: %w", err)
+	}
+
+	drRepairsTable := `
+	CREATE TABLE IF NOT EXISTS dr_repairs (
+		id SERIAL PRIMARY KEY,
+		job_id TEXT NOT NULL,
+		resource TEXT NOT NULL,
+		namespace TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		action TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+		changes JSONB DEFAULT '[]',
+		repaired_at TIMESTAMPTZ DEFAULT now(),
+		FOREIGN KEY(job_id) REFERENCES dr_jobs(id) ON DELETE CASCADE
+	);`
+
+	if _, err := DB.Exec(drRepairsTable); err != nil {
+		return fmt.Errorf("error creating dr_repairs table: %w", err)
+	}
+
+	drDrillsTable := `
+	CREATE TABLE IF NOT EXISTS dr_drills (
+		id TEXT NOT NULL PRIMARY KEY,
+		job_id TEXT NOT NULL,
+		schedule TEXT NOT NULL,
+		include_namespaces JSONB DEFAULT '[]',
+		label_selector TEXT NOT NULL DEFAULT '',
+		timeout_seconds INTEGER NOT NULL DEFAULT 0,
+		enabled BOOLEAN NOT NULL DEFAULT true,
+		last_run_at TIMESTAMPTZ,
+		last_passed BOOLEAN,
+		next_run_at TIMESTAMPTZ,
+		user_id INTEGER,
+		created_at TIMESTAMPTZ DEFAULT now(),
+		FOREIGN KEY(job_id) REFERENCES dr_jobs(id) ON DELETE CASCADE,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+	);`
+
+	if _, err := DB.Exec(drDrillsTable); err != nil {
+		return fmt.Errorf("error creating dr_drills table: %w", err)
+	}
+
+	// Drill reports are audit evidence, so they outlive the drill schedule
+	// that produced them.
+	drDrillReportsTable := `
+	CREATE TABLE IF NOT EXISTS dr_drill_reports (
+		id SERIAL PRIMARY KEY,
+		drill_id TEXT,
+		job_id TEXT NOT NULL,
+		passed BOOLEAN NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		finished_at TIMESTAMPTZ NOT NULL,
+		duration_ms BIGINT NOT NULL DEFAULT 0,
+		time_to_available_ms BIGINT NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		report JSONB DEFAULT '{}',
+		FOREIGN KEY(drill_id) REFERENCES dr_drills(id) ON DELETE SET NULL,
+		FOREIGN KEY(job_id) REFERENCES dr_jobs(id) ON DELETE CASCADE
+	);`
+
+	if _, err := DB.Exec(drDrillReportsTable); err != nil {
+		return fmt.Errorf("error creating dr_drill_reports table: %w", err)
+	}
+
+	// Values that replace those of replicated Secrets on one destination
+	// cluster, whatever DR job writes there.
+	drSecretOverridesTable := `
+	CREATE TABLE IF NOT EXISTS dr_secret_overrides (
+		id SERIAL PRIMARY KEY,
+		cluster_id TEXT NOT NULL,
+		namespace TEXT NOT NULL,
+		name TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		user_id INTEGER,
+		created_at TIMESTAMPTZ DEFAULT now(),
+		updated_at TIMESTAMPTZ DEFAULT now(),
+		UNIQUE(cluster_id, namespace, name, key),
+		FOREIGN KEY(cluster_id) REFERENCES clusters(id) ON DELETE CASCADE,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+	);`
+
+	if _, err := DB.Exec(drSecretOverridesTable); err != nil {
+		return fmt.Errorf("error creating dr_secret_overrides table: %w", err)
+	}
+
+	drSecretTransfersTable := `
+	CREATE TABLE IF NOT EXISTS dr_secret_transfers (
+		id SERIAL PRIMARY KEY,
+		job_id TEXT NOT NULL,
+		cluster_id TEXT NOT NULL,
+		namespace TEXT NOT NULL,
+		name TEXT NOT NULL,
+		secret_type TEXT NOT NULL,
+		action TEXT NOT NULL CHECK (action IN ('copied', 'sealed', 'skipped', 'deleted')),
+		overridden_keys JSONB DEFAULT '[]',
+		transferred_at TIMESTAMPTZ DEFAULT now(),
+		FOREIGN KEY(job_id) REFERENCES dr_jobs(id) ON DELETE CASCADE
+	);`
+
+	if _, err := DB.Exec(drSecretTransfersTable); err != nil {
+		return fmt.Errorf("error creating dr_secret_transfers table: %w", err)
+	}
+
+	// The history is kept after a cluster is deleted, so cluster_id is not a
+	// foreign key.
+	clusterStatusHistoryTable := `
+	CREATE TABLE IF NOT EXISTS cluster_status_history (
+		id SERIAL PRIMARY KEY,
+		cluster_id TEXT NOT NULL,
+		from_status TEXT NOT NULL DEFAULT '',
+		to_status TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		user_id INTEGER,
+		changed_at TIMESTAMPTZ DEFAULT now(),
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+	);`
+
+	if _, err := DB.Exec(clusterStatusHistoryTable); err != nil {
+		return fmt.Errorf("error creating cluster_status_history table: %w", err)
+	}
+
+	// Like the status history, provisioning jobs and their logs are kept after
+	// the cluster is deleted.
+	provisioningJobsTable := `
+	CREATE TABLE IF NOT EXISTS provisioning_jobs (
+		id TEXT NOT NULL PRIMARY KEY,
+		cluster_id TEXT NOT NULL,
+		cluster_name TEXT NOT NULL,
+		provisioner TEXT NOT NULL,
+		action TEXT NOT NULL DEFAULT 'create' CHECK (action IN ('create', 'delete')),
+		spec JSONB DEFAULT '{}',
+		state TEXT NOT NULL CHECK (state IN ('Running', 'Succeeded', 'Failed')),
+		error TEXT NOT NULL DEFAULT '',
+		logs TEXT NOT NULL DEFAULT '',
+		user_id INTEGER,
+		started_at TIMESTAMPTZ DEFAULT now(),
+		finished_at TIMESTAMPTZ,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+	);`
+
+	if _, err := DB.Exec(provisioningJobsTable); err != nil {
+		return fmt.Errorf("error creating provisioning_jobs table: %w", err)
+	}
+
+	return migrateTables()
+}
+
+// columnMigrations add columns introduced after a table was first created, so
+// existing databases pick them up on startup.
+var columnMigrations = []string{
+	`ALTER TABLE dr_jobs ADD COLUMN IF NOT EXISTS options JSONB DEFAULT '{}'`,
+	`ALTER TABLE dr_jobs ADD COLUMN IF NOT EXISTS conflicts JSONB DEFAULT '[]'`,
+	`ALTER TABLE dr_jobs ADD COLUMN IF NOT EXISTS last_reconcile_at TIMESTAMPTZ`,
+	`ALTER TABLE dr_jobs ADD COLUMN IF NOT EXISTS last_source_event_at TIMESTAMPTZ`,
+	`ALTER TABLE dr_jobs ADD COLUMN IF NOT EXISTS replication_lag_ms BIGINT DEFAULT 0`,
+	`ALTER TABLE dr_jobs ADD COLUMN IF NOT EXISTS queue_depth JSONB DEFAULT '{}'`,
+	`ALTER TABLE dr_jobs ADD COLUMN IF NOT EXISTS error_counts JSONB DEFAULT '{}'`,
+	`ALTER TABLE dr_jobs ADD COLUMN IF NOT EXISTS failover_replicas JSONB DEFAULT '{}'`,
+	// Clusters used to be saved as Completed before the status lifecycle.
+	`UPDATE clusters SET status = 'Ready' WHERE status = 'Completed'`,
+	// Provisioners are validated by the provisioner registry and the
+	// registration API rather than a fixed list in the schema.
+	`ALTER TABLE clusters DROP CONSTRAINT IF EXISTS clusters_provisioner_check`,
+	`ALTER TABLE provisioning_jobs ADD COLUMN IF NOT EXISTS action TEXT NOT NULL DEFAULT 'create'`,
+	`ALTER TABLE provisioning_jobs ADD COLUMN IF NOT EXISTS spec JSONB DEFAULT '{}'`,
+	// Kubeconfigs are stored encrypted in kubeconfig_data; kubeconfig keeps
+	// the path a cluster was registered or imported from, if any.
+	`ALTER TABLE clusters ADD COLUMN IF NOT EXISTS kubeconfig_data BYTEA`,
+	`ALTER TABLE clusters ALTER COLUMN kubeconfig SET DEFAULT ''`,
+	// Deleting a cluster used to delete its DR jobs, and with them their
+	// repairs, drills and secret transfers.
+	`ALTER TABLE dr_jobs ALTER COLUMN source_cluster_id DROP NOT NULL`,
+	`ALTER TABLE dr_jobs ALTER COLUMN destination_cluster_id DROP NOT NULL`,
+	`ALTER TABLE dr_jobs DROP CONSTRAINT IF EXISTS dr_jobs_source_cluster_id_fkey`,
+	`ALTER TABLE dr_jobs ADD CONSTRAINT dr_jobs_source_cluster_id_fkey
+		FOREIGN KEY(source_cluster_id) REFERENCES clusters(id) ON DELETE SET NULL`,
+	`ALTER TABLE dr_jobs DROP CONSTRAINT IF EXISTS dr_jobs_destination_cluster_id_fkey`,
+	`ALTER TABLE dr_jobs ADD CONSTRAINT dr_jobs_destination_cluster_id_fkey
+		FOREIGN KEY(destination_cluster_id) REFERENCES clusters(id) ON DELETE SET NULL`,
+}
+
+func migrateTables() error {
+	for _, migration := range columnMigrations {
+		if _, err := DB.Exec(migration); err != nil {
+			return fmt.Errorf("error migrating tables: %w", err)
+		}
+	}
 	return nil
 }
 
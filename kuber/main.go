@@ -11,15 +11,19 @@ import (
 
 func main() {
 	db.InitDB()
+	routes.ImportKubeconfigFiles()
 	server := gin.Default()
 	server.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 	routes.Routes(server)
+	routes.ScheduleDRDrills()
+	routes.RecoverProvisioningJobs()
+	routes.RecoverDRJobs()
 	server.Run("localhost:8000")
 }
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// clientIdleTimeout is how long the clients of a cluster are kept once they
+// are no longer used.
+const clientIdleTimeout = 10 * time.Minute
+
+// ClusterClients are the clients of one cluster. They share one HTTP client,
+// so a pooled cluster keeps its connections open between requests instead of
+// repeating the TLS handshake.
+type ClusterClients struct {
+	Config    *rest.Config
+	Kube      *kubernetes.Clientset
+	Dynamic   dynamic.Interface
+	Metrics   *versioned.Clientset
+	Discovery discovery.CachedDiscoveryInterface
+	Mapper    *restmapper.DeferredDiscoveryRESTMapper
+
+	httpClient *http.Client
+}
+
+func newClusterClients(kubeconfig []byte) (*ClusterClients, error) {
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
+	}
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	clients := &ClusterClients{Config: config, httpClient: httpClient}
+	if clients.Kube, err = kubernetes.NewForConfigAndClient(config, httpClient); err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	if clients.Dynamic, err = dynamic.NewForConfigAndClient(config, httpClient); err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	if clients.Metrics, err = versioned.NewForConfigAndClient(config, httpClient); err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes metric client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+	clients.Discovery = memory.NewMemCacheClient(discoveryClient)
+	clients.Mapper = restmapper.NewDeferredDiscoveryRESTMapper(clients.Discovery)
+	return clients, nil
+}
+
+func (c *ClusterClients) close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+type pooledClients struct {
+	clients *ClusterClients
+	// fingerprint identifies the stored kubeconfig the clients were built
+	// from, so a kubeconfig replaced by another server is noticed too.
+	fingerprint [sha256.Size]byte
+	lastUsed    time.Time
+}
+
+var (
+	clientPoolMu       sync.Mutex
+	clientPool         = map[string]*pooledClients{}
+	clientEvictionOnce sync.Once
+)
+
+// GetClusterClients returns the pooled clients of a cluster, building them
+// when the cluster is not pooled yet or its kubeconfig changed.
+func GetClusterClients(clusterID string) (*ClusterClients, error) {
+	path, encrypted, err := storedKubeconfig(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	// A kubeconfig still read from its file is identified by its path only;
+	// a change to the file is picked up once its clients are evicted.
+	fingerprint := sha256.Sum256(append([]byte(path+"\x00"), encrypted...))
+
+	clientPoolMu.Lock()
+	if pooled, ok := clientPool[clusterID]; ok && pooled.fingerprint == fingerprint {
+		pooled.lastUsed = time.Now()
+		clientPoolMu.Unlock()
+		return pooled.clients, nil
+	}
+	clientPoolMu.Unlock()
+
+	kubeconfig, err := decodeKubeconfig(clusterID, path, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := newClusterClients(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clientPoolMu.Lock()
+	defer clientPoolMu.Unlock()
+	if pooled, ok := clientPool[clusterID]; ok {
+		if pooled.fingerprint == fingerprint {
+			// Built concurrently by another request.
+			clients.close()
+			pooled.lastUsed = time.Now()
+			return pooled.clients, nil
+		}
+		pooled.clients.close()
+	}
+	clientPool[clusterID] = &pooledClients{clients: clients, fingerprint: fingerprint, lastUsed: time.Now()}
+	clientEvictionOnce.Do(func() { go evictIdleClients() })
+	return clients, nil
+}
+
+// InvalidateClusterClients drops the pooled clients of a cluster, e.g. when
+// its kubeconfig is replaced or it is deleted.
+func InvalidateClusterClients(clusterID string) {
+	clientPoolMu.Lock()
+	defer clientPoolMu.Unlock()
+	if pooled, ok := clientPool[clusterID]; ok {
+		pooled.clients.close()
+		delete(clientPool, clusterID)
+	}
+}
+
+func evictIdleClients() {
+	ticker := time.NewTicker(clientIdleTimeout / 10)
+	defer ticker.Stop()
+	for range ticker.C {
+		clientPoolMu.Lock()
+		for clusterID, pooled := range clientPool {
+			if time.Since(pooled.lastUsed) > clientIdleTimeout {
+				pooled.clients.close()
+				delete(clientPool, clusterID)
+			}
+		}
+		clientPoolMu.Unlock()
+	}
+}
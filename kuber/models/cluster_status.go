@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/kuber/db"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Statuses a cluster moves through over its lifetime.
+const (
+	ClusterPending      = "Pending"
+	ClusterProvisioning = "Provisioning"
+	ClusterReady        = "Ready"
+	ClusterDegraded     = "Degraded"
+	ClusterUnreachable  = "Unreachable"
+	ClusterFailed       = "Failed"
+	ClusterDeleting     = "Deleting"
+)
+
+// clusterStatusTransitions lists the statuses each status may move to. A
+// cluster can be deleted from any status and leaves Deleting only when its
+// deletion failed.
+var clusterStatusTransitions = map[string][]string{
+	ClusterPending:      {ClusterProvisioning, ClusterReady, ClusterDegraded, ClusterUnreachable, ClusterFailed, ClusterDeleting},
+	ClusterProvisioning: {ClusterReady, ClusterDegraded, ClusterUnreachable, ClusterFailed, ClusterDeleting},
+	ClusterReady:        {ClusterDegraded, ClusterUnreachable, ClusterDeleting},
+	ClusterDegraded:     {ClusterReady, ClusterUnreachable, ClusterDeleting},
+	ClusterUnreachable:  {ClusterReady, ClusterDegraded, ClusterDeleting},
+	ClusterFailed:       {ClusterProvisioning, ClusterDeleting},
+	ClusterDeleting:     {ClusterFailed},
+}
+
+// clusterProbeTimeout bounds each request ProbeClusterStatus makes.
+const clusterProbeTimeout = 10 * time.Second
+
+var ErrInvalidClusterStatusTransition = errors.New("invalid cluster status transition")
+
+// IsClusterStatus reports whether status is part of the cluster lifecycle.
+func IsClusterStatus(status string) bool {
+	_, ok := clusterStatusTransitions[status]
+	return ok
+}
+
+// CanTransitionClusterStatus reports whether a cluster may move from one
+// status to another. Staying in the same status is always allowed.
+func CanTransitionClusterStatus(from, to string) bool {
+	if from == to {
+		return IsClusterStatus(to)
+	}
+	for _, next := range clusterStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterStatusChange is one recorded transition of a cluster's status.
+type ClusterStatusChange struct {
+	ID         int64     `json:"id"`
+	ClusterID  string    `json:"cluster_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	UserID     int64     `json:"user_id"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+func recordClusterStatusChange(tx *sql.Tx, clusterID, from, to, reason string, userID int64) error {
+	var user interface{}
+	if userID != 0 {
+		user = userID
+	}
+	_, err := tx.Exec(`INSERT INTO cluster_status_history (cluster_id, from_status, to_status, reason, user_id) VALUES ($1, $2, $3, $4, $5)`,
+		clusterID, from, to, reason, user)
+	if err != nil {
+		return fmt.Errorf("cannot record cluster status change: %w", err)
+	}
+	return nil
+}
+
+// UpdateClusterStatus moves a cluster to a new status and records the
+// transition. A transition the lifecycle does not allow returns
+// ErrInvalidClusterStatusTransition; staying in the same status records
+// nothing.
+func UpdateClusterStatus(clusterID, status, reason string, userID int64) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("cannot update cluster status: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(`SELECT status FROM clusters WHERE id = $1 FOR UPDATE`, clusterID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrClusterNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("cannot update cluster status: %w", err)
+	}
+	if err := changeClusterStatus(tx, clusterID, current, status, reason, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot update cluster status: %w", err)
+	}
+	return nil
+}
+
+// changeClusterStatus moves a cluster locked by tx from its current status to
+// a new one and records the transition.
+func changeClusterStatus(tx *sql.Tx, clusterID, current, status, reason string, userID int64) error {
+	if !CanTransitionClusterStatus(current, status) {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidClusterStatusTransition, current, status)
+	}
+	if current == status {
+		return nil
+	}
+	if _, err := tx.Exec(`UPDATE clusters SET status = $1, updated_at = now() WHERE id = $2`, status, clusterID); err != nil {
+		return fmt.Errorf("cannot update cluster status: %w", err)
+	}
+	return recordClusterStatusChange(tx, clusterID, current, status, reason, userID)
+}
+
+// GetClusterStatusHistory returns the status transitions of a cluster, newest
+// first. The history of a deleted cluster is kept.
+func GetClusterStatusHistory(clusterID string, limit int) ([]*ClusterStatusChange, error) {
+	query := `SELECT id, cluster_id, from_status, to_status, reason, COALESCE(user_id, 0), changed_at
+			  FROM cluster_status_history WHERE cluster_id = $1 ORDER BY changed_at DESC, id DESC LIMIT $2`
+	rows, err := db.DB.Query(query, clusterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch cluster status history: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []*ClusterStatusChange
+	for rows.Next() {
+		var c ClusterStatusChange
+		if err := rows.Scan(&c.ID, &c.ClusterID, &c.FromStatus, &c.ToStatus, &c.Reason, &c.UserID, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, &c)
+	}
+	return changes, rows.Err()
+}
+
+// ProbeClusterStatus contacts a cluster through its stored kubeconfig and
+// returns the status it is observed in, with the reason. A cluster whose API
+// server does not answer is Unreachable and one with a node that is not Ready
+// is Degraded.
+func ProbeClusterStatus(clusterID string) (string, string) {
+	clients, err := GetClusterClients(clusterID)
+	if err != nil {
+		return ClusterUnreachable, "cannot create Kubernetes client: " + err.Error()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterProbeTimeout)
+	defer cancel()
+	if err := clients.Kube.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+		return ClusterUnreachable, "API server did not answer: " + err.Error()
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), clusterProbeTimeout)
+	defer cancel()
+	nodes, err := clients.Kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return ClusterDegraded, "cannot list nodes: " + err.Error()
+	}
+	notReady := 0
+	for _, node := range nodes.Items {
+		if getNodeReadyStatus(node) != v1.ConditionTrue {
+			notReady++
+		}
+	}
+	if notReady > 0 {
+		return ClusterDegraded, fmt.Sprintf("%d of %d nodes are not ready", notReady, len(nodes.Items))
+	}
+	return ClusterReady, fmt.Sprintf("all %d nodes are ready", len(nodes.Items))
+}
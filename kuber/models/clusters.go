@@ -1,10 +1,12 @@
 package models
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
+	"example.com/kuber/Utils"
 	"example.com/kuber/db"
 )
 
@@ -12,7 +14,7 @@ import (
 type Cluster struct {
 	ID                 string    `json:"id"`
 	Name               string    `json:"name" binding:"required"`
-	Provisioner        string    `json:"provisioner" binding:"required" validate:"oneof=aws azure gcp nutanix vmware"`
+	Provisioner        string    `json:"provisioner" binding:"required"`
 	Region             string    `json:"region" binding:"required"`
 	WorkspaceID        string    `json:"workspace_id"`
 	WorkspaceName      string    `json:"workspace_name"`
@@ -20,7 +22,9 @@ type Cluster struct {
 	UserID             int64     `json:"user_id"`
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
-	KubeconfigFilePath string    `json:"kubeconfig_file_path" binding:"required"`
+	KubeconfigFilePath string    `json:"kubeconfig_file_path"`
+	// Kubeconfig is stored encrypted and never returned by the API.
+	Kubeconfig []byte `json:"-"`
 }
 
 func GetClusterIDByName(name string) (string, error) {
@@ -33,7 +37,9 @@ func GetClusterIDByName(name string) (string, error) {
 	return id, nil
 }
 
-func GetAllClusters() ([]map[string]interface{}, error) {
+// GetAllClusters lists the clusters. With details, the nodes and PVCs of each
+// cluster are fetched from it as well.
+func GetAllClusters(details bool) ([]map[string]interface{}, error) {
 	query := `SELECT id, name, provisioner, region, workspace_id, kubeconfig, user_id, created_at, updated_at, status FROM clusters;`
 	rows, err := db.DB.Query(query)
 	if err != nil {
@@ -42,6 +48,7 @@ func GetAllClusters() ([]map[string]interface{}, error) {
 	defer rows.Close()
 
 	var clusters []map[string]interface{}
+	var ids []string
 	for rows.Next() {
 		var c Cluster
 		err := rows.Scan(
@@ -66,7 +73,6 @@ func GetAllClusters() ([]map[string]interface{}, error) {
 		if workspaceName == "" {
 			workspaceName = "default"
 		}
-		controlPlanes, workerNodes, storageContainers := fetchClusterDetailsFromKubeconfig(c.KubeconfigFilePath)
 		clusterMap := map[string]interface{}{
 			"cluster_info": map[string]interface{}{
 				"id":                   c.ID,
@@ -80,21 +86,39 @@ func GetAllClusters() ([]map[string]interface{}, error) {
 				"updated_at":           c.UpdatedAt,
 				"kubeconfig_file_path": c.KubeconfigFilePath,
 			},
-			"cluster_details": map[string]interface{}{
-				"control_planes":     controlPlanes,
-				"worker_nodes":       workerNodes,
-				"storage_containers": storageContainers,
-			},
 		}
 		clusters = append(clusters, clusterMap)
+		ids = append(ids, c.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if details {
+		for i, clusterDetails := range fetchAllClusterDetails(ids) {
+			clusters[i]["cluster_details"] = clusterDetails
+		}
 	}
 	return clusters, nil
 }
 
 func (c *Cluster) SaveCluster() error {
-	query := `INSERT INTO clusters (id, name, provisioner, region, workspace_id, kubeconfig, user_id, created_at, updated_at, status) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
-	err := db.DB.QueryRow(query,
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return errors.New("cannot create cluster: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	var kubeconfigData []byte
+	if c.Kubeconfig != nil {
+		kubeconfigData, err = Utils.Encrypt(c.Kubeconfig, []byte(c.ID))
+		if err != nil {
+			return errors.New("cannot encrypt kubeconfig: " + err.Error())
+		}
+	}
+
+	query := `INSERT INTO clusters (id, name, provisioner, region, workspace_id, kubeconfig, user_id, created_at, updated_at, status, kubeconfig_data) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+	err = tx.QueryRow(query,
 		c.ID,
 		c.Name,
 		c.Provisioner,
@@ -104,20 +128,30 @@ func (c *Cluster) SaveCluster() error {
 		c.UserID,
 		c.CreatedAt,
 		c.UpdatedAt,
-		c.Status).Scan(&c.ID)
+		c.Status,
+		kubeconfigData).Scan(&c.ID)
 	if err != nil {
 		return errors.New("cannot create cluster: " + err.Error())
 	}
-	err = UpdateWorkspaceByClusterInfo(c.WorkspaceID)
+	err = UpdateWorkspaceByClusterInfo(tx, c.WorkspaceID, 1)
 	if err != nil {
 		return errors.New("cannot update cluster count: " + err.Error())
 	}
+	err = recordClusterStatusChange(tx, c.ID, "", c.Status, "cluster registered", c.UserID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New("cannot create cluster: " + err.Error())
+	}
 	return nil
 }
 
-func UpdateWorkspaceByClusterInfo(workspaceID string) error {
-	updateQuery := `UPDATE workspaces SET cluster_count = cluster_count + 1 WHERE id = $1`
-	_, err := db.DB.Exec(updateQuery, workspaceID)
+// UpdateWorkspaceByClusterInfo adds delta to the cluster count of a workspace
+// as part of the transaction that adds or removes the cluster.
+func UpdateWorkspaceByClusterInfo(tx *sql.Tx, workspaceID string, delta int) error {
+	updateQuery := `UPDATE workspaces SET cluster_count = GREATEST(cluster_count + $1, 0) WHERE id = $2`
+	_, err := tx.Exec(updateQuery, delta, workspaceID)
 	if err != nil {
 		return fmt.Errorf("failed to update workspace cluster count: %w", err)
 	}
@@ -146,8 +180,6 @@ func GetClusterByID(id string) (map[string]interface{}, error) {
 		return nil, errors.New("cannot fetch cluster by ID: " + err.Error())
 	}
 
-	controlPlanes, workerNodes, storageContainers := fetchClusterDetailsFromKubeconfig(c.KubeconfigFilePath)
-
 	clusterMap := map[string]interface{}{
 		"cluster_info": map[string]interface{}{
 			"id":                   c.ID,
@@ -161,16 +193,12 @@ func GetClusterByID(id string) (map[string]interface{}, error) {
 			"updated_at":           c.UpdatedAt,
 			"kubeconfig_file_path": c.KubeconfigFilePath,
 		},
-		"cluster_details": map[string]interface{}{
-			"control_planes":     controlPlanes,
-			"worker_nodes":       workerNodes,
-			"storage_containers": storageContainers,
-		},
 	}
+	clusterMap["cluster_details"] = fetchClusterDetails(c.ID)
 	return clusterMap, nil
 }
 
-func GetClustersForUser(userID int64) ([]map[string]interface{}, error) {
+func GetClustersForUser(userID int64, details bool) ([]map[string]interface{}, error) {
 	query := `SELECT id, name, provisioner, region, workspace_id, kubeconfig, user_id, created_at, updated_at, status 
 			  FROM clusters WHERE user_id = $1`
 	rows, err := db.DB.Query(query, userID)
@@ -180,6 +208,7 @@ func GetClustersForUser(userID int64) ([]map[string]interface{}, error) {
 	defer rows.Close()
 
 	var clusters []map[string]interface{}
+	var ids []string
 	for rows.Next() {
 		var c Cluster
 		err := rows.Scan(
@@ -198,8 +227,6 @@ func GetClustersForUser(userID int64) ([]map[string]interface{}, error) {
 			return nil, err
 		}
 
-		controlPlanes, workerNodes, storageContainers := fetchClusterDetailsFromKubeconfig(c.KubeconfigFilePath)
-
 		clusterMap := map[string]interface{}{
 			"cluster_info": map[string]interface{}{
 				"id":                   c.ID,
@@ -213,18 +240,22 @@ func GetClustersForUser(userID int64) ([]map[string]interface{}, error) {
 				"updated_at":           c.UpdatedAt,
 				"kubeconfig_file_path": c.KubeconfigFilePath,
 			},
-			"cluster_details": map[string]interface{}{
-				"control_planes":     controlPlanes,
-				"worker_nodes":       workerNodes,
-				"storage_containers": storageContainers,
-			},
 		}
 		clusters = append(clusters, clusterMap)
+		ids = append(ids, c.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if details {
+		for i, clusterDetails := range fetchAllClusterDetails(ids) {
+			clusters[i]["cluster_details"] = clusterDetails
+		}
 	}
 	return clusters, nil
 }
 
-func GetClustersByWorkspaceName(workspace string) ([]map[string]interface{}, error) {
+func GetClustersByWorkspaceName(workspace string, details bool) ([]map[string]interface{}, error) {
 	workspaceID, err := GetWorkspaceIDByName(workspace)
 	if err != nil {
 		return nil, errors.New("cannot fetch workspace ID by name: " + err.Error())
@@ -241,6 +272,7 @@ func GetClustersByWorkspaceName(workspace string) ([]map[string]interface{}, err
 	defer rows.Close()
 
 	var clusters []map[string]interface{}
+	var ids []string
 	for rows.Next() {
 		var c Cluster
 		err := rows.Scan(
@@ -258,7 +290,6 @@ func GetClustersByWorkspaceName(workspace string) ([]map[string]interface{}, err
 		if err != nil {
 			return nil, err
 		}
-		controlPlanes, workerNodes, storageContainers := fetchClusterDetailsFromKubeconfig(c.KubeconfigFilePath)
 		clusterMap := map[string]interface{}{
 			"cluster_info": map[string]interface{}{
 				"id":                   c.ID,
@@ -272,13 +303,17 @@ func GetClustersByWorkspaceName(workspace string) ([]map[string]interface{}, err
 				"updated_at":           c.UpdatedAt,
 				"kubeconfig_file_path": c.KubeconfigFilePath,
 			},
-			"cluster_details": map[string]interface{}{
-				"control_planes":     controlPlanes,
-				"worker_nodes":       workerNodes,
-				"storage_containers": storageContainers,
-			},
 		}
 		clusters = append(clusters, clusterMap)
+		ids = append(ids, c.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if details {
+		for i, clusterDetails := range fetchAllClusterDetails(ids) {
+			clusters[i]["cluster_details"] = clusterDetails
+		}
 	}
 	return clusters, nil
 }
@@ -307,3 +342,124 @@ func GetProvisionerByID(id string) (string, error) {
 	}
 	return provisioner, nil
 }
+
+func GetClusterNameByID(id string) (string, error) {
+	query := `SELECT name FROM clusters WHERE id = $1`
+	row := db.DB.QueryRow(query, id)
+
+	var name string
+	err := row.Scan(&name)
+	if err != nil {
+		return "", errors.New("cannot fetch cluster name: " + err.Error())
+	}
+	return name, nil
+}
+
+var ErrClusterNotFound = errors.New("cluster not found")
+
+// DeleteCluster removes a cluster and decrements the cluster count of its
+// workspace in the same transaction, recording the move to Deleting in the
+// status history. It returns the kubeconfig path the cluster was registered
+// with and whether other clusters still use it.
+func DeleteCluster(id string, userID int64) (string, bool, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", false, fmt.Errorf("cannot delete cluster: %w", err)
+	}
+	defer tx.Rollback()
+
+	var workspaceID, kubeconfigFilePath, status string
+	err = tx.QueryRow(`DELETE FROM clusters WHERE id = $1 RETURNING workspace_id, kubeconfig, status`, id).Scan(&workspaceID, &kubeconfigFilePath, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, ErrClusterNotFound
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("cannot delete cluster: %w", err)
+	}
+	if err := UpdateWorkspaceByClusterInfo(tx, workspaceID, -1); err != nil {
+		return "", false, err
+	}
+	if err := recordClusterStatusChange(tx, id, status, ClusterDeleting, "cluster deleted", userID); err != nil {
+		return "", false, err
+	}
+	var shared bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM clusters WHERE kubeconfig = $1)`, kubeconfigFilePath).Scan(&shared)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot check kubeconfig usage: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", false, fmt.Errorf("cannot delete cluster: %w", err)
+	}
+	InvalidateClusterClients(id)
+	return kubeconfigFilePath, shared, nil
+}
+
+// ClusterUpdate holds the fields of a cluster to change; nil fields are kept.
+type ClusterUpdate struct {
+	Name        *string
+	Region      *string
+	WorkspaceID *string
+	// Kubeconfig replaces the stored kubeconfig; it must be normalized. The
+	// path a legacy cluster was registered with is cleared along with it.
+	Kubeconfig []byte
+	// Status moves the cluster to another status, recorded with
+	// StatusReason and UserID like UpdateClusterStatus does.
+	Status       *string
+	StatusReason string
+	UserID       int64
+}
+
+// UpdateCluster applies an update to a cluster. Moving it to another
+// workspace moves it between the two cluster counts in the same transaction.
+// A status the lifecycle does not allow returns
+// ErrInvalidClusterStatusTransition and leaves the cluster unchanged.
+func UpdateCluster(id string, update ClusterUpdate) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("cannot update cluster: %w", err)
+	}
+	defer tx.Rollback()
+
+	var workspaceID, status string
+	err = tx.QueryRow(`SELECT workspace_id, status FROM clusters WHERE id = $1 FOR UPDATE`, id).Scan(&workspaceID, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrClusterNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("cannot update cluster: %w", err)
+	}
+	if update.Status != nil {
+		if err := changeClusterStatus(tx, id, status, *update.Status, update.StatusReason, update.UserID); err != nil {
+			return err
+		}
+	}
+	var kubeconfigData []byte
+	if update.Kubeconfig != nil {
+		kubeconfigData, err = Utils.Encrypt(update.Kubeconfig, []byte(id))
+		if err != nil {
+			return fmt.Errorf("cannot encrypt kubeconfig: %w", err)
+		}
+	}
+	query := `UPDATE clusters SET name = COALESCE($1, name), region = COALESCE($2, region), workspace_id = COALESCE($3, workspace_id),
+			  kubeconfig_data = COALESCE($4, kubeconfig_data), kubeconfig = CASE WHEN $4::bytea IS NULL THEN kubeconfig ELSE '' END,
+			  updated_at = now() WHERE id = $5`
+	_, err = tx.Exec(query, update.Name, update.Region, update.WorkspaceID, kubeconfigData, id)
+	if err != nil {
+		return fmt.Errorf("cannot update cluster: %w", err)
+	}
+	if update.WorkspaceID != nil && *update.WorkspaceID != workspaceID {
+		if err := UpdateWorkspaceByClusterInfo(tx, workspaceID, -1); err != nil {
+			return err
+		}
+		if err := UpdateWorkspaceByClusterInfo(tx, *update.WorkspaceID, 1); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot update cluster: %w", err)
+	}
+	if update.Kubeconfig != nil {
+		InvalidateClusterClients(id)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/kuber/db"
+)
+
+// DRDrill is a cron schedule of failover simulations against a DR job.
+type DRDrill struct {
+	ID                string     `json:"id"`
+	JobID             string     `json:"job_id"`
+	Schedule          string     `json:"schedule"`
+	IncludeNamespaces []string   `json:"include_namespaces"`
+	LabelSelector     string     `json:"label_selector"`
+	TimeoutSeconds    int        `json:"timeout_seconds"`
+	Enabled           bool       `json:"enabled"`
+	LastRunAt         *time.Time `json:"last_run_at"`
+	LastPassed        *bool      `json:"last_passed"`
+	NextRunAt         *time.Time `json:"next_run_at"`
+	UserID            int64      `json:"user_id"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+const drDrillColumns = `id, job_id, schedule, COALESCE(include_namespaces, '[]'), label_selector, timeout_seconds, enabled,
+	last_run_at, last_passed, next_run_at, COALESCE(user_id, 0), created_at
+	FROM dr_drills`
+
+func (d *DRDrill) Save() error {
+	id, err := db.GetUUID()
+	if err != nil {
+		return fmt.Errorf("failed to generate UUID: %w", err)
+	}
+	d.ID = id
+	d.CreatedAt = time.Now()
+	if d.IncludeNamespaces == nil {
+		d.IncludeNamespaces = []string{}
+	}
+	namespacesJSON, err := json.Marshal(d.IncludeNamespaces)
+	if err != nil {
+		return fmt.Errorf("failed to marshal namespaces: %w", err)
+	}
+	query := `INSERT INTO dr_drills (id, job_id, schedule, include_namespaces, label_selector, timeout_seconds, enabled, next_run_at, user_id, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err = db.DB.Exec(query,
+		d.ID,
+		d.JobID,
+		d.Schedule,
+		namespacesJSON,
+		d.LabelSelector,
+		d.TimeoutSeconds,
+		d.Enabled,
+		d.NextRunAt,
+		d.UserID,
+		d.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create DR drill: %w", err)
+	}
+	return nil
+}
+
+func scanDRDrill(scan func(dest ...interface{}) error) (*DRDrill, error) {
+	var d DRDrill
+	var namespacesJSON []byte
+	var lastPassed sql.NullBool
+	err := scan(
+		&d.ID,
+		&d.JobID,
+		&d.Schedule,
+		&namespacesJSON,
+		&d.LabelSelector,
+		&d.TimeoutSeconds,
+		&d.Enabled,
+		&d.LastRunAt,
+		&lastPassed,
+		&d.NextRunAt,
+		&d.UserID,
+		&d.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(namespacesJSON, &d.IncludeNamespaces); err != nil {
+		return nil, fmt.Errorf("error unmarshaling namespaces: %w", err)
+	}
+	if lastPassed.Valid {
+		d.LastPassed = &lastPassed.Bool
+	}
+	return &d, nil
+}
+
+// GetDRDrills lists the drills of one DR job, or of every job when jobID is
+// empty, oldest first.
+func GetDRDrills(jobID string) ([]*DRDrill, error) {
+	rows, err := db.DB.Query(`SELECT `+drDrillColumns+` WHERE $1 = '' OR job_id = $1 ORDER BY created_at`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR drills: %w", err)
+	}
+	defer rows.Close()
+
+	var drills []*DRDrill
+	for rows.Next() {
+		drill, err := scanDRDrill(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		drills = append(drills, drill)
+	}
+	return drills, rows.Err()
+}
+
+// GetDRDrillByID returns nil without an error when the drill does not exist.
+func GetDRDrillByID(id string) (*DRDrill, error) {
+	row := db.DB.QueryRow(`SELECT `+drDrillColumns+` WHERE id = $1`, id)
+	drill, err := scanDRDrill(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR drill: %w", err)
+	}
+	return drill, nil
+}
+
+func DeleteDRDrill(id string) error {
+	_, err := db.DB.Exec(`DELETE FROM dr_drills WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete DR drill: %w", err)
+	}
+	return nil
+}
+
+// RecordDRDrillRun stores the outcome of a drill run and when it runs next.
+func RecordDRDrillRun(id string, ranAt time.Time, passed bool, nextRunAt *time.Time) error {
+	query := `UPDATE dr_drills SET last_run_at = $1, last_passed = $2, next_run_at = $3 WHERE id = $4`
+	_, err := db.DB.Exec(query, ranAt, passed, nextRunAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to record DR drill run: %w", err)
+	}
+	return nil
+}
+
+// DRDrillReport is the stored result of one drill run.
+type DRDrillReport struct {
+	ID                int64     `json:"id"`
+	DrillID           string    `json:"drill_id"`
+	JobID             string    `json:"job_id"`
+	Passed            bool      `json:"passed"`
+	StartedAt         time.Time `json:"started_at"`
+	FinishedAt        time.Time `json:"finished_at"`
+	DurationMs        int64     `json:"duration_ms"`
+	TimeToAvailableMs int64     `json:"time_to_available_ms"`
+	Error             string    `json:"error"`
+	// Report is the JSON encoded DR.DrillReport with per-workload and
+	// per-service results.
+	Report json.RawMessage `json:"report"`
+}
+
+func (r *DRDrillReport) Save() error {
+	if len(r.Report) == 0 {
+		r.Report = json.RawMessage(`{}`)
+	}
+	var drillID interface{}
+	if r.DrillID != "" {
+		drillID = r.DrillID
+	}
+	query := `INSERT INTO dr_drill_reports (drill_id, job_id, passed, started_at, finished_at, duration_ms, time_to_available_ms, error, report)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	err := db.DB.QueryRow(query, drillID, r.JobID, r.Passed, r.StartedAt, r.FinishedAt, r.DurationMs, r.TimeToAvailableMs, r.Error, []byte(r.Report)).Scan(&r.ID)
+	if err != nil {
+		return fmt.Errorf("cannot record DR drill report: %w", err)
+	}
+	return nil
+}
+
+// GetDRDrillReports returns the latest drill reports of a DR job, newest
+// first, optionally only those of one drill.
+func GetDRDrillReports(jobID, drillID string, limit int) ([]*DRDrillReport, error) {
+	query := `SELECT id, COALESCE(drill_id, ''), job_id, passed, started_at, finished_at, duration_ms, time_to_available_ms, error, COALESCE(report, '{}')
+			  FROM dr_drill_reports WHERE job_id = $1 AND ($2 = '' OR drill_id = $2) ORDER BY started_at DESC, id DESC LIMIT $3`
+	rows, err := db.DB.Query(query, jobID, drillID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR drill reports: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []*DRDrillReport
+	for rows.Next() {
+		var r DRDrillReport
+		var report []byte
+		if err := rows.Scan(&r.ID, &r.DrillID, &r.JobID, &r.Passed, &r.StartedAt, &r.FinishedAt, &r.DurationMs, &r.TimeToAvailableMs, &r.Error, &report); err != nil {
+			return nil, err
+		}
+		r.Report = report
+		reports = append(reports, &r)
+	}
+	return reports, rows.Err()
+}
+
+// GetLastPassedDRDrillAt returns when a drill of the DR job last passed, or
+// nil if none ever did.
+func GetLastPassedDRDrillAt(jobID string) (*time.Time, error) {
+	var finishedAt sql.NullTime
+	err := db.DB.QueryRow(`SELECT MAX(finished_at) FROM dr_drill_reports WHERE job_id = $1 AND passed`, jobID).Scan(&finishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch last passed DR drill: %w", err)
+	}
+	if !finishedAt.Valid {
+		return nil, nil
+	}
+	return &finishedAt.Time, nil
+}
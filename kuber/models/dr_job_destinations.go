@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"example.com/kuber/db"
+)
+
+// DRJobDestination is the progress of one destination of a fan-out DR job.
+type DRJobDestination struct {
+	JobID                  string           `json:"job_id"`
+	DestinationClusterID   string           `json:"destination_cluster_id"`
+	DestinationClusterName string           `json:"destination_cluster_name"`
+	State                  string           `json:"state"`
+	LastSyncAt             *time.Time       `json:"last_sync_at"`
+	LastReconcileAt        *time.Time       `json:"last_reconcile_at"`
+	ReplicationLagMs       int64            `json:"replication_lag_ms"`
+	QueueDepth             map[string]int   `json:"queue_depth"`
+	ObjectCounts           map[string]int64 `json:"object_counts"`
+	ErrorCounts            map[string]int64 `json:"error_counts"`
+	LastError              string           `json:"last_error"`
+	Conflicts              json.RawMessage  `json:"conflicts"`
+	UpdatedAt              time.Time        `json:"updated_at"`
+}
+
+// SaveDRJobDestinations records the destinations of a fan-out DR job as pending.
+func SaveDRJobDestinations(jobID string, destinationClusterIDs []string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("cannot record DR job destinations: %w", err)
+	}
+	defer tx.Rollback()
+	for _, destinationClusterID := range destinationClusterIDs {
+		_, err := tx.Exec(`INSERT INTO dr_job_destinations (job_id, destination_cluster_id) VALUES ($1, $2)`, jobID, destinationClusterID)
+		if err != nil {
+			return fmt.Errorf("cannot record DR job destination %s: %w", destinationClusterID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot record DR job destinations: %w", err)
+	}
+	return nil
+}
+
+// GetDRJobDestinations lists the destinations of a fan-out DR job; it is empty
+// for a job with a single destination.
+func GetDRJobDestinations(jobID string) ([]*DRJobDestination, error) {
+	query := `SELECT d.job_id, d.destination_cluster_id, COALESCE(c.name, ''), d.state, d.last_sync_at, d.last_reconcile_at,
+			  COALESCE(d.replication_lag_ms, 0), COALESCE(d.queue_depth, '{}'), COALESCE(d.object_counts, '{}'), COALESCE(d.error_counts, '{}'),
+			  d.last_error, COALESCE(d.conflicts, '[]'), d.updated_at
+			  FROM dr_job_destinations d
+			  LEFT JOIN clusters c ON c.id = d.destination_cluster_id
+			  WHERE d.job_id = $1 ORDER BY d.destination_cluster_id`
+	rows, err := db.DB.Query(query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR job destinations: %w", err)
+	}
+	defer rows.Close()
+
+	var destinations []*DRJobDestination
+	for rows.Next() {
+		var d DRJobDestination
+		var queueJSON, countsJSON, errorCountsJSON, conflictsJSON []byte
+		err := rows.Scan(&d.JobID, &d.DestinationClusterID, &d.DestinationClusterName, &d.State, &d.LastSyncAt, &d.LastReconcileAt,
+			&d.ReplicationLagMs, &queueJSON, &countsJSON, &errorCountsJSON, &d.LastError, &conflictsJSON, &d.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(queueJSON, &d.QueueDepth); err != nil {
+			return nil, fmt.Errorf("error unmarshaling queue depth: %w", err)
+		}
+		if err := json.Unmarshal(countsJSON, &d.ObjectCounts); err != nil {
+			return nil, fmt.Errorf("error unmarshaling object counts: %w", err)
+		}
+		if err := json.Unmarshal(errorCountsJSON, &d.ErrorCounts); err != nil {
+			return nil, fmt.Errorf("error unmarshaling error counts: %w", err)
+		}
+		d.Conflicts = conflictsJSON
+		destinations = append(destinations, &d)
+	}
+	return destinations, rows.Err()
+}
+
+// RecordDRJobDestinationProgress stores the latest progress reported for one
+// destination of a fan-out DR job.
+func RecordDRJobDestinationProgress(jobID, destinationClusterID string, progress DRJobProgress) error {
+	countsJSON, err := json.Marshal(progress.ObjectCounts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object counts: %w", err)
+	}
+	queueJSON, err := json.Marshal(progress.QueueDepth)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue depth: %w", err)
+	}
+	errorCountsJSON, err := json.Marshal(progress.ErrorCounts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal error counts: %w", err)
+	}
+	var syncedAt, reconciledAt *time.Time
+	if !progress.LastSyncAt.IsZero() {
+		syncedAt = &progress.LastSyncAt
+	}
+	if !progress.LastReconcileAt.IsZero() {
+		reconciledAt = &progress.LastReconcileAt
+	}
+	conflicts := progress.Conflicts
+	if len(conflicts) == 0 {
+		conflicts = []byte(`[]`)
+	}
+	query := `UPDATE dr_job_destinations SET state = $1, last_sync_at = COALESCE($2, last_sync_at), last_reconcile_at = COALESCE($3, last_reconcile_at),
+			  replication_lag_ms = $4, queue_depth = $5, object_counts = $6, error_counts = $7, last_error = $8, conflicts = $9, updated_at = now()
+			  WHERE job_id = $10 AND destination_cluster_id = $11`
+	_, err = db.DB.Exec(query, progress.State, syncedAt, reconciledAt, progress.ReplicationLag.Milliseconds(), queueJSON,
+		countsJSON, errorCountsJSON, progress.LastError, conflicts, jobID, destinationClusterID)
+	if err != nil {
+		return fmt.Errorf("failed to record DR job destination progress: %w", err)
+	}
+	return nil
+}
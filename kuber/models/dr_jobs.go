@@ -0,0 +1,310 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/kuber/db"
+)
+
+// DRJob is the persisted record of one disaster recovery replication. The
+// cluster IDs are empty once the cluster was deleted.
+type DRJob struct {
+	ID                     string     `json:"id"`
+	SourceClusterID        string     `json:"source_cluster_id"`
+	SourceClusterName      string     `json:"source_cluster_name"`
+	DestinationClusterID   string     `json:"destination_cluster_id"`
+	DestinationClusterName string     `json:"destination_cluster_name"`
+	DRType                 string     `json:"dr_type"`
+	State                  string     `json:"state"`
+	StartedAt              *time.Time `json:"started_at"`
+	LastSyncAt             *time.Time `json:"last_sync_at"`
+	LastReconcileAt        *time.Time `json:"last_reconcile_at"`
+	LastSourceEventAt      *time.Time `json:"last_source_event_at"`
+	// ReplicationLagMs is the age of the oldest source change not yet written
+	// to the destination.
+	ReplicationLagMs int64            `json:"replication_lag_ms"`
+	QueueDepth       map[string]int   `json:"queue_depth"`
+	ObjectCounts     map[string]int64 `json:"object_counts"`
+	ErrorCounts      map[string]int64 `json:"error_counts"`
+	// FailoverReplicas are the workload replica counts restored by the last
+	// failover, which failback restores on the original source.
+	FailoverReplicas map[string]int32 `json:"failover_replicas"`
+	LastError        string           `json:"last_error"`
+	Options          json.RawMessage  `json:"options"`
+	Conflicts        json.RawMessage  `json:"conflicts"`
+	// Destinations is filled in for a fan-out job by GetDRJobDestinations.
+	Destinations []*DRJobDestination `json:"destinations,omitempty"`
+	UserID       int64               `json:"user_id"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+const drJobColumns = `j.id, COALESCE(j.source_cluster_id, ''), COALESCE(s.name, ''), COALESCE(j.destination_cluster_id, ''), COALESCE(d.name, ''),
+	j.dr_type, j.state, j.started_at, j.last_sync_at, j.last_reconcile_at, j.last_source_event_at,
+	COALESCE(j.replication_lag_ms, 0), COALESCE(j.queue_depth, '{}'), j.object_counts, COALESCE(j.error_counts, '{}'), COALESCE(j.failover_replicas, '{}'), j.last_error, COALESCE(j.options, '{}'), COALESCE(j.conflicts, '[]'), COALESCE(j.user_id, 0), j.created_at, j.updated_at
+	FROM dr_jobs j
+	LEFT JOIN clusters s ON s.id = j.source_cluster_id
+	LEFT JOIN clusters d ON d.id = j.destination_cluster_id`
+
+func (j *DRJob) Save() error {
+	id, err := db.GetUUID()
+	if err != nil {
+		return fmt.Errorf("failed to generate UUID: %w", err)
+	}
+	j.ID = id
+	j.CreatedAt = time.Now()
+	j.UpdatedAt = j.CreatedAt
+	if j.ObjectCounts == nil {
+		j.ObjectCounts = map[string]int64{}
+	}
+	countsJSON, err := json.Marshal(j.ObjectCounts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object counts: %w", err)
+	}
+	if len(j.Options) == 0 {
+		j.Options = json.RawMessage(`{}`)
+	}
+	query := `INSERT INTO dr_jobs (id, source_cluster_id, destination_cluster_id, dr_type, state, started_at, object_counts, last_error, options, user_id, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err = db.DB.Exec(query,
+		j.ID,
+		j.SourceClusterID,
+		j.DestinationClusterID,
+		j.DRType,
+		j.State,
+		j.StartedAt,
+		countsJSON,
+		j.LastError,
+		[]byte(j.Options),
+		j.UserID,
+		j.CreatedAt,
+		j.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create DR job: %w", err)
+	}
+	return nil
+}
+
+func scanDRJob(scan func(dest ...interface{}) error) (*DRJob, error) {
+	var j DRJob
+	var queueJSON, countsJSON, errorCountsJSON, failoverJSON, optionsJSON, conflictsJSON []byte
+	err := scan(
+		&j.ID,
+		&j.SourceClusterID,
+		&j.SourceClusterName,
+		&j.DestinationClusterID,
+		&j.DestinationClusterName,
+		&j.DRType,
+		&j.State,
+		&j.StartedAt,
+		&j.LastSyncAt,
+		&j.LastReconcileAt,
+		&j.LastSourceEventAt,
+		&j.ReplicationLagMs,
+		&queueJSON,
+		&countsJSON,
+		&errorCountsJSON,
+		&failoverJSON,
+		&j.LastError,
+		&optionsJSON,
+		&conflictsJSON,
+		&j.UserID,
+		&j.CreatedAt,
+		&j.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(countsJSON) > 0 {
+		if err := json.Unmarshal(countsJSON, &j.ObjectCounts); err != nil {
+			return nil, fmt.Errorf("error unmarshaling object counts: %w", err)
+		}
+	}
+	if err := json.Unmarshal(queueJSON, &j.QueueDepth); err != nil {
+		return nil, fmt.Errorf("error unmarshaling queue depth: %w", err)
+	}
+	if err := json.Unmarshal(errorCountsJSON, &j.ErrorCounts); err != nil {
+		return nil, fmt.Errorf("error unmarshaling error counts: %w", err)
+	}
+	if err := json.Unmarshal(failoverJSON, &j.FailoverReplicas); err != nil {
+		return nil, fmt.Errorf("error unmarshaling failover replicas: %w", err)
+	}
+	j.Options = optionsJSON
+	j.Conflicts = conflictsJSON
+	return &j, nil
+}
+
+func GetDRJobs() ([]*DRJob, error) {
+	rows, err := db.DB.Query(`SELECT ` + drJobColumns + ` ORDER BY j.created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*DRJob
+	for rows.Next() {
+		job, err := scanDRJob(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetDRJobByID returns nil without an error when the job does not exist.
+func GetDRJobByID(id string) (*DRJob, error) {
+	row := db.DB.QueryRow(`SELECT `+drJobColumns+` WHERE j.id = $1`, id)
+	job, err := scanDRJob(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR job: %w", err)
+	}
+	return job, nil
+}
+
+func UpdateDRJobState(id, state, lastError string) error {
+	query := `UPDATE dr_jobs SET state = $1, last_error = $2, updated_at = now() WHERE id = $3`
+	_, err := db.DB.Exec(query, state, lastError, id)
+	if err != nil {
+		return fmt.Errorf("failed to update DR job state: %w", err)
+	}
+	return nil
+}
+
+// FailInterruptedDRJobs marks the DR jobs whose session a server restart cut
+// short as failed, together with their destinations, and returns their IDs.
+// Failed-over jobs are kept: failover already finished and failback does not
+// need the session.
+func FailInterruptedDRJobs() ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cannot fail interrupted DR jobs: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`UPDATE dr_job_destinations SET state = 'Failed', last_error = 'interrupted by a server restart', updated_at = now()
+		WHERE job_id IN (SELECT id FROM dr_jobs WHERE state NOT IN ('Stopped', 'Failed', 'FailedOver'))`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fail interrupted DR job destinations: %w", err)
+	}
+	rows, err := tx.Query(`UPDATE dr_jobs SET state = 'Failed', last_error = 'interrupted by a server restart', updated_at = now()
+		WHERE state NOT IN ('Stopped', 'Failed', 'FailedOver') RETURNING id`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fail interrupted DR jobs: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("cannot fail interrupted DR jobs: %w", err)
+	}
+	return ids, nil
+}
+
+// DRJobProgress is the replication progress a running DR session reports.
+type DRJobProgress struct {
+	State             string
+	LastSyncAt        time.Time
+	LastReconcileAt   time.Time
+	LastSourceEventAt time.Time
+	ReplicationLag    time.Duration
+	QueueDepth        map[string]int
+	ObjectCounts      map[string]int64
+	ErrorCounts       map[string]int64
+	// FailoverReplicas is left unchanged when empty.
+	FailoverReplicas map[string]int32
+	LastError        string
+	// Conflicts is the JSON encoded list of unresolved field ownership conflicts.
+	Conflicts []byte
+}
+
+// RecordDRJobProgress stores the latest replication progress reported for a job.
+func RecordDRJobProgress(id string, progress DRJobProgress) error {
+	countsJSON, err := json.Marshal(progress.ObjectCounts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object counts: %w", err)
+	}
+	queueJSON, err := json.Marshal(progress.QueueDepth)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue depth: %w", err)
+	}
+	errorCountsJSON, err := json.Marshal(progress.ErrorCounts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal error counts: %w", err)
+	}
+	var failoverJSON interface{}
+	if len(progress.FailoverReplicas) > 0 {
+		encoded, err := json.Marshal(progress.FailoverReplicas)
+		if err != nil {
+			return fmt.Errorf("failed to marshal failover replicas: %w", err)
+		}
+		failoverJSON = encoded
+	}
+	var syncedAt, reconciledAt, sourceEventAt *time.Time
+	if !progress.LastSyncAt.IsZero() {
+		syncedAt = &progress.LastSyncAt
+	}
+	if !progress.LastReconcileAt.IsZero() {
+		reconciledAt = &progress.LastReconcileAt
+	}
+	if !progress.LastSourceEventAt.IsZero() {
+		sourceEventAt = &progress.LastSourceEventAt
+	}
+	conflicts := progress.Conflicts
+	if len(conflicts) == 0 {
+		conflicts = []byte(`[]`)
+	}
+	query := `UPDATE dr_jobs SET state = $1, last_sync_at = COALESCE($2, last_sync_at), last_reconcile_at = COALESCE($3, last_reconcile_at),
+			  last_source_event_at = COALESCE($4, last_source_event_at), replication_lag_ms = $5, queue_depth = $6,
+			  object_counts = $7, error_counts = $8, last_error = $9, conflicts = $10, failover_replicas = COALESCE($11, failover_replicas),
+			  updated_at = now() WHERE id = $12`
+	_, err = db.DB.Exec(query, progress.State, syncedAt, reconciledAt, sourceEventAt, progress.ReplicationLag.Milliseconds(), queueJSON,
+		countsJSON, errorCountsJSON, progress.LastError, conflicts, failoverJSON, id)
+	if err != nil {
+		return fmt.Errorf("failed to record DR job progress: %w", err)
+	}
+	return nil
+}
+
+// GetActiveDRJobsForCluster lists the DR jobs that still replicate from or to
+// a cluster, as its source or as any of its destinations. Stopped and failed
+// jobs are left out.
+func GetActiveDRJobsForCluster(clusterID string) ([]*DRJob, error) {
+	query := `SELECT ` + drJobColumns + `
+		WHERE j.state NOT IN ('Stopped', 'Failed')
+		AND (j.source_cluster_id = $1 OR j.destination_cluster_id = $1
+			OR EXISTS (SELECT 1 FROM dr_job_destinations jd WHERE jd.job_id = j.id AND jd.destination_cluster_id = $1))
+		ORDER BY j.created_at`
+	rows, err := db.DB.Query(query, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR jobs of cluster: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*DRJob
+	for rows.Next() {
+		job, err := scanDRJob(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
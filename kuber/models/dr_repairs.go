@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"example.com/kuber/db"
+)
+
+// DRRepair is the audit record of one drifted destination object that a DR
+// reconciliation put back in line with the source.
+type DRRepair struct {
+	ID         int64           `json:"id"`
+	JobID      string          `json:"job_id"`
+	Resource   string          `json:"resource"`
+	Namespace  string          `json:"namespace"`
+	Name       string          `json:"name"`
+	Action     string          `json:"action"`
+	Changes    json.RawMessage `json:"changes"`
+	RepairedAt time.Time       `json:"repaired_at"`
+}
+
+func (r *DRRepair) Save() error {
+	if len(r.Changes) == 0 {
+		r.Changes = json.RawMessage(`[]`)
+	}
+	query := `INSERT INTO dr_repairs (job_id, resource, namespace, name, action, changes, repaired_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := db.DB.QueryRow(query, r.JobID, r.Resource, r.Namespace, r.Name, r.Action, []byte(r.Changes), r.RepairedAt).Scan(&r.ID)
+	if err != nil {
+		return fmt.Errorf("cannot record DR repair: %w", err)
+	}
+	return nil
+}
+
+// GetDRRepairs returns the latest repairs of a DR job, newest first.
+func GetDRRepairs(jobID string, limit int) ([]*DRRepair, error) {
+	query := `SELECT id, job_id, resource, namespace, name, action, COALESCE(changes, '[]'), repaired_at
+			  FROM dr_repairs WHERE job_id = $1 ORDER BY repaired_at DESC, id DESC LIMIT $2`
+	rows, err := db.DB.Query(query, jobID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR repairs: %w", err)
+	}
+	defer rows.Close()
+
+	var repairs []*DRRepair
+	for rows.Next() {
+		var r DRRepair
+		var changes []byte
+		if err := rows.Scan(&r.ID, &r.JobID, &r.Resource, &r.Namespace, &r.Name, &r.Action, &changes, &r.RepairedAt); err != nil {
+			return nil, err
+		}
+		r.Changes = changes
+		repairs = append(repairs, &r)
+	}
+	return repairs, rows.Err()
+}
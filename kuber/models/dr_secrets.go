@@ -0,0 +1,152 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/kuber/db"
+)
+
+// DRSecretOverride replaces the value of one key of a replicated Secret on a
+// destination cluster. The value is never returned by the API.
+type DRSecretOverride struct {
+	ID        int64     `json:"id"`
+	ClusterID string    `json:"cluster_id"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Key       string    `json:"key"`
+	Value     string    `json:"-"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Save stores the override, replacing the value of an existing override of
+// the same key.
+func (o *DRSecretOverride) Save() error {
+	query := `INSERT INTO dr_secret_overrides (cluster_id, namespace, name, key, value, user_id)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  ON CONFLICT (cluster_id, namespace, name, key) DO UPDATE SET value = EXCLUDED.value, user_id = EXCLUDED.user_id, updated_at = now()
+			  RETURNING id, created_at, updated_at`
+	err := db.DB.QueryRow(query, o.ClusterID, o.Namespace, o.Name, o.Key, o.Value, o.UserID).Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("cannot record DR secret override: %w", err)
+	}
+	return nil
+}
+
+// GetDRSecretOverrides lists the overrides of a destination cluster.
+func GetDRSecretOverrides(clusterID string) ([]*DRSecretOverride, error) {
+	query := `SELECT id, cluster_id, namespace, name, key, COALESCE(user_id, 0), created_at, updated_at
+			  FROM dr_secret_overrides WHERE cluster_id = $1 ORDER BY namespace, name, key`
+	rows, err := db.DB.Query(query, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR secret overrides: %w", err)
+	}
+	defer rows.Close()
+
+	var overrides []*DRSecretOverride
+	for rows.Next() {
+		var o DRSecretOverride
+		if err := rows.Scan(&o.ID, &o.ClusterID, &o.Namespace, &o.Name, &o.Key, &o.UserID, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, &o)
+	}
+	return overrides, rows.Err()
+}
+
+// GetDRSecretOverrideValues returns the override values of one Secret on a
+// destination cluster, by key.
+func GetDRSecretOverrideValues(clusterID, namespace, name string) (map[string][]byte, error) {
+	query := `SELECT key, value FROM dr_secret_overrides WHERE cluster_id = $1 AND namespace = $2 AND name = $3`
+	rows, err := db.DB.Query(query, clusterID, namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR secret overrides: %w", err)
+	}
+	defer rows.Close()
+
+	values := map[string][]byte{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = []byte(value)
+	}
+	return values, rows.Err()
+}
+
+// DeleteDRSecretOverride removes an override of a cluster and reports whether
+// there was one.
+func DeleteDRSecretOverride(clusterID string, id int64) (bool, error) {
+	var deleted int64
+	err := db.DB.QueryRow(`DELETE FROM dr_secret_overrides WHERE cluster_id = $1 AND id = $2 RETURNING id`, clusterID, id).Scan(&deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete DR secret override: %w", err)
+	}
+	return true, nil
+}
+
+// DRSecretTransfer is the audit record of what a DR job did with one Secret on
+// a destination cluster.
+type DRSecretTransfer struct {
+	ID             int64     `json:"id"`
+	JobID          string    `json:"job_id"`
+	ClusterID      string    `json:"cluster_id"`
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	SecretType     string    `json:"secret_type"`
+	Action         string    `json:"action"`
+	OverriddenKeys []string  `json:"overridden_keys"`
+	TransferredAt  time.Time `json:"transferred_at"`
+}
+
+func (t *DRSecretTransfer) Save() error {
+	if t.OverriddenKeys == nil {
+		t.OverriddenKeys = []string{}
+	}
+	keysJSON, err := json.Marshal(t.OverriddenKeys)
+	if err != nil {
+		return fmt.Errorf("failed to marshal overridden keys: %w", err)
+	}
+	query := `INSERT INTO dr_secret_transfers (job_id, cluster_id, namespace, name, secret_type, action, overridden_keys, transferred_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	err = db.DB.QueryRow(query, t.JobID, t.ClusterID, t.Namespace, t.Name, t.SecretType, t.Action, keysJSON, t.TransferredAt).Scan(&t.ID)
+	if err != nil {
+		return fmt.Errorf("cannot record DR secret transfer: %w", err)
+	}
+	return nil
+}
+
+// GetDRSecretTransfers returns the latest Secret transfers of a DR job, newest
+// first.
+func GetDRSecretTransfers(jobID string, limit int) ([]*DRSecretTransfer, error) {
+	query := `SELECT id, job_id, cluster_id, namespace, name, secret_type, action, COALESCE(overridden_keys, '[]'), transferred_at
+			  FROM dr_secret_transfers WHERE job_id = $1 ORDER BY transferred_at DESC, id DESC LIMIT $2`
+	rows, err := db.DB.Query(query, jobID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch DR secret transfers: %w", err)
+	}
+	defer rows.Close()
+
+	var transfers []*DRSecretTransfer
+	for rows.Next() {
+		var t DRSecretTransfer
+		var keysJSON []byte
+		if err := rows.Scan(&t.ID, &t.JobID, &t.ClusterID, &t.Namespace, &t.Name, &t.SecretType, &t.Action, &keysJSON, &t.TransferredAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(keysJSON, &t.OverriddenKeys); err != nil {
+			return nil, fmt.Errorf("error unmarshaling overridden keys: %w", err)
+		}
+		transfers = append(transfers, &t)
+	}
+	return transfers, rows.Err()
+}
@@ -2,55 +2,45 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
-func GetKubeClient(kubeconfigPath string) (*kubernetes.Clientset, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	if err != nil {
-		fmt.Printf("Failed to load kubeconfig: %v\n", err)
-		return nil, err
-	}
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		fmt.Printf("Failed to create Kubernetes client: %v\n", err)
-		return nil, err
-	}
-	return clientset, nil
-}
-
-func GetMetricClient(kubeconfigPath string) (*versioned.Clientset, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	if err != nil {
-		fmt.Printf("Failed to load kubeconfig: %v\n", err)
-		return nil, err
-	}
-	metricClientset, err := versioned.NewForConfig(config)
-	if err != nil {
-		fmt.Printf("Failed to create Kubernetes metric client: %v\n", err)
-		return nil, err
-	}
-	return metricClientset, nil
-}
+const (
+	// clusterDetailsTimeout bounds fetching the details of one cluster, so an
+	// unreachable cluster does not hold up a listing.
+	clusterDetailsTimeout = 5 * time.Second
+	// clusterDetailsWorkers bounds the clusters a listing contacts at once.
+	clusterDetailsWorkers = 8
+)
 
-func fetchClusterDetailsFromKubeconfig(kubeconfigPath string) (controlPlanes []interface{}, workerNodes []interface{}, storageContainers []interface{}) {
-	clientset, err := GetKubeClient(kubeconfigPath)
+// fetchClusterDetails lists the nodes and PVCs of a cluster. reachable tells
+// whether its API server answered and error why details are missing.
+func fetchClusterDetails(clusterID string) map[string]interface{} {
+	details := map[string]interface{}{"reachable": false, "error": ""}
+	clients, err := GetClusterClients(clusterID)
 	if err != nil {
-		fmt.Printf("Failed to create Kubernetes client: %v\n", err)
-		return
+		details["error"] = "failed to create Kubernetes client: " + err.Error()
+		return details
 	}
-	ctx := context.Background()
-	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), clusterDetailsTimeout)
+	defer cancel()
+	nodes, err := clients.Kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Printf("Failed to list nodes: %v\n", err)
-		return
-	}
+		// An API error, e.g. Forbidden, still means the cluster answered.
+		var status apierrors.APIStatus
+		details["reachable"] = errors.As(err, &status)
+		details["error"] = "failed to list nodes: " + err.Error()
+		return details
+	}
+	details["reachable"] = true
+	controlPlanes, workerNodes := []interface{}{}, []interface{}{}
 	for _, node := range nodes.Items {
 		nodeInfo := map[string]string{
 			"name":   node.Name,
@@ -63,11 +53,14 @@ func fetchClusterDetailsFromKubeconfig(kubeconfigPath string) (controlPlanes []i
 			workerNodes = append(workerNodes, nodeInfo)
 		}
 	}
-	pvcs, err := clientset.CoreV1().PersistentVolumeClaims("").List(ctx, metav1.ListOptions{})
+	details["control_planes"] = controlPlanes
+	details["worker_nodes"] = workerNodes
+	pvcs, err := clients.Kube.CoreV1().PersistentVolumeClaims("").List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Printf("Failed to list PVCs: %v\n", err)
-		return
+		details["error"] = "failed to list PVCs: " + err.Error()
+		return details
 	}
+	storageContainers := []interface{}{}
 	for _, pvc := range pvcs.Items {
 		pvcInfo := map[string]string{
 			"name":   pvc.Name,
@@ -75,8 +68,31 @@ func fetchClusterDetailsFromKubeconfig(kubeconfigPath string) (controlPlanes []i
 		}
 		storageContainers = append(storageContainers, pvcInfo)
 	}
+	details["storage_containers"] = storageContainers
+	return details
+}
 
-	return
+// fetchAllClusterDetails fetches the details of several clusters
+// concurrently and returns them in the order of ids.
+func fetchAllClusterDetails(ids []string) []map[string]interface{} {
+	details := make([]map[string]interface{}, len(ids))
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	for i := 0; i < clusterDetailsWorkers && i < len(ids); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range queue {
+				details[index] = fetchClusterDetails(ids[index])
+			}
+		}()
+	}
+	for index := range ids {
+		queue <- index
+	}
+	close(queue)
+	wg.Wait()
+	return details
 }
 
 func isControlPlaneNode(node v1.Node) bool {
@@ -99,20 +115,11 @@ func getNodeReadyStatus(node v1.Node) v1.ConditionStatus {
 
 func GetServices(clusterID string) ([]map[string]interface{}, error) {
 
-	kubeconfigFilePath, err := GetKubeconfigFilePathByID(clusterID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get kubeconfig file path: %w", err)
-	}
-
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
+	clients, err := GetClusterClients(clusterID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+		return nil, err
 	}
+	clientset := clients.Kube
 
 	ctx := context.Background()
 	services, err := clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
@@ -138,20 +145,11 @@ func GetServices(clusterID string) ([]map[string]interface{}, error) {
 }
 
 func GetNamespaces(clusterID string) ([]string, error) {
-	kubeconfigFilePath, err := GetKubeconfigFilePathByID(clusterID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get kubeconfig file path: %w", err)
-	}
-
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigFilePath)
+	clients, err := GetClusterClients(clusterID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+		return nil, err
 	}
+	clientset := clients.Kube
 
 	ctx := context.Background()
 	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
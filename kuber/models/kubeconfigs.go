@@ -0,0 +1,161 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"example.com/kuber/Utils"
+	"example.com/kuber/db"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// NormalizeKubeconfig validates an uploaded kubeconfig with clientcmd.Load
+// and reduces it to its current context. Certificates and keys must be
+// embedded, since no file on the kuber host is read once it is stored.
+func NormalizeKubeconfig(data []byte) ([]byte, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	return normalizeKubeconfig(config)
+}
+
+func normalizeKubeconfig(config *clientcmdapi.Config) ([]byte, error) {
+	if err := clientcmdapi.MinifyConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	for name, cluster := range config.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return nil, fmt.Errorf("invalid kubeconfig: cluster %s refers to certificate file %s; embed it with kubectl config view --minify --flatten", name, cluster.CertificateAuthority)
+		}
+	}
+	for name, user := range config.AuthInfos {
+		if user.ClientCertificate != "" || user.ClientKey != "" || user.TokenFile != "" {
+			return nil, fmt.Errorf("invalid kubeconfig: user %s refers to credential files; embed them with kubectl config view --minify --flatten", name)
+		}
+	}
+	if _, err := clientcmd.NewDefaultClientConfig(*config, nil).ClientConfig(); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	return clientcmd.Write(*config)
+}
+
+// ReadKubeconfigFile loads a kubeconfig from the kuber host, embedding the
+// files it refers to, so that it can be stored like an uploaded one.
+func ReadKubeconfigFile(path string) ([]byte, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kubeconfig %s: %w", path, err)
+	}
+	if err := clientcmdapi.MinifyConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %w", path, err)
+	}
+	if err := clientcmdapi.FlattenConfig(config); err != nil {
+		return nil, fmt.Errorf("cannot embed the files of kubeconfig %s: %w", path, err)
+	}
+	return normalizeKubeconfig(config)
+}
+
+// SetClusterKubeconfig encrypts a normalized kubeconfig and stores it with
+// the cluster.
+func SetClusterKubeconfig(clusterID string, kubeconfig []byte) error {
+	encrypted, err := Utils.Encrypt(kubeconfig, []byte(clusterID))
+	if err != nil {
+		return fmt.Errorf("cannot encrypt kubeconfig: %w", err)
+	}
+	result, err := db.DB.Exec(`UPDATE clusters SET kubeconfig_data = $1, updated_at = now() WHERE id = $2`, encrypted, clusterID)
+	if err != nil {
+		return fmt.Errorf("cannot store kubeconfig: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrClusterNotFound
+	}
+	InvalidateClusterClients(clusterID)
+	return nil
+}
+
+// GetKubeconfigByID returns the kubeconfig of a cluster. A cluster registered
+// before kubeconfigs were stored in the database, and not imported yet, is
+// read from its kubeconfig path.
+func GetKubeconfigByID(id string) ([]byte, error) {
+	path, encrypted, err := storedKubeconfig(id)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKubeconfig(id, path, encrypted)
+}
+
+// storedKubeconfig returns the kubeconfig path and encrypted kubeconfig of a
+// cluster as stored.
+func storedKubeconfig(id string) (string, []byte, error) {
+	var path string
+	var encrypted []byte
+	err := db.DB.QueryRow(`SELECT kubeconfig, kubeconfig_data FROM clusters WHERE id = $1`, id).Scan(&path, &encrypted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, ErrClusterNotFound
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot fetch kubeconfig: %w", err)
+	}
+	return path, encrypted, nil
+}
+
+func decodeKubeconfig(id, path string, encrypted []byte) ([]byte, error) {
+	if encrypted != nil {
+		kubeconfig, err := Utils.Decrypt(encrypted, []byte(id))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt kubeconfig: %w", err)
+		}
+		return kubeconfig, nil
+	}
+	if path == "" {
+		return nil, errors.New("cluster has no kubeconfig")
+	}
+	return ReadKubeconfigFile(path)
+}
+
+// ImportKubeconfigFiles stores the kubeconfig files of the clusters
+// registered by path in the database. The path is kept as a record of where
+// the kubeconfig came from. It returns the clusters imported and why the
+// others could not be.
+func ImportKubeconfigFiles() ([]string, map[string]error, error) {
+	rows, err := db.DB.Query(`SELECT id, kubeconfig FROM clusters WHERE kubeconfig_data IS NULL AND kubeconfig <> ''`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot fetch clusters to import: %w", err)
+	}
+	paths := map[string]string{}
+	for rows.Next() {
+		var id, path string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		paths[id] = path
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var imported []string
+	failed := map[string]error{}
+	for id, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			failed[id] = err
+			continue
+		}
+		kubeconfig, err := ReadKubeconfigFile(path)
+		if err == nil {
+			err = SetClusterKubeconfig(id, kubeconfig)
+		}
+		if err != nil {
+			failed[id] = err
+			continue
+		}
+		imported = append(imported, id)
+	}
+	return imported, failed, nil
+}
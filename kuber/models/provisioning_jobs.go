@@ -0,0 +1,179 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/kuber/db"
+)
+
+// States of a provisioning job.
+const (
+	ProvisioningRunning   = "Running"
+	ProvisioningSucceeded = "Succeeded"
+	ProvisioningFailed    = "Failed"
+)
+
+// Actions a provisioning job performs on its cluster.
+const (
+	ProvisioningCreate = "create"
+	ProvisioningDelete = "delete"
+)
+
+// ProvisioningJob is the record of one background run that creates or
+// deletes a cluster. Its log is only stored once the job ends.
+type ProvisioningJob struct {
+	ID          string `json:"id"`
+	ClusterID   string `json:"cluster_id"`
+	ClusterName string `json:"cluster_name"`
+	Provisioner string `json:"provisioner"`
+	Action      string `json:"action"`
+	// Spec is the provisioner.ClusterSpec the job ran with.
+	Spec       json.RawMessage `json:"spec"`
+	State      string          `json:"state"`
+	Error      string          `json:"error"`
+	UserID     int64           `json:"user_id"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at"`
+}
+
+func (j *ProvisioningJob) Save() error {
+	id, err := db.GetUUID()
+	if err != nil {
+		return fmt.Errorf("failed to generate UUID: %w", err)
+	}
+	j.ID = id
+	j.State = ProvisioningRunning
+	j.StartedAt = time.Now()
+	if len(j.Spec) == 0 {
+		j.Spec = json.RawMessage(`{}`)
+	}
+	query := `INSERT INTO provisioning_jobs (id, cluster_id, cluster_name, provisioner, action, spec, state, user_id, started_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err = db.DB.Exec(query, j.ID, j.ClusterID, j.ClusterName, j.Provisioner, j.Action, []byte(j.Spec), j.State, j.UserID, j.StartedAt)
+	if err != nil {
+		return fmt.Errorf("cannot record provisioning job: %w", err)
+	}
+	return nil
+}
+
+// FinishProvisioningJob stores the outcome and the full log of a job.
+func FinishProvisioningJob(id, state, logs, lastError string) error {
+	query := `UPDATE provisioning_jobs SET state = $1, logs = $2, error = $3, finished_at = now() WHERE id = $4`
+	_, err := db.DB.Exec(query, state, logs, lastError, id)
+	if err != nil {
+		return fmt.Errorf("failed to finish provisioning job: %w", err)
+	}
+	return nil
+}
+
+const provisioningJobColumns = `id, cluster_id, cluster_name, provisioner, action, COALESCE(spec, '{}'), state, error, COALESCE(user_id, 0), started_at, finished_at`
+
+func scanProvisioningJob(scan func(dest ...interface{}) error) (*ProvisioningJob, error) {
+	var j ProvisioningJob
+	var specJSON []byte
+	err := scan(&j.ID, &j.ClusterID, &j.ClusterName, &j.Provisioner, &j.Action, &specJSON, &j.State, &j.Error, &j.UserID, &j.StartedAt, &j.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	j.Spec = specJSON
+	return &j, nil
+}
+
+// GetProvisioningJobByID returns nil without an error when the job does not
+// exist.
+func GetProvisioningJobByID(id string) (*ProvisioningJob, error) {
+	job, err := scanProvisioningJob(db.DB.QueryRow(`SELECT `+provisioningJobColumns+` FROM provisioning_jobs WHERE id = $1`, id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch provisioning job: %w", err)
+	}
+	return job, nil
+}
+
+// GetProvisioningJobs lists the provisioning jobs of a cluster, newest first.
+func GetProvisioningJobs(clusterID string) ([]*ProvisioningJob, error) {
+	rows, err := db.DB.Query(`SELECT `+provisioningJobColumns+` FROM provisioning_jobs WHERE cluster_id = $1 ORDER BY started_at DESC`, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch provisioning jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*ProvisioningJob
+	for rows.Next() {
+		job, err := scanProvisioningJob(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetRunningProvisioningJob returns the job still creating or deleting a
+// cluster, or nil when there is none.
+func GetRunningProvisioningJob(clusterID string) (*ProvisioningJob, error) {
+	query := `SELECT ` + provisioningJobColumns + ` FROM provisioning_jobs WHERE cluster_id = $1 AND state = $2
+			  ORDER BY started_at DESC LIMIT 1`
+	job, err := scanProvisioningJob(db.DB.QueryRow(query, clusterID, ProvisioningRunning).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch running provisioning job: %w", err)
+	}
+	return job, nil
+}
+
+// GetClusterProvisioningSpec returns the spec a cluster was created with, or
+// nil when kuber did not provision it.
+func GetClusterProvisioningSpec(clusterID string) (json.RawMessage, error) {
+	var spec []byte
+	query := `SELECT COALESCE(spec, '{}') FROM provisioning_jobs WHERE cluster_id = $1 AND action = $2 AND state = $3
+			  ORDER BY started_at DESC LIMIT 1`
+	err := db.DB.QueryRow(query, clusterID, ProvisioningCreate, ProvisioningSucceeded).Scan(&spec)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch cluster provisioning spec: %w", err)
+	}
+	return spec, nil
+}
+
+// GetProvisioningJobLogs returns the stored log of a job that has ended.
+func GetProvisioningJobLogs(id string) (string, error) {
+	var logs string
+	err := db.DB.QueryRow(`SELECT logs FROM provisioning_jobs WHERE id = $1`, id).Scan(&logs)
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch provisioning job logs: %w", err)
+	}
+	return logs, nil
+}
+
+// FailInterruptedProvisioningJobs marks the jobs a server restart cut short as
+// failed and returns them.
+func FailInterruptedProvisioningJobs() ([]*ProvisioningJob, error) {
+	query := `UPDATE provisioning_jobs SET state = $1, error = 'interrupted by a server restart', finished_at = now()
+			  WHERE state = $2 RETURNING ` + provisioningJobColumns
+	rows, err := db.DB.Query(query, ProvisioningFailed, ProvisioningRunning)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fail interrupted provisioning jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*ProvisioningJob
+	for rows.Next() {
+		job, err := scanProvisioningJob(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/kuber/db"
+)
+
+// Snapshot is the record of one point-in-time archive of a cluster.
+type Snapshot struct {
+	ID            string          `json:"id"`
+	ClusterID     string          `json:"cluster_id"`
+	ClusterName   string          `json:"cluster_name"`
+	Store         string          `json:"store"`
+	ObjectKey     string          `json:"object_key"`
+	SizeBytes     int64           `json:"size_bytes"`
+	FormatVersion int             `json:"format_version"`
+	ObjectCounts  map[string]int  `json:"object_counts"`
+	Options       json.RawMessage `json:"options"`
+	UserID        int64           `json:"user_id"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+const snapshotColumns = `id, cluster_id, cluster_name, store, object_key, size_bytes, format_version, object_counts, COALESCE(options, '{}'), COALESCE(user_id, 0), created_at
+	FROM snapshots`
+
+func (s *Snapshot) Save() error {
+	// The ID may be set beforehand so it can be part of the object key.
+	if s.ID == "" {
+		id, err := db.GetUUID()
+		if err != nil {
+			return fmt.Errorf("failed to generate UUID: %w", err)
+		}
+		s.ID = id
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	if s.ObjectCounts == nil {
+		s.ObjectCounts = map[string]int{}
+	}
+	countsJSON, err := json.Marshal(s.ObjectCounts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object counts: %w", err)
+	}
+	if len(s.Options) == 0 {
+		s.Options = json.RawMessage(`{}`)
+	}
+	query := `INSERT INTO snapshots (id, cluster_id, cluster_name, store, object_key, size_bytes, format_version, object_counts, options, user_id, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err = db.DB.Exec(query,
+		s.ID,
+		s.ClusterID,
+		s.ClusterName,
+		s.Store,
+		s.ObjectKey,
+		s.SizeBytes,
+		s.FormatVersion,
+		countsJSON,
+		[]byte(s.Options),
+		s.UserID,
+		s.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create snapshot: %w", err)
+	}
+	return nil
+}
+
+func scanSnapshot(scan func(dest ...interface{}) error) (*Snapshot, error) {
+	var s Snapshot
+	var countsJSON, optionsJSON []byte
+	err := scan(
+		&s.ID,
+		&s.ClusterID,
+		&s.ClusterName,
+		&s.Store,
+		&s.ObjectKey,
+		&s.SizeBytes,
+		&s.FormatVersion,
+		&countsJSON,
+		&optionsJSON,
+		&s.UserID,
+		&s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(countsJSON) > 0 {
+		if err := json.Unmarshal(countsJSON, &s.ObjectCounts); err != nil {
+			return nil, fmt.Errorf("error unmarshaling object counts: %w", err)
+		}
+	}
+	s.Options = optionsJSON
+	return &s, nil
+}
+
+// GetSnapshots lists the snapshots of one cluster, or of every cluster when
+// clusterID is empty, newest first.
+func GetSnapshots(clusterID string) ([]*Snapshot, error) {
+	rows, err := db.DB.Query(`SELECT `+snapshotColumns+` WHERE $1 = '' OR cluster_id = $1 ORDER BY created_at DESC`, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*Snapshot
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// GetSnapshotByID returns nil without an error when the snapshot does not exist.
+func GetSnapshotByID(id string) (*Snapshot, error) {
+	row := db.DB.QueryRow(`SELECT `+snapshotColumns+` WHERE id = $1`, id)
+	snapshot, err := scanSnapshot(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+func DeleteSnapshot(id string) error {
+	_, err := db.DB.Exec(`DELETE FROM snapshots WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	return nil
+}
@@ -372,19 +372,11 @@ func GetClustersByWorkspaceID(workspaceID string) ([]*Cluster, error) {
 }
 
 func CalculateClusterResourceUsage(clusterID string) (*kubernetes.Clientset, *versioned.Clientset, error) {
-	path, err := GetKubeconfigFilePathByID(clusterID)
-	if err != nil {
-		return nil, nil, fmt.Errorf("cannot fetch kubeconfig clientset: %w", err)
-	}
-	clientSet, err := GetKubeClient(path)
+	clients, err := GetClusterClients(clusterID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot create clientset: %w", err)
 	}
-	metricSet, err := GetMetricClient(path)
-	if err != nil {
-		return nil, nil, fmt.Errorf("cannot create metricset: %w", err)
-	}
-	return clientSet, metricSet, nil
+	return clients.Kube, clients.Metrics, nil
 }
 
 func GetClusterResourceUsage(clusterID string, clientset *kubernetes.Clientset, metricsClient *versioned.Clientset) (*ResourceUsage, error) {
@@ -0,0 +1,166 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// FakeOptions are the options of a Fake cluster spec.
+type FakeOptions struct {
+	// Delay is how long Create, Delete and Scale take, e.g. "2s".
+	Delay string `json:"delay"`
+	// Fail makes Create fail, to exercise failed provisioning.
+	Fail bool `json:"fail"`
+}
+
+// Fake keeps its clusters in memory. Nothing is provisioned, which makes it
+// suitable for tests and for trying the provisioning flow. It is registered
+// as "fake" only when KUBER_FAKE_PROVISIONER is set.
+type Fake struct {
+	mu       sync.Mutex
+	clusters map[string]int
+}
+
+func init() {
+	if os.Getenv("KUBER_FAKE_PROVISIONER") != "" {
+		Register(NewFake())
+	}
+}
+
+func NewFake() *Fake {
+	return &Fake{clusters: map[string]int{}}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) options(spec ClusterSpec) (FakeOptions, time.Duration, error) {
+	var options FakeOptions
+	if err := decodeOptions(spec, &options); err != nil {
+		return options, 0, err
+	}
+	var delay time.Duration
+	if options.Delay != "" {
+		var err error
+		if delay, err = time.ParseDuration(options.Delay); err != nil {
+			return options, 0, fmt.Errorf("invalid delay %q: %w", options.Delay, err)
+		}
+	}
+	return options, delay, nil
+}
+
+func (f *Fake) Validate(spec ClusterSpec) error {
+	if spec.Name == "" {
+		return fmt.Errorf("cluster name is required")
+	}
+	if spec.Workers < 0 {
+		return fmt.Errorf("workers cannot be negative")
+	}
+	_, _, err := f.options(spec)
+	return err
+}
+
+func (f *Fake) wait(ctx context.Context, delay time.Duration) error {
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *Fake) Create(ctx context.Context, spec ClusterSpec, logs io.Writer) error {
+	options, delay, err := f.options(spec)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(logs, "Creating fake cluster %s with %d workers\n", spec.Name, spec.Workers)
+	if err := f.wait(ctx, delay); err != nil {
+		return err
+	}
+	if options.Fail {
+		return fmt.Errorf("fake cluster %s failed to provision", spec.Name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clusters[spec.Name]; ok {
+		return fmt.Errorf("fake cluster %s already exists", spec.Name)
+	}
+	f.clusters[spec.Name] = spec.Workers
+	fmt.Fprintf(logs, "Fake cluster %s created\n", spec.Name)
+	return nil
+}
+
+func (f *Fake) Delete(ctx context.Context, spec ClusterSpec, logs io.Writer) error {
+	_, delay, err := f.options(spec)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(logs, "Deleting fake cluster %s\n", spec.Name)
+	if err := f.wait(ctx, delay); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clusters[spec.Name]; !ok {
+		return fmt.Errorf("fake cluster %s does not exist", spec.Name)
+	}
+	delete(f.clusters, spec.Name)
+	return nil
+}
+
+func (f *Fake) Scale(ctx context.Context, spec ClusterSpec, workers int, logs io.Writer) error {
+	_, delay, err := f.options(spec)
+	if err != nil {
+		return err
+	}
+	if workers < 0 {
+		return fmt.Errorf("workers cannot be negative")
+	}
+	fmt.Fprintf(logs, "Scaling fake cluster %s to %d workers\n", spec.Name, workers)
+	if err := f.wait(ctx, delay); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clusters[spec.Name]; !ok {
+		return fmt.Errorf("fake cluster %s does not exist", spec.Name)
+	}
+	f.clusters[spec.Name] = workers
+	return nil
+}
+
+// GetKubeconfig returns a well-formed kubeconfig whose server does not
+// exist, so a fake cluster is reported as unreachable once probed.
+func (f *Fake) GetKubeconfig(ctx context.Context, spec ClusterSpec) ([]byte, error) {
+	f.mu.Lock()
+	_, ok := f.clusters[spec.Name]
+	f.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("fake cluster %s does not exist", spec.Name)
+	}
+	name := "fake-" + spec.Name
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion":      "v1",
+		"kind":            "Config",
+		"current-context": name,
+		"clusters":        []interface{}{map[string]interface{}{"name": name, "cluster": map[string]interface{}{"server": "https://" + spec.Name + ".fake.invalid:6443"}}},
+		"users":           []interface{}{map[string]interface{}{"name": name, "user": map[string]interface{}{"token": "fake"}}},
+		"contexts":        []interface{}{map[string]interface{}{"name": name, "context": map[string]interface{}{"cluster": name, "user": name}}},
+	})
+}
+
+// Workers returns the worker count of a fake cluster and whether it exists.
+func (f *Fake) Workers(name string) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	workers, ok := f.clusters[name]
+	return workers, ok
+}
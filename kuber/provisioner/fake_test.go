@@ -0,0 +1,113 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestFakeValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    ClusterSpec
+		wantErr bool
+	}{
+		{name: "valid", spec: ClusterSpec{Name: "a", Workers: 2}},
+		{name: "with options", spec: ClusterSpec{Name: "a", Options: json.RawMessage(`{"delay":"10ms","fail":true}`)}},
+		{name: "no name", spec: ClusterSpec{Workers: 1}, wantErr: true},
+		{name: "negative workers", spec: ClusterSpec{Name: "a", Workers: -1}, wantErr: true},
+		{name: "invalid delay", spec: ClusterSpec{Name: "a", Options: json.RawMessage(`{"delay":"soon"}`)}, wantErr: true},
+		{name: "unknown option", spec: ClusterSpec{Name: "a", Options: json.RawMessage(`{"region":"x"}`)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewFake().Validate(tt.spec); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFakeLifecycle(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	spec := ClusterSpec{Name: "demo", Workers: 2}
+
+	if _, err := fake.GetKubeconfig(ctx, spec); err == nil {
+		t.Error("GetKubeconfig of a missing cluster succeeded")
+	}
+	var logs strings.Builder
+	if err := fake.Create(ctx, spec, &logs); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Fake cluster demo created") {
+		t.Errorf("Create logged %q", logs.String())
+	}
+	if workers, ok := fake.Workers("demo"); !ok || workers != 2 {
+		t.Errorf("Workers after Create = %d, %t, want 2, true", workers, ok)
+	}
+	if err := fake.Create(ctx, spec, io.Discard); err == nil {
+		t.Error("creating an existing cluster succeeded")
+	}
+
+	kubeconfig, err := fake.GetKubeconfig(ctx, spec)
+	if err != nil {
+		t.Fatalf("GetKubeconfig: %v", err)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		t.Fatalf("GetKubeconfig returned an unusable kubeconfig: %v", err)
+	}
+	if config.Host != "https://demo.fake.invalid:6443" {
+		t.Errorf("kubeconfig server = %q", config.Host)
+	}
+
+	if err := fake.Scale(ctx, spec, 5, io.Discard); err != nil {
+		t.Fatalf("Scale: %v", err)
+	}
+	if workers, _ := fake.Workers("demo"); workers != 5 {
+		t.Errorf("Workers after Scale = %d, want 5", workers)
+	}
+	if err := fake.Scale(ctx, spec, -1, io.Discard); err == nil {
+		t.Error("scaling to negative workers succeeded")
+	}
+
+	if err := fake.Delete(ctx, spec, io.Discard); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := fake.Workers("demo"); ok {
+		t.Error("cluster still exists after Delete")
+	}
+	if err := fake.Delete(ctx, spec, io.Discard); err == nil {
+		t.Error("deleting a missing cluster succeeded")
+	}
+	if err := fake.Scale(ctx, spec, 1, io.Discard); err == nil {
+		t.Error("scaling a missing cluster succeeded")
+	}
+}
+
+func TestFakeCreateFails(t *testing.T) {
+	fake := NewFake()
+	spec := ClusterSpec{Name: "broken", Options: json.RawMessage(`{"fail":true}`)}
+	if err := fake.Create(context.Background(), spec, io.Discard); err == nil {
+		t.Fatal("Create with fail set succeeded")
+	}
+	if _, ok := fake.Workers("broken"); ok {
+		t.Error("a failed Create left the cluster behind")
+	}
+}
+
+func TestFakeDelayHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	spec := ClusterSpec{Name: "slow", Options: json.RawMessage(`{"delay":"1m"}`)}
+	if err := NewFake().Create(ctx, spec, io.Discard); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Create past its deadline = %v, want context.DeadlineExceeded", err)
+	}
+}
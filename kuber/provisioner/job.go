@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is a provisioning run in the background. Its log is kept in memory
+// while it runs so that clients can follow it.
+type Job struct {
+	ID string
+
+	mu   sync.Mutex
+	logs bytes.Buffer
+	done bool
+	err  error
+	// changed is closed and replaced whenever the log grows or the job ends.
+	changed chan struct{}
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*Job{}
+)
+
+// Write appends to the log of the job; kind writes its output here.
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	n, err := j.logs.Write(p)
+	j.notify()
+	return n, err
+}
+
+func (j *Job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// Logs returns the log written after offset, whether the job has ended and a
+// channel that is closed on the next change.
+func (j *Job) Logs(offset int) ([]byte, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var chunk []byte
+	if offset < j.logs.Len() {
+		chunk = append(chunk, j.logs.Bytes()[offset:]...)
+	}
+	return chunk, j.done, j.changed
+}
+
+// Done reports whether the job has ended and the error it ended with.
+func (j *Job) Done() (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.done, j.err
+}
+
+// StartJob runs a provisioning function in the background, bounded by
+// timeout. finish is handed the full log and the error of the run so it can
+// be persisted; the job is forgotten once finish returns.
+func StartJob(id string, timeout time.Duration, run func(ctx context.Context, logs io.Writer) error, finish func(logs string, err error)) *Job {
+	job := &Job{ID: id, changed: make(chan struct{})}
+	jobsMu.Lock()
+	jobs[id] = job
+	jobsMu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		err := run(ctx, job)
+		if err != nil {
+			fmt.Fprintf(job, "Error: %v\n", err)
+			log.Printf("Provisioning job %s failed: %v", id, err)
+		}
+		job.mu.Lock()
+		job.done = true
+		job.err = err
+		job.notify()
+		logs := job.logs.String()
+		job.mu.Unlock()
+
+		finish(logs, err)
+		jobsMu.Lock()
+		delete(jobs, id)
+		jobsMu.Unlock()
+	}()
+	return job
+}
+
+// GetJob returns a job that is running on this server, or nil.
+func GetJob(id string) *Job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	return jobs[id]
+}
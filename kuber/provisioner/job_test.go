@@ -0,0 +1,123 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// finished records what StartJob hands to finish.
+type finished struct {
+	logs string
+	err  error
+}
+
+// waitForChange fails the test if changed is not closed in time.
+func waitForChange(t *testing.T, changed <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not change")
+	}
+}
+
+func TestStartJobFollowsLogsUntilDone(t *testing.T) {
+	release := make(chan struct{})
+	result := make(chan finished, 1)
+	job := StartJob("job-follow", time.Minute, func(ctx context.Context, logs io.Writer) error {
+		fmt.Fprintln(logs, "first")
+		<-release
+		fmt.Fprintln(logs, "second")
+		return nil
+	}, func(logs string, err error) {
+		result <- finished{logs, err}
+	})
+
+	if GetJob("job-follow") != job {
+		t.Fatal("GetJob did not return the running job")
+	}
+
+	offset := 0
+	released := false
+	var followed strings.Builder
+	for {
+		chunk, done, changed := job.Logs(offset)
+		followed.Write(chunk)
+		offset += len(chunk)
+		if done {
+			break
+		}
+		if !released && strings.Contains(followed.String(), "first") {
+			released = true
+			close(release)
+		}
+		waitForChange(t, changed)
+	}
+	if !released {
+		t.Fatal("job ended before it was released")
+	}
+	if followed.String() != "first\nsecond\n" {
+		t.Errorf("followed logs = %q", followed.String())
+	}
+	if done, err := job.Done(); !done || err != nil {
+		t.Errorf("Done() = %t, %v, want true, nil", done, err)
+	}
+
+	r := <-result
+	if r.err != nil || r.logs != "first\nsecond\n" {
+		t.Errorf("finish got %q, %v", r.logs, r.err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for GetJob("job-follow") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("job was not forgotten after finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStartJobRecordsFailure(t *testing.T) {
+	result := make(chan finished, 1)
+	fake := NewFake()
+	spec := ClusterSpec{Name: "broken", Options: json.RawMessage(`{"fail":true}`)}
+	job := StartJob("job-fail", time.Minute, func(ctx context.Context, logs io.Writer) error {
+		return fake.Create(ctx, spec, logs)
+	}, func(logs string, err error) {
+		result <- finished{logs, err}
+	})
+
+	r := <-result
+	if r.err == nil {
+		t.Fatal("finish got no error from a failing run")
+	}
+	if !strings.Contains(r.logs, "Creating fake cluster broken") || !strings.Contains(r.logs, "Error: "+r.err.Error()) {
+		t.Errorf("finish got logs %q", r.logs)
+	}
+	if done, err := job.Done(); !done || err != r.err {
+		t.Errorf("Done() = %t, %v, want true, %v", done, err, r.err)
+	}
+}
+
+func TestStartJobTimesOut(t *testing.T) {
+	result := make(chan finished, 1)
+	spec := ClusterSpec{Name: "slow", Options: json.RawMessage(`{"delay":"1m"}`)}
+	StartJob("job-timeout", 10*time.Millisecond, func(ctx context.Context, logs io.Writer) error {
+		return NewFake().Create(ctx, spec, logs)
+	}, func(logs string, err error) {
+		result <- finished{logs, err}
+	})
+
+	select {
+	case r := <-result:
+		if r.err != context.DeadlineExceeded {
+			t.Errorf("finish got %v, want context.DeadlineExceeded", r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not time out")
+	}
+}
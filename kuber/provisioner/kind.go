@@ -0,0 +1,180 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// kindClusterName is what kind accepts as a cluster name: it becomes part of
+// the node container and kubeconfig context names.
+var kindClusterName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,48}[a-z0-9])?$`)
+
+// MaxKindWorkers bounds the worker nodes of a Kind cluster, which all run as
+// containers on the kuber host.
+const MaxKindWorkers = 10
+
+// KindOptions are the options of a Kind cluster spec.
+type KindOptions struct {
+	// NodeImage is the kindest/node image of every node, e.g.
+	// kindest/node:v1.30.0. kind picks its default image when empty.
+	NodeImage string `json:"node_image"`
+}
+
+// Kind provisions throwaway clusters as containers on the kuber host with
+// the kind CLI.
+type Kind struct{}
+
+func init() {
+	Register(Kind{})
+}
+
+func (Kind) Name() string {
+	return "kind"
+}
+
+func (Kind) Validate(spec ClusterSpec) error {
+	if !kindClusterName.MatchString(spec.Name) {
+		return fmt.Errorf("invalid Kind cluster name %q: use lowercase letters, digits and '-', at most 50 characters", spec.Name)
+	}
+	if spec.Workers < 0 || spec.Workers > MaxKindWorkers {
+		return fmt.Errorf("workers must be between 0 and %d", MaxKindWorkers)
+	}
+	var options KindOptions
+	if err := decodeOptions(spec, &options); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("kind"); err != nil {
+		return errors.New("kind is not installed on the kuber server: install it with the k8s-cluster-create tool or from https://kind.sigs.k8s.io")
+	}
+	return nil
+}
+
+type kindNode struct {
+	Role  string `json:"role"`
+	Image string `json:"image,omitempty"`
+}
+
+type kindConfig struct {
+	Kind       string     `json:"kind"`
+	APIVersion string     `json:"apiVersion"`
+	Name       string     `json:"name"`
+	Nodes      []kindNode `json:"nodes"`
+}
+
+// KindConfig generates the kind configuration of a cluster with one control
+// plane and the workers of the spec.
+func KindConfig(spec ClusterSpec) ([]byte, error) {
+	var options KindOptions
+	if err := decodeOptions(spec, &options); err != nil {
+		return nil, err
+	}
+	config := kindConfig{
+		Kind:       "Cluster",
+		APIVersion: "kind.x-k8s.io/v1alpha4",
+		Name:       spec.Name,
+		Nodes:      []kindNode{{Role: "control-plane", Image: options.NodeImage}},
+	}
+	for i := 0; i < spec.Workers; i++ {
+		config.Nodes = append(config.Nodes, kindNode{Role: "worker", Image: options.NodeImage})
+	}
+	return yaml.Marshal(config)
+}
+
+// writeTemp writes data to a temporary file and returns its name.
+func writeTemp(pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Create runs `kind create cluster` with a generated config. The kubeconfig
+// kind writes is discarded; GetKubeconfig reads it back from kind so the
+// kubeconfig of the kuber user is never touched.
+func (Kind) Create(ctx context.Context, spec ClusterSpec, logs io.Writer) error {
+	config, err := KindConfig(spec)
+	if err != nil {
+		return fmt.Errorf("failed to generate Kind config: %w", err)
+	}
+	configFile, err := writeTemp("kind-"+spec.Name+"-*.yaml", config)
+	if err != nil {
+		return fmt.Errorf("failed to write Kind config: %w", err)
+	}
+	defer os.Remove(configFile)
+	kubeconfigFile, err := writeTemp("kind-"+spec.Name+"-*.kubeconfig", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create kubeconfig file: %w", err)
+	}
+	defer os.Remove(kubeconfigFile)
+
+	fmt.Fprintf(logs, "Creating Kind cluster %s with config:\n%s\n", spec.Name, config)
+	err = runKind(ctx, logs, "create", "cluster", "--name", spec.Name, "--config", configFile, "--kubeconfig", kubeconfigFile, "--wait", "5m")
+	if err != nil {
+		return fmt.Errorf("failed to create Kind cluster: %w", err)
+	}
+	fmt.Fprintln(logs, "Kind cluster created successfully.")
+	return nil
+}
+
+func (Kind) Delete(ctx context.Context, spec ClusterSpec, logs io.Writer) error {
+	kubeconfigFile, err := writeTemp("kind-"+spec.Name+"-*.kubeconfig", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create kubeconfig file: %w", err)
+	}
+	defer os.Remove(kubeconfigFile)
+
+	fmt.Fprintf(logs, "Deleting Kind cluster %s\n", spec.Name)
+	if err := runKind(ctx, logs, "delete", "cluster", "--name", spec.Name, "--kubeconfig", kubeconfigFile); err != nil {
+		return fmt.Errorf("failed to delete Kind cluster: %w", err)
+	}
+	fmt.Fprintln(logs, "Kind cluster deleted successfully.")
+	return nil
+}
+
+// Scale is not supported: kind cannot add nodes to or remove nodes from a
+// running cluster.
+func (Kind) Scale(ctx context.Context, spec ClusterSpec, workers int, logs io.Writer) error {
+	return ErrScaleNotSupported
+}
+
+func (Kind) GetKubeconfig(ctx context.Context, spec ClusterSpec) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, "kind", "get", "kubeconfig", "--name", spec.Name).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to get Kind kubeconfig: %s", exitErr.Stderr)
+		}
+		return nil, fmt.Errorf("failed to get Kind kubeconfig: %w", err)
+	}
+	return out, nil
+}
+
+func runKind(ctx context.Context, logs io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "kind", args...)
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestKindConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    ClusterSpec
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "control plane only",
+			spec: ClusterSpec{Name: "dev"},
+			want: `apiVersion: kind.x-k8s.io/v1alpha4
+kind: Cluster
+name: dev
+nodes:
+- role: control-plane
+`,
+		},
+		{
+			name: "workers with a node image",
+			spec: ClusterSpec{Name: "dev", Workers: 2, Options: json.RawMessage(`{"node_image":"kindest/node:v1.30.0"}`)},
+			want: `apiVersion: kind.x-k8s.io/v1alpha4
+kind: Cluster
+name: dev
+nodes:
+- image: kindest/node:v1.30.0
+  role: control-plane
+- image: kindest/node:v1.30.0
+  role: worker
+- image: kindest/node:v1.30.0
+  role: worker
+`,
+		},
+		{
+			name:    "unknown option",
+			spec:    ClusterSpec{Name: "dev", Options: json.RawMessage(`{"delay":"1s"}`)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := KindConfig(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KindConfig() error = %v, want error %t", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("KindConfig() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Only the checks that come before looking for the kind binary are covered.
+func TestKindValidateSpec(t *testing.T) {
+	tests := []struct {
+		spec ClusterSpec
+		want string
+	}{
+		{spec: ClusterSpec{Name: "Dev"}, want: "invalid Kind cluster name"},
+		{spec: ClusterSpec{Name: "-dev"}, want: "invalid Kind cluster name"},
+		{spec: ClusterSpec{Name: strings.Repeat("a", 51)}, want: "invalid Kind cluster name"},
+		{spec: ClusterSpec{Name: "dev", Workers: -1}, want: "workers must be between"},
+		{spec: ClusterSpec{Name: "dev", Workers: MaxKindWorkers + 1}, want: "workers must be between"},
+		{spec: ClusterSpec{Name: "dev", Options: json.RawMessage(`{"fail":true}`)}, want: "invalid options"},
+	}
+	for _, tt := range tests {
+		err := Kind{}.Validate(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%+v) = %v, want an error containing %q", tt.spec, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ClusterSpec describes a cluster to a Provisioner.
+type ClusterSpec struct {
+	Name    string `json:"name"`
+	Region  string `json:"region"`
+	Workers int    `json:"workers"`
+	// Options are specific to the provisioner, e.g. the node image of Kind.
+	Options json.RawMessage `json:"options"`
+}
+
+// Provisioner creates and manages the clusters of one provider. A provider is
+// added by implementing a Provisioner and registering it.
+type Provisioner interface {
+	// Name is the provisioner clusters are recorded with.
+	Name() string
+	// Validate checks a spec before anything is recorded for it.
+	Validate(spec ClusterSpec) error
+	// Create provisions the cluster, writing progress to logs, and returns
+	// once it is ready to use.
+	Create(ctx context.Context, spec ClusterSpec, logs io.Writer) error
+	Delete(ctx context.Context, spec ClusterSpec, logs io.Writer) error
+	// Scale changes the number of worker nodes of the cluster.
+	Scale(ctx context.Context, spec ClusterSpec, workers int, logs io.Writer) error
+	// GetKubeconfig returns a kubeconfig giving admin access to the cluster.
+	GetKubeconfig(ctx context.Context, spec ClusterSpec) ([]byte, error)
+}
+
+var (
+	ErrUnknownProvisioner = errors.New("unknown provisioner")
+	ErrScaleNotSupported  = errors.New("scaling is not supported by this provisioner")
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Provisioner{}
+)
+
+// Register makes a provisioner available by its name. Registering two
+// provisioners with the same name is a programming error and panics.
+func Register(p Provisioner) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[p.Name()]; ok {
+		panic("provisioner " + p.Name() + " is registered twice")
+	}
+	registry[p.Name()] = p
+}
+
+// Get returns the registered provisioner of the given name.
+func Get(name string) (Provisioner, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q: must be one of %s", ErrUnknownProvisioner, name, strings.Join(namesLocked(), ", "))
+	}
+	return p, nil
+}
+
+// Names lists the registered provisioners.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeOptions reads the provisioner specific options of a spec into out.
+func decodeOptions(spec ClusterSpec, out interface{}) error {
+	if len(spec.Options) == 0 || string(spec.Options) == "null" {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(spec.Options))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// renamedFake registers a Fake under a name of its own, so tests do not
+// depend on KUBER_FAKE_PROVISIONER.
+type renamedFake struct {
+	*Fake
+	name string
+}
+
+func (r renamedFake) Name() string {
+	return r.name
+}
+
+func TestRegistry(t *testing.T) {
+	fake := renamedFake{Fake: NewFake(), name: "fake-registry-test"}
+	// The registry outlives a test run, e.g. with -count.
+	if _, err := Get(fake.name); err != nil {
+		Register(fake)
+	}
+
+	got, err := Get(fake.name)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", fake.name, err)
+	}
+	if got.Name() != fake.name {
+		t.Errorf("Get(%q) returned %q", fake.name, got.Name())
+	}
+	names := Names()
+	if !slices.Contains(names, fake.name) || !slices.Contains(names, "kind") {
+		t.Errorf("Names() = %v, want %q and kind", names, fake.name)
+	}
+	if !slices.IsSorted(names) {
+		t.Errorf("Names() = %v, want sorted", names)
+	}
+
+	if _, err := Get("no-such-provisioner"); !errors.Is(err, ErrUnknownProvisioner) {
+		t.Errorf("Get of an unknown provisioner = %v, want ErrUnknownProvisioner", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	Register(fake)
+}
+
+func TestDecodeOptions(t *testing.T) {
+	tests := []struct {
+		options string
+		want    FakeOptions
+		wantErr bool
+	}{
+		{options: "", want: FakeOptions{}},
+		{options: "null", want: FakeOptions{}},
+		{options: `{"delay":"1s","fail":true}`, want: FakeOptions{Delay: "1s", Fail: true}},
+		{options: `{"node_image":"kindest/node:v1.30.0"}`, wantErr: true},
+		{options: `{"delay":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got FakeOptions
+		err := decodeOptions(ClusterSpec{Options: json.RawMessage(tt.options)}, &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("decodeOptions(%s) error = %v, want error %t", tt.options, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("decodeOptions(%s) = %+v, want %+v", tt.options, got, tt.want)
+		}
+	}
+}
@@ -1,156 +1,1016 @@
 package routes
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
 	"example.com/kuber/DR"
 	"example.com/kuber/models"
 	"github.com/gin-gonic/gin"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 )
 
 type ClusterDRRequest struct {
-	SourceClusterID      string `json:"source_cluster_id" binding:"required"`
-	DestinationClusterID string `json:"destination_cluster_id" binding:"required"`
-	DRtype               string `json:"dr_type" binding:"required" validate:"oneof=active-passive active-active"`
+	SourceClusterID string `json:"source_cluster_id" binding:"required"`
+	// DestinationClusterID names the single destination of the job. A job
+	// fanning out to several clusters lists them in Destinations instead.
+	DestinationClusterID string                 `json:"destination_cluster_id"`
+	Destinations         []DRDestinationRequest `json:"destinations"`
+	DRtype               string                 `json:"dr_type" binding:"required" validate:"oneof=active-passive active-active"`
+	// Active-passive only: how often the source is probed and how many
+	// consecutive failed probes trigger a failover.
+	HealthCheckIntervalSeconds int `json:"health_check_interval_seconds"`
+	FailureThreshold           int `json:"failure_threshold"`
+	// Namespace globs to replicate or skip, on top of DR.DefaultExcludedNamespaces,
+	// and a label selector applied to every replicated resource.
+	IncludeNamespaces []string `json:"include_namespaces"`
+	ExcludeNamespaces []string `json:"exclude_namespaces"`
+	LabelSelector     string   `json:"label_selector"`
+	// Kind, resource or group globs, e.g. "Certificate" or "*.cert-manager.io",
+	// narrowing the resources discovered on the source.
+	IncludeResources []string `json:"include_resources"`
+	ExcludeResources []string `json:"exclude_resources"`
+	// What to do when a destination field is owned by another manager:
+	// "force", "skip" or "report" (default).
+	ConflictPolicy string `json:"conflict_policy"`
+	// Rewrites applied on top of the preset for the source and destination
+	// provisioners.
+	Transform DR.TransformRules `json:"transform"`
+	// How often the destination is compared with the source and repaired:
+	// 0 uses DR.DefaultReconcileInterval, a negative value turns it off.
+	ReconcileIntervalSeconds int `json:"reconcile_interval_seconds"`
+	// How Secrets are replicated: copied as they are (default), skipped by
+	// type or sealed for the destination. Values of the overrides store of
+	// the destination cluster replace the source values either way.
+	Secrets DR.SecretPolicy `json:"secrets"`
+	// SkipPreflight starts the job even if the destination fails the
+	// preflight checks.
+	SkipPreflight bool `json:"skip_preflight"`
 }
 
-var gvrs = []schema.GroupVersionResource{
-	{Group: "apps", Version: "v1", Resource: "deployments"},
-	{Group: "", Version: "v1", Resource: "services"},
-	{Group: "", Version: "v1", Resource: "configmaps"},
-	{Group: "", Version: "v1", Resource: "secrets"},
-	{Group: "", Version: "v1", Resource: "persistentvolumeclaims"},
-	{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
-	// Add custom CRDs here if needed
+// DRDestinationRequest is one destination of a fan-out DR job. Its namespace
+// and label selector fields replace those of the job when set, and its
+// transform is layered on top of the job's.
+type DRDestinationRequest struct {
+	DestinationClusterID string            `json:"destination_cluster_id"`
+	IncludeNamespaces    []string          `json:"include_namespaces"`
+	ExcludeNamespaces    []string          `json:"exclude_namespaces"`
+	LabelSelector        string            `json:"label_selector"`
+	Transform            DR.TransformRules `json:"transform"`
 }
 
-func clusterDR(context *gin.Context) {
+// scope returns the scope of the destination, or nil when it keeps the
+// scope of the job.
+func (d *DRDestinationRequest) scope(jobScope DR.Scope) *DR.Scope {
+	if len(d.IncludeNamespaces) == 0 && len(d.ExcludeNamespaces) == 0 && d.LabelSelector == "" {
+		return nil
+	}
+	scope := jobScope
+	if len(d.IncludeNamespaces) > 0 {
+		scope.IncludeNamespaces = d.IncludeNamespaces
+	}
+	if len(d.ExcludeNamespaces) > 0 {
+		scope.ExcludeNamespaces = d.ExcludeNamespaces
+	}
+	if d.LabelSelector != "" {
+		scope.LabelSelector = d.LabelSelector
+	}
+	return &scope
+}
+
+// isFanOut reports whether the job replicates to several destinations.
+func (ClusterDRReq *ClusterDRRequest) isFanOut() bool {
+	return len(ClusterDRReq.Destinations) > 0
+}
+
+// validateDestinations checks that a DR request names either one destination
+// or a list of distinct ones, none of them the source.
+func validateDestinations(ClusterDRReq *ClusterDRRequest, options DR.Options) error {
+	if !ClusterDRReq.isFanOut() {
+		if ClusterDRReq.DestinationClusterID == "" {
+			return errors.New("destination_cluster_id or destinations is required")
+		}
+		if ClusterDRReq.SourceClusterID == ClusterDRReq.DestinationClusterID {
+			return errors.New("Source and destination clusters cannot be the same")
+		}
+		return nil
+	}
+	if ClusterDRReq.DestinationClusterID != "" {
+		return errors.New("Set either destination_cluster_id or destinations, not both")
+	}
+	seen := map[string]bool{}
+	for i := range ClusterDRReq.Destinations {
+		d := &ClusterDRReq.Destinations[i]
+		if d.DestinationClusterID == "" {
+			return errors.New("Every destination needs a destination_cluster_id")
+		}
+		if d.DestinationClusterID == ClusterDRReq.SourceClusterID {
+			return errors.New("Source and destination clusters cannot be the same")
+		}
+		if seen[d.DestinationClusterID] {
+			return errors.New("Destination " + d.DestinationClusterID + " is listed more than once")
+		}
+		seen[d.DestinationClusterID] = true
+		if scope := d.scope(options.Scope); scope != nil {
+			if err := scope.Validate(); err != nil {
+				return errors.New("Invalid scope of destination " + d.DestinationClusterID + ": " + err.Error())
+			}
+		}
+		if err := d.Transform.Validate(); err != nil {
+			return errors.New("Invalid transform of destination " + d.DestinationClusterID + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// drClusters are the clients and provisioners of the two clusters of a DR request.
+type drClusters struct {
+	source                 dynamic.Interface
+	destination            dynamic.Interface
+	sourceK8s              *kubernetes.Clientset
+	destinationK8s         *kubernetes.Clientset
+	sourceProvisioner      string
+	destinationProvisioner string
+}
+
+// bindDRRequest parses and validates a DR request body and turns it into
+// DR.Options. It writes the error response itself and reports false on failure.
+func bindDRRequest(context *gin.Context) (*ClusterDRRequest, DR.Options, bool) {
 	var ClusterDRReq ClusterDRRequest
 	if err := context.ShouldBindJSON(&ClusterDRReq); err != nil {
 		context.JSON(400, gin.H{
 			"error": "Invalid request format: " + err.Error(),
 		})
-		return
+		return nil, DR.Options{}, false
+	}
+	if ClusterDRReq.DRtype != DR.DRTypeActivePassive && ClusterDRReq.DRtype != DR.DRTypeActiveActive {
+		context.JSON(400, gin.H{
+			"error": "Invalid DR type. Must be either 'active-passive' or 'active-active'",
+		})
+		return nil, DR.Options{}, false
 	}
-	if ClusterDRReq.SourceClusterID == ClusterDRReq.DestinationClusterID {
+	options, err := drOptions(&ClusterDRReq)
+	if err == nil {
+		err = validateDestinations(&ClusterDRReq, options)
+	}
+	if err != nil {
 		context.JSON(400, gin.H{
-			"error": "Source and destination clusters cannot be the same",
+			"error": err.Error(),
+		})
+		return nil, DR.Options{}, false
+	}
+	return &ClusterDRReq, options, true
+}
+
+// drOptions turns the tunables of a DR request into validated DR.Options. It
+// also rebuilds the options of a recorded job.
+func drOptions(ClusterDRReq *ClusterDRRequest) (DR.Options, error) {
+	if ClusterDRReq.HealthCheckIntervalSeconds < 0 || ClusterDRReq.FailureThreshold < 0 {
+		return DR.Options{}, errors.New("health_check_interval_seconds and failure_threshold cannot be negative")
+	}
+	options := DR.Options{
+		HealthCheck: DR.HealthCheck{
+			Interval:         time.Duration(ClusterDRReq.HealthCheckIntervalSeconds) * time.Second,
+			FailureThreshold: ClusterDRReq.FailureThreshold,
+		},
+		Scope: DR.Scope{
+			IncludeNamespaces: ClusterDRReq.IncludeNamespaces,
+			ExcludeNamespaces: ClusterDRReq.ExcludeNamespaces,
+			LabelSelector:     ClusterDRReq.LabelSelector,
+		},
+		Resources: DR.ResourceFilter{
+			Include: ClusterDRReq.IncludeResources,
+			Exclude: ClusterDRReq.ExcludeResources,
+		},
+		ConflictPolicy:    ClusterDRReq.ConflictPolicy,
+		Transform:         ClusterDRReq.Transform,
+		ReconcileInterval: time.Duration(ClusterDRReq.ReconcileIntervalSeconds) * time.Second,
+		Secrets:           ClusterDRReq.Secrets,
+	}
+	if err := options.Scope.Validate(); err != nil {
+		return DR.Options{}, errors.New("Invalid scope: " + err.Error())
+	}
+	if err := options.Resources.Validate(); err != nil {
+		return DR.Options{}, errors.New("Invalid resource filter: " + err.Error())
+	}
+	if err := DR.ValidateConflictPolicy(options.ConflictPolicy); err != nil {
+		return DR.Options{}, err
+	}
+	if err := options.Transform.Validate(); err != nil {
+		return DR.Options{}, errors.New("Invalid transform: " + err.Error())
+	}
+	if err := options.Secrets.Validate(); err != nil {
+		return DR.Options{}, errors.New("Invalid secret policy: " + err.Error())
+	}
+	if options.ReconcileInterval > 0 && options.ReconcileInterval < DR.MinReconcileInterval {
+		return DR.Options{}, fmt.Errorf("reconcile_interval_seconds must be at least %d", int(DR.MinReconcileInterval.Seconds()))
+	}
+	return options, nil
+}
+
+// loadClusterClients looks up a registered cluster and returns its pooled
+// clients; role names the cluster in error messages, e.g. "source". It writes
+// the error response itself and reports false on failure.
+func loadClusterClients(context *gin.Context, clusterID, role string) (dynamic.Interface, *kubernetes.Clientset, bool) {
+	cluster, err := models.GetClusterByID(clusterID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to get " + role + " cluster: " + err.Error(),
+		})
+		return nil, nil, false
+	}
+	if cluster == nil {
+		context.JSON(404, gin.H{
+			"error": role + " cluster not found",
+		})
+		return nil, nil, false
+	}
+	clients, err := models.GetClusterClients(clusterID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to create " + role + " clients: " + err.Error(),
+		})
+		return nil, nil, false
+	}
+	return clients.Dynamic, clients.Kube, true
+}
+
+// loadDREndpoint looks up a registered cluster and builds the clients DR
+// needs for it. It writes the error response itself and reports false on
+// failure.
+func loadDREndpoint(context *gin.Context, clusterID, role string) (DR.Endpoint, bool) {
+	client, k8sClient, ok := loadClusterClients(context, clusterID, role)
+	if !ok {
+		return DR.Endpoint{}, false
+	}
+	provisioner, err := models.GetProvisionerByID(clusterID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to get " + role + " provisioner: " + err.Error(),
+		})
+		return DR.Endpoint{}, false
+	}
+	return DR.Endpoint{Client: client, K8sClient: k8sClient, Provisioner: provisioner}, true
+}
+
+// loadDRDestinations looks up the source and every destination of a fan-out
+// DR request. It writes the error response itself and reports false on
+// failure.
+func loadDRDestinations(context *gin.Context, ClusterDRReq *ClusterDRRequest, options DR.Options) (DR.Endpoint, []DR.Destination, bool) {
+	source, ok := loadDREndpoint(context, ClusterDRReq.SourceClusterID, "source")
+	if !ok {
+		return DR.Endpoint{}, nil, false
+	}
+	if source.Provisioner == "" {
+		context.JSON(500, gin.H{
+			"error": "Provisioner not found for the source cluster",
+		})
+		return DR.Endpoint{}, nil, false
+	}
+	destinations := make([]DR.Destination, 0, len(ClusterDRReq.Destinations))
+	for i := range ClusterDRReq.Destinations {
+		d := &ClusterDRReq.Destinations[i]
+		endpoint, ok := loadDREndpoint(context, d.DestinationClusterID, "destination")
+		if !ok {
+			return DR.Endpoint{}, nil, false
+		}
+		destinations = append(destinations, DR.Destination{
+			Endpoint:  endpoint,
+			ID:        d.DestinationClusterID,
+			Scope:     d.scope(options.Scope),
+			Transform: d.Transform,
+			// Each destination has its own overrides store.
+			SecretOverrides: drSecretOverrides(d.DestinationClusterID),
+		})
+	}
+	return source, destinations, true
+}
+
+// loadDRClusters looks up both clusters of a DR request and builds their
+// clients. It writes the error response itself and reports false on failure.
+func loadDRClusters(context *gin.Context, sourceClusterID, destinationClusterID string) (*drClusters, bool) {
+	SourceClient, sourceK8sClient, ok := loadClusterClients(context, sourceClusterID, "source")
+	if !ok {
+		return nil, false
+	}
+	DestinationClient, destinationK8sClient, ok := loadClusterClients(context, destinationClusterID, "destination")
+	if !ok {
+		return nil, false
+	}
+	povisioner, err := models.GetProvisionerByID(sourceClusterID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to get provisioner: " + err.Error(),
+		})
+		return nil, false
+	}
+	if povisioner == "" {
+		context.JSON(500, gin.H{
+			"error": "Provisioner not found for the source cluster",
+		})
+		return nil, false
+	}
+	destinationProvisioner, err := models.GetProvisionerByID(destinationClusterID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to get destination provisioner: " + err.Error(),
+		})
+		return nil, false
+	}
+	return &drClusters{
+		source:                 SourceClient,
+		destination:            DestinationClient,
+		sourceK8s:              sourceK8sClient,
+		destinationK8s:         destinationK8sClient,
+		sourceProvisioner:      povisioner,
+		destinationProvisioner: destinationProvisioner,
+	}, true
+}
+
+func clusterDR(context *gin.Context) {
+	ClusterDRReq, options, ok := bindDRRequest(context)
+	if !ok {
+		return
+	}
+	if ClusterDRReq.isFanOut() {
+		fanOutDR(context, ClusterDRReq, options)
+		return
+	}
+	clusters, ok := loadDRClusters(context, ClusterDRReq.SourceClusterID, ClusterDRReq.DestinationClusterID)
+	if !ok {
+		return
+	}
+	options.DestinationProvisioner = clusters.destinationProvisioner
+	options.Audit = recordDRRepair
+	options.SecretOverrides = drSecretOverrides(ClusterDRReq.DestinationClusterID)
+	options.SecretAudit = recordDRSecretTransfer(ClusterDRReq.DestinationClusterID)
+
+	var preflight *DR.PreflightReport
+	if !ClusterDRReq.SkipPreflight {
+		source, destination := clusters.endpoints()
+		report, err := runDRPreflight(source, destination, ClusterDRReq.DestinationClusterID, options)
+		if err != nil {
+			context.JSON(500, gin.H{
+				"error": "Failed to run DR preflight checks: " + err.Error(),
+			})
+			return
+		}
+		if !report.Passed {
+			context.JSON(422, gin.H{
+				"error":     "The destination failed the DR preflight checks",
+				"preflight": report,
+			})
+			return
+		}
+		preflight = report
+	}
+
+	jobOptions, err := json.Marshal(ClusterDRReq)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to encode DR job options: " + err.Error(),
+		})
+		return
+	}
+	startedAt := time.Now()
+	job := models.DRJob{
+		SourceClusterID:      ClusterDRReq.SourceClusterID,
+		DestinationClusterID: ClusterDRReq.DestinationClusterID,
+		DRType:               ClusterDRReq.DRtype,
+		State:                DR.StatePending,
+		StartedAt:            &startedAt,
+		Options:              jobOptions,
+		UserID:               context.GetInt64("userID"),
+	}
+	if err := job.Save(); err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to record DR job: " + err.Error(),
+		})
+		return
+	}
+
+	err = DR.PerformClusterDR(job.ID, clusters.source, clusters.destination, clusters.sourceProvisioner, ClusterDRReq.DRtype, nil, clusters.sourceK8s, clusters.destinationK8s, options, recordDRStatus)
+	if err != nil {
+		if updateErr := models.UpdateDRJobState(job.ID, DR.StateFailed, err.Error()); updateErr != nil {
+			log.Printf("Failed to update DR job %s: %v", job.ID, updateErr)
+		}
+		context.JSON(500, gin.H{
+			"error":  "Failed to perform cluster disaster recovery: " + err.Error(),
+			"job_id": job.ID,
+		})
+		return
+	}
+	context.JSON(202, gin.H{
+		"message":                "Cluster disaster recovery started",
+		"job_id":                 job.ID,
+		"source_cluster_id":      ClusterDRReq.SourceClusterID,
+		"destination_cluster_id": ClusterDRReq.DestinationClusterID,
+		"dr_type":                ClusterDRReq.DRtype,
+		"preflight":              preflight,
+	})
+}
+
+// fanOutDR starts a DR job replicating one source to every destination of the
+// request. The destinations share the source informers; each one is tracked
+// in dr_job_destinations and the job state sums them up.
+func fanOutDR(context *gin.Context, ClusterDRReq *ClusterDRRequest, options DR.Options) {
+	source, destinations, ok := loadDRDestinations(context, ClusterDRReq, options)
+	if !ok {
+		return
+	}
+	options.Audit = recordDRRepair
+	options.SecretAudit = recordDRSecretTransfer("")
+
+	var preflight []destinationPreflight
+	if !ClusterDRReq.SkipPreflight {
+		reports, passed, err := preflightFanOut(source, destinations, options)
+		if err != nil {
+			context.JSON(500, gin.H{
+				"error": "Failed to run DR preflight checks: " + err.Error(),
+			})
+			return
+		}
+		if !passed {
+			context.JSON(422, gin.H{
+				"error":     "A destination failed the DR preflight checks",
+				"preflight": reports,
+			})
+			return
+		}
+		preflight = reports
+	}
+
+	jobOptions, err := json.Marshal(ClusterDRReq)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to encode DR job options: " + err.Error(),
+		})
+		return
+	}
+	destinationIDs := make([]string, 0, len(destinations))
+	for _, d := range destinations {
+		destinationIDs = append(destinationIDs, d.ID)
+	}
+	startedAt := time.Now()
+	job := models.DRJob{
+		SourceClusterID:      ClusterDRReq.SourceClusterID,
+		DestinationClusterID: destinationIDs[0],
+		DRType:               ClusterDRReq.DRtype,
+		State:                DR.StatePending,
+		StartedAt:            &startedAt,
+		Options:              jobOptions,
+		UserID:               context.GetInt64("userID"),
+	}
+	if err := job.Save(); err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to record DR job: " + err.Error(),
+		})
+		return
+	}
+	err = models.SaveDRJobDestinations(job.ID, destinationIDs)
+	if err == nil {
+		err = DR.PerformFanOutDR(job.ID, source, ClusterDRReq.DRtype, destinations, options, recordDRStatus)
+	}
+	if err != nil {
+		if updateErr := models.UpdateDRJobState(job.ID, DR.StateFailed, err.Error()); updateErr != nil {
+			log.Printf("Failed to update DR job %s: %v", job.ID, updateErr)
+		}
+		context.JSON(500, gin.H{
+			"error":  "Failed to perform cluster disaster recovery: " + err.Error(),
+			"job_id": job.ID,
 		})
 		return
 	}
-	if ClusterDRReq.DRtype != "active-passive" && ClusterDRReq.DRtype != "active-active" {
+	context.JSON(202, gin.H{
+		"message":                 "Cluster disaster recovery started",
+		"job_id":                  job.ID,
+		"source_cluster_id":       ClusterDRReq.SourceClusterID,
+		"destination_cluster_ids": destinationIDs,
+		"dr_type":                 ClusterDRReq.DRtype,
+		"preflight":               preflight,
+	})
+}
+
+// planDR previews a DR request without writing to the destination. The report
+// is JSON by default or a unified diff with ?format=diff.
+func planDR(context *gin.Context) {
+	format := context.DefaultQuery("format", "json")
+	if format != "json" && format != "diff" {
 		context.JSON(400, gin.H{
-			"error": "Invalid DR type. Must be either 'active-passive' or 'active-active'",
+			"error": "Invalid format. Must be either 'json' or 'diff'",
 		})
 		return
 	}
-	// if ClusterDRReq.DRtype == "active-passive" {
-	// 	context.JSON(400, gin.H{
-	// 		"error": "DR type is required",
-	// 	})
-	// 	return
-	// }
-	sourceCluster, err := models.GetClusterByID(ClusterDRReq.SourceClusterID)
+	ClusterDRReq, options, ok := bindDRRequest(context)
+	if !ok {
+		return
+	}
+	if ClusterDRReq.isFanOut() {
+		planFanOutDR(context, ClusterDRReq, options, format)
+		return
+	}
+	clusters, ok := loadDRClusters(context, ClusterDRReq.SourceClusterID, ClusterDRReq.DestinationClusterID)
+	if !ok {
+		return
+	}
+	options.DestinationProvisioner = clusters.destinationProvisioner
+	options.SecretOverrides = drSecretOverrides(ClusterDRReq.DestinationClusterID)
+
+	report, err := DR.Plan(clusters.source, clusters.destination, clusters.sourceK8s, clusters.sourceProvisioner, ClusterDRReq.DRtype, options)
 	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to get source cluster: " + err.Error(),
+			"error": "Failed to plan cluster disaster recovery: " + err.Error(),
 		})
 		return
 	}
-	if sourceCluster == nil {
-		context.JSON(404, gin.H{
-			"error": "Source cluster not found",
+	if format == "diff" {
+		diff, err := report.UnifiedDiff()
+		if err != nil {
+			context.JSON(500, gin.H{
+				"error": "Failed to render diff: " + err.Error(),
+			})
+			return
+		}
+		context.String(200, diff)
+		return
+	}
+	context.JSON(200, gin.H{
+		"message": "Successfully planned cluster disaster recovery",
+		"plan":    report,
+	})
+}
+
+// planFanOutDR previews a fan-out DR request destination by destination. The
+// diff format prefixes the diff of each destination with a "# destination"
+// header line.
+func planFanOutDR(context *gin.Context, ClusterDRReq *ClusterDRRequest, options DR.Options, format string) {
+	source, destinations, ok := loadDRDestinations(context, ClusterDRReq, options)
+	if !ok {
+		return
+	}
+	plans := make([]gin.H, 0, len(destinations))
+	var diff strings.Builder
+	for _, d := range destinations {
+		report, err := DR.Plan(source.Client, d.Client, source.K8sClient, source.Provisioner, ClusterDRReq.DRtype, d.Options(options))
+		if err != nil {
+			context.JSON(500, gin.H{
+				"error": "Failed to plan cluster disaster recovery to " + d.ID + ": " + err.Error(),
+			})
+			return
+		}
+		if format == "diff" {
+			destinationDiff, err := report.UnifiedDiff()
+			if err != nil {
+				context.JSON(500, gin.H{
+					"error": "Failed to render diff: " + err.Error(),
+				})
+				return
+			}
+			diff.WriteString("# destination " + d.ID + "\n")
+			diff.WriteString(destinationDiff)
+			continue
+		}
+		plans = append(plans, gin.H{
+			"destination_cluster_id": d.ID,
+			"plan":                   report,
+		})
+	}
+	if format == "diff" {
+		context.String(200, diff.String())
+		return
+	}
+	context.JSON(200, gin.H{
+		"message": "Successfully planned cluster disaster recovery",
+		"plans":   plans,
+	})
+}
+
+// recordDRStatus persists the progress reported by a running DR session.
+func recordDRStatus(status DR.Status) {
+	conflicts, err := json.Marshal(status.Conflicts)
+	if err != nil {
+		log.Printf("Failed to encode conflicts of DR job %s: %v", status.JobID, err)
+	}
+	progress := models.DRJobProgress{
+		State:             status.State,
+		LastSyncAt:        status.LastSyncTime,
+		LastReconcileAt:   status.LastReconcileTime,
+		LastSourceEventAt: status.LastSourceEventTime,
+		ReplicationLag:    status.ReplicationLag,
+		QueueDepth:        status.QueueDepth,
+		ErrorCounts:       status.ErrorCounts,
+		ObjectCounts:      status.ObjectCounts,
+		LastError:         status.LastError,
+		FailoverReplicas:  status.FailoverReplicas,
+		Conflicts:         conflicts,
+	}
+	if status.DestinationID != "" {
+		recordDRDestinationStatus(status, progress)
+		return
+	}
+	if err := models.RecordDRJobProgress(status.JobID, progress); err != nil {
+		log.Printf("Failed to record progress of DR job %s: %v", status.JobID, err)
+	}
+}
+
+// recordDRDestinationStatus persists the progress of one destination of a
+// fan-out job and sums up the states of all its destinations as the job state.
+func recordDRDestinationStatus(status DR.Status, progress models.DRJobProgress) {
+	err := models.RecordDRJobDestinationProgress(status.JobID, status.DestinationID, progress)
+	if err != nil {
+		log.Printf("Failed to record progress of DR job %s on %s: %v", status.JobID, status.DestinationID, err)
+		return
+	}
+	destinations, err := models.GetDRJobDestinations(status.JobID)
+	if err != nil {
+		log.Printf("Failed to fetch destinations of DR job %s: %v", status.JobID, err)
+		return
+	}
+	states := make([]string, 0, len(destinations))
+	lastError := ""
+	for _, d := range destinations {
+		states = append(states, d.State)
+		if lastError == "" && d.LastError != "" {
+			lastError = d.DestinationClusterID + ": " + d.LastError
+		}
+	}
+	if err := models.UpdateDRJobState(status.JobID, DR.AggregateState(states), lastError); err != nil {
+		log.Printf("Failed to update DR job %s: %v", status.JobID, err)
+	}
+}
+
+// recordDRRepair stores the audit record of a repair made by reconciliation.
+func recordDRRepair(repair DR.Repair) {
+	changes, err := json.Marshal(repair.Changes)
+	if err != nil {
+		log.Printf("Failed to encode changes of DR repair for job %s: %v", repair.JobID, err)
+	}
+	record := models.DRRepair{
+		JobID:      repair.JobID,
+		Resource:   repair.Resource,
+		Namespace:  repair.Namespace,
+		Name:       repair.Name,
+		Action:     repair.Action,
+		Changes:    changes,
+		RepairedAt: repair.RepairedAt,
+	}
+	if err := record.Save(); err != nil {
+		log.Printf("Failed to record DR repair for job %s: %v", repair.JobID, err)
+	}
+}
+
+// getDRRepairs lists what reconciliation repaired on the destination of a job.
+func getDRRepairs(context *gin.Context) {
+	limit, err := strconv.Atoi(context.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		context.JSON(400, gin.H{
+			"error": "limit must be a positive number",
 		})
 		return
 	}
-	destinationCluster, err := models.GetClusterByID(ClusterDRReq.DestinationClusterID)
+	job, err := models.GetDRJobByID(context.Param("id"))
 	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to get destination cluster: " + err.Error(),
+			"error": "Failed to fetch DR job: " + err.Error(),
 		})
 		return
 	}
-	if destinationCluster == nil {
+	if job == nil {
 		context.JSON(404, gin.H{
-			"error": "Destination cluster not found",
+			"error": "DR job not found",
+		})
+		return
+	}
+	repairs, err := models.GetDRRepairs(job.ID, limit)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to fetch DR repairs: " + err.Error(),
 		})
 		return
 	}
+	context.JSON(200, gin.H{
+		"message": "Successfully fetched DR repairs",
+		"job_id":  job.ID,
+		"repairs": repairs,
+	})
+}
 
+// getDRPreset shows the built-in transformation between two provisioners,
+// which is empty when either of them has no preset.
+func getDRPreset(context *gin.Context) {
+	preset := DR.PresetRules(context.Query("source"), context.Query("destination"))
 	context.JSON(200, gin.H{
-		"message": "Cluster disaster recovery initiated",
+		"message":   "Successfully fetched DR preset",
+		"transform": preset,
 	})
-	SourceKubeconfig, err := models.GetKubeconfigFilePathByID(ClusterDRReq.SourceClusterID)
+}
+
+func getDRJobs(context *gin.Context) {
+	jobs, err := models.GetDRJobs()
 	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to get source kubeconfig: " + err.Error(),
+			"error": "Failed to fetch DR jobs: " + err.Error(),
 		})
 		return
 	}
-	DestinationKubeconfig, err := models.GetKubeconfigFilePathByID(ClusterDRReq.DestinationClusterID)
+	context.JSON(200, gin.H{
+		"message": "Successfully fetched DR jobs",
+		"dr_jobs": jobs,
+	})
+}
+
+func getDRJobByID(context *gin.Context) {
+	job, err := models.GetDRJobByID(context.Param("id"))
 	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to get destination kubeconfig: " + err.Error(),
+			"error": "Failed to fetch DR job: " + err.Error(),
 		})
 		return
 	}
-	SourceClient, _, sourceK8sClient, err := DR.GetDynamicClient(SourceKubeconfig)
+	if job == nil {
+		context.JSON(404, gin.H{
+			"error": "DR job not found",
+		})
+		return
+	}
+	job.Destinations, err = models.GetDRJobDestinations(job.ID)
 	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to create source dynamic client: " + err.Error(),
+			"error": "Failed to fetch DR job destinations: " + err.Error(),
+		})
+		return
+	}
+	// A job running on this server reports fresher figures than the last
+	// persisted progress.
+	if len(job.Destinations) > 0 {
+		if statuses, err := DR.DestinationStatuses(job.ID); err == nil {
+			applyLiveDestinationStatuses(job, statuses)
+		}
+	} else if status, err := DR.SessionStatus(job.ID); err == nil {
+		applyLiveDRStatus(job, status)
+	}
+	context.JSON(200, gin.H{
+		"message": "Successfully fetched DR job",
+		"dr_job":  job,
+	})
+}
+
+func applyLiveDRStatus(job *models.DRJob, status DR.Status) {
+	job.State = status.State
+	if !status.LastSyncTime.IsZero() {
+		job.LastSyncAt = &status.LastSyncTime
+	}
+	if !status.LastSourceEventTime.IsZero() {
+		job.LastSourceEventAt = &status.LastSourceEventTime
+	}
+	job.ReplicationLagMs = status.ReplicationLag.Milliseconds()
+	job.QueueDepth = status.QueueDepth
+	job.ObjectCounts = status.ObjectCounts
+	job.ErrorCounts = status.ErrorCounts
+	if len(status.FailoverReplicas) > 0 {
+		job.FailoverReplicas = status.FailoverReplicas
+	}
+	job.LastError = status.LastError
+}
+
+// applyLiveDestinationStatuses overlays the live status of every destination
+// of a running fan-out job and sums up their states as the job state.
+func applyLiveDestinationStatuses(job *models.DRJob, statuses []DR.Status) {
+	live := make(map[string]DR.Status, len(statuses))
+	for _, status := range statuses {
+		live[status.DestinationID] = status
+	}
+	states := make([]string, 0, len(job.Destinations))
+	for _, d := range job.Destinations {
+		if status, ok := live[d.DestinationClusterID]; ok {
+			d.State = status.State
+			if !status.LastSyncTime.IsZero() {
+				d.LastSyncAt = &status.LastSyncTime
+			}
+			d.ReplicationLagMs = status.ReplicationLag.Milliseconds()
+			d.QueueDepth = status.QueueDepth
+			d.ObjectCounts = status.ObjectCounts
+			d.ErrorCounts = status.ErrorCounts
+			d.LastError = status.LastError
+		}
+		states = append(states, d.State)
+	}
+	job.State = DR.AggregateState(states)
+}
+
+// getDRJobObjects lists the sync status of every object of a running DR job;
+// ?state=failed narrows it to the objects that could not be written. A
+// fan-out job needs ?destination_cluster_id= to pick the destination.
+func getDRJobObjects(context *gin.Context) {
+	state := context.Query("state")
+	if state != "" && state != DR.ObjectSynced && state != DR.ObjectFailed && state != DR.ObjectConflict {
+		context.JSON(400, gin.H{
+			"error": "Invalid state. Must be one of 'synced', 'failed' or 'conflict'",
 		})
 		return
 	}
-	if sourceK8sClient == nil {
+	job, err := models.GetDRJobByID(context.Param("id"))
+	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to create source k8s client: client is nil",
+			"error": "Failed to fetch DR job: " + err.Error(),
 		})
 		return
 	}
-	if SourceClient == nil {
+	if job == nil {
+		context.JSON(404, gin.H{
+			"error": "DR job not found",
+		})
+		return
+	}
+	objects, err := DR.SessionObjects(job.ID, context.Query("destination_cluster_id"), state)
+	if err != nil {
+		context.JSON(409, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message": "Successfully fetched DR job objects",
+		"job_id":  job.ID,
+		"objects": objects,
+	})
+}
+
+func stopDRJob(context *gin.Context) {
+	controlDRJob(context, DR.StopSession, DR.StateStopped, "stopped")
+}
+
+func pauseDRJob(context *gin.Context) {
+	controlDRJob(context, DR.PauseSession, DR.StatePaused, "paused")
+}
+
+func resumeDRJob(context *gin.Context) {
+	controlDRJob(context, DR.ResumeSession, DR.StateRunning, "resumed")
+}
+
+// RecoverDRJobs fails the DR jobs a server restart left without a session,
+// since nothing replicates for them any more. It is called once at startup.
+func RecoverDRJobs() {
+	ids, err := models.FailInterruptedDRJobs()
+	if err != nil {
+		log.Printf("Cannot recover DR jobs: %v", err)
+		return
+	}
+	for _, id := range ids {
+		log.Printf("DR job %s failed: interrupted by a server restart", id)
+	}
+}
+
+// controlDRJob applies a lifecycle action to the running session of a DR job.
+// A job whose session no longer exists, e.g. after a server restart, can still
+// be marked as stopped.
+func controlDRJob(context *gin.Context, action func(jobID string) error, state string, verb string) {
+	authorized, err := isAuthorized(context.GetInt64("userID"))
+	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to create source dynamic client: client is nil",
+			"error": "Cannot get roles and permissions: " + err.Error(),
+		})
+		return
+	}
+	if !authorized {
+		context.JSON(401, gin.H{
+			"error": "No permission to manage DR jobs",
 		})
 		return
 	}
-	DestinationClient, _, _, err := DR.GetDynamicClient(DestinationKubeconfig)
+	job, err := models.GetDRJobByID(context.Param("id"))
 	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to create destination dynamic client: " + err.Error(),
+			"error": "Failed to fetch DR job: " + err.Error(),
+		})
+		return
+	}
+	if job == nil {
+		context.JSON(404, gin.H{
+			"error": "DR job not found",
+		})
+		return
+	}
+	err = action(job.ID)
+	if errors.Is(err, DR.ErrSessionNotFound) && state == DR.StateStopped {
+		err = models.UpdateDRJobState(job.ID, DR.StateStopped, job.LastError)
+	}
+	if errors.Is(err, DR.ErrSessionNotFound) {
+		context.JSON(409, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		context.JSON(409, gin.H{
+			"error": "Failed to update DR job: " + err.Error(),
 		})
 		return
 	}
+	if status, err := DR.SessionStatus(job.ID); err == nil {
+		state = status.State
+	}
+	context.JSON(200, gin.H{
+		"message": "DR job " + verb,
+		"job_id":  job.ID,
+		"state":   state,
+	})
+}
 
-	if DestinationClient == nil {
+// failbackDRJob moves a failed-over job back to its original source cluster
+// with the options it was started with. The failback runs in the background;
+// the job is FailingBack until forward replication runs again.
+func failbackDRJob(context *gin.Context) {
+	authorized, err := isAuthorized(context.GetInt64("userID"))
+	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to create destination dynamic client: client is nil",
+			"error": "Cannot get roles and permissions: " + err.Error(),
 		})
 		return
 	}
-	povisioner, err := models.GetProvisionerByID(ClusterDRReq.SourceClusterID)
+	if !authorized {
+		context.JSON(401, gin.H{
+			"error": "No permission to manage DR jobs",
+		})
+		return
+	}
+	job, err := models.GetDRJobByID(context.Param("id"))
 	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to get provisioner: " + err.Error(),
+			"error": "Failed to fetch DR job: " + err.Error(),
 		})
 		return
 	}
-	if povisioner == "" {
+	if job == nil {
+		context.JSON(404, gin.H{
+			"error": "DR job not found",
+		})
+		return
+	}
+	var ClusterDRReq ClusterDRRequest
+	if err := json.Unmarshal(job.Options, &ClusterDRReq); err != nil {
 		context.JSON(500, gin.H{
-			"error": "Provisioner not found for the source cluster",
+			"error": "Failed to decode DR job options: " + err.Error(),
 		})
 		return
 	}
-
-	err = DR.PerformClusterDR(SourceClient, DestinationClient, povisioner, ClusterDRReq.DRtype, gvrs, sourceK8sClient)
+	if ClusterDRReq.isFanOut() {
+		context.JSON(400, gin.H{
+			"error": "Failback is not supported for a DR job with several destinations",
+		})
+		return
+	}
+	if status, err := DR.SessionStatus(job.ID); err == nil {
+		applyLiveDRStatus(job, status)
+	}
+	if job.State != DR.StateFailedOver {
+		context.JSON(409, gin.H{
+			"error": "Only a DR job in state " + DR.StateFailedOver + " can fail back, this one is " + job.State,
+		})
+		return
+	}
+	options, err := drOptions(&ClusterDRReq)
 	if err != nil {
 		context.JSON(500, gin.H{
-			"error": "Failed to perform cluster disaster recovery: " + err.Error(),
+			"error": "Invalid DR job options: " + err.Error(),
 		})
 		return
 	}
-	context.JSON(200, gin.H{
-		"message":                "Cluster disaster recovery completed successfully",
-		"source_cluster_id":      ClusterDRReq.SourceClusterID,
-		"destination_cluster_id": ClusterDRReq.DestinationClusterID,
-		"dr_type":                ClusterDRReq.DRtype,
+	clusters, ok := loadDRClusters(context, job.SourceClusterID, job.DestinationClusterID)
+	if !ok {
+		return
+	}
+	options.Audit = recordDRRepair
+	options.SecretOverrides = drSecretOverrides(job.DestinationClusterID)
+	forwardAudit := recordDRSecretTransfer(job.DestinationClusterID)
+	reverseAudit := recordDRSecretTransfer(job.SourceClusterID)
+	options.SecretAudit = func(transfer DR.SecretTransfer) {
+		if transfer.Reverse {
+			reverseAudit(transfer)
+			return
+		}
+		forwardAudit(transfer)
+	}
+
+	err = DR.Failback(job.ID,
+		DR.Endpoint{Client: clusters.source, K8sClient: clusters.sourceK8s, Provisioner: clusters.sourceProvisioner},
+		DR.Endpoint{Client: clusters.destination, K8sClient: clusters.destinationK8s, Provisioner: clusters.destinationProvisioner},
+		options, job.FailoverReplicas, recordDRStatus)
+	if err != nil {
+		context.JSON(409, gin.H{
+			"error": "Failed to start failback: " + err.Error(),
+		})
+		return
+	}
+	context.JSON(202, gin.H{
+		"message": "DR failback started",
+		"job_id":  job.ID,
+		"state":   DR.StateFailingBack,
 	})
 }
@@ -1,17 +1,39 @@
 package routes
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
+	"example.com/kuber/DR"
 	"example.com/kuber/db"
 	"example.com/kuber/models"
+	"example.com/kuber/provisioner"
 	"github.com/gin-gonic/gin"
 )
 
+// detailsQuery reads the details query parameter of the cluster listings:
+// details=false answers from the database alone, without contacting the
+// clusters.
+func detailsQuery(context *gin.Context) (bool, bool) {
+	details, err := strconv.ParseBool(context.DefaultQuery("details", "true"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "details must be true or false", "Error": err.Error()})
+		return false, false
+	}
+	return details, true
+}
+
 func getAllClusters(context *gin.Context) {
-	clusters, err := models.GetAllClusters()
+	details, ok := detailsQuery(context)
+	if !ok {
+		return
+	}
+	clusters, err := models.GetAllClusters(details)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Could not fetch results.", "Error": err.Error()})
 		return
@@ -38,11 +60,36 @@ func getClusterByID(context *gin.Context) {
 	context.JSON(http.StatusOK, gin.H{"Message": "Successfully fetched cluster", "cluster": cluster})
 }
 
+// externalProviders are the providers of existing clusters that can be
+// registered even though kuber has no provisioner for them.
+var externalProviders = map[string]bool{"aws": true, "azure": true, "gcp": true, "nutanix": true, "vmware": true}
+
+// registrableProvider reports whether an existing cluster of the provider can
+// be registered: any provider with a provisioner, or a known external one.
+func registrableProvider(name string) bool {
+	if externalProviders[name] {
+		return true
+	}
+	_, err := provisioner.Get(name)
+	return err == nil
+}
+
+// AddClusterRequest registers an existing cluster. Its kubeconfig is given
+// inline or as a "kubeconfig" file in a multipart form.
+type AddClusterRequest struct {
+	Name          string `json:"name" form:"name" binding:"required"`
+	Provisioner   string `json:"provisioner" form:"provisioner" binding:"required"`
+	Region        string `json:"region" form:"region" binding:"required"`
+	WorkspaceName string `json:"workspace_name" form:"workspace_name"`
+	// Kubeconfig is the kubeconfig YAML.
+	Kubeconfig string `json:"kubeconfig" form:"kubeconfig"`
+}
+
 func addCluster(context *gin.Context) {
-	var cluster models.Cluster
-	err := context.ShouldBindJSON(&cluster)
+	var addReq AddClusterRequest
+	err := context.ShouldBind(&addReq)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Check parameters", "Error": err.Error()})
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Check parameters", "Error": err.Error()})
 		return
 	}
 	userID := context.GetInt64("userID")
@@ -57,10 +104,19 @@ func addCluster(context *gin.Context) {
 			return
 		}
 	}
-	if cluster.WorkspaceName == "" {
-		cluster.WorkspaceName = "default"
+	if !registrableProvider(addReq.Provisioner) {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Unknown provisioner " + addReq.Provisioner})
+		return
+	}
+	kubeconfig, err := uploadedKubeconfig(context, addReq.Kubeconfig)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Invalid kubeconfig", "Error": err.Error()})
+		return
+	}
+	if addReq.WorkspaceName == "" {
+		addReq.WorkspaceName = "default"
 	}
-	workspaceID, err := models.GetWorkspaceIDByName(cluster.WorkspaceName)
+	workspaceID, err := models.GetWorkspaceIDByName(addReq.WorkspaceName)
 	if err != nil {
 		context.JSON(http.StatusBadRequest, gin.H{"Message": "Workspace not found", "Error": err.Error()})
 		return
@@ -70,24 +126,36 @@ func addCluster(context *gin.Context) {
 		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot generate UUID", "Error": err.Error()})
 		return
 	}
-	cluster.ID = uuid
-	cluster.WorkspaceID = workspaceID
-	cluster.Status = "Completed"
-	cluster.UserID = userID
-	cluster.CreatedAt = time.Now()
-	cluster.UpdatedAt = time.Now()
+	cluster := models.Cluster{
+		ID:            uuid,
+		Name:          addReq.Name,
+		Provisioner:   addReq.Provisioner,
+		Region:        addReq.Region,
+		WorkspaceID:   workspaceID,
+		WorkspaceName: addReq.WorkspaceName,
+		Status:        models.ClusterPending,
+		UserID:        userID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		Kubeconfig:    kubeconfig,
+	}
 
 	err = cluster.SaveCluster()
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot create cluster", "Error": err.Error()})
 		return
 	}
+	go refreshClusterStatus(cluster.ID)
 	context.JSON(http.StatusOK, gin.H{"Message": "Successfully saved clusters", "clusters": cluster})
 }
 
 func getClustersForUser(context *gin.Context) {
+	details, ok := detailsQuery(context)
+	if !ok {
+		return
+	}
 	userID := context.GetInt64("userID")
-	clusters, err := models.GetClustersForUser(userID)
+	clusters, err := models.GetClustersForUser(userID, details)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Could not fetch clusters for user.", "Error": err.Error()})
 		return
@@ -110,11 +178,14 @@ func getClustersByWorkspace(context *gin.Context) {
 	context.JSON(http.StatusOK, gin.H{"Message": "Successfully fetched clusters by workspace UUID", "clusters": workspace})
 }
 
+// createCluster provisions a new cluster in the background. The cluster is
+// recorded as Provisioning straight away and moves to Ready or Failed when the
+// provisioning job ends.
 func createCluster(context *gin.Context) {
-	var cluster models.Cluster
-	err := context.ShouldBindJSON(&cluster)
+	var createReq CreateClusterRequest
+	err := context.ShouldBindJSON(&createReq)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Check parameters", "Error": err.Error()})
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Check parameters", "Error": err.Error()})
 		return
 	}
 	userID := context.GetInt64("userID")
@@ -129,34 +200,334 @@ func createCluster(context *gin.Context) {
 			return
 		}
 	}
-	if cluster.WorkspaceName == "" {
-		cluster.WorkspaceName = "default"
+	driver, err := provisioner.Get(createReq.Provisioner)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Provisioner " + createReq.Provisioner + " cannot create clusters. Register an existing cluster with POST /kube/clusters/list instead.", "Error": err.Error()})
+		return
+	}
+	if createReq.Region == "" {
+		createReq.Region = "local"
+	}
+	spec := createReq.spec()
+	if err := driver.Validate(spec); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Check parameters", "Error": err.Error()})
+		return
 	}
-	workspaceID, err := models.GetWorkspaceIDByName(cluster.WorkspaceName)
+	if createReq.WorkspaceName == "" {
+		createReq.WorkspaceName = "default"
+	}
+	workspaceID, err := models.GetWorkspaceIDByName(createReq.WorkspaceName)
 	if err != nil {
 		context.JSON(http.StatusBadRequest, gin.H{"Message": "Workspace not found", "Error": err.Error()})
 		return
 	}
-	infraList, err := models.GetInfraByName(cluster.Provisioner)
-	if err != nil {
+	if _, err := models.GetClusterIDByName(createReq.Name); err == nil {
+		context.JSON(http.StatusConflict, gin.H{"Message": "A cluster named " + createReq.Name + " already exists"})
 		return
 	}
-	fmt.Println(infraList)
 	uuid, err := db.GetUUID()
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot generate UUID", "Error": err.Error()})
 		return
 	}
-	cluster.ID = uuid
-	cluster.WorkspaceID = workspaceID
-	cluster.Status = "Completed"
-	cluster.UserID = userID
-	cluster.CreatedAt = time.Now()
-	cluster.UpdatedAt = time.Now()
+	cluster := models.Cluster{
+		ID:            uuid,
+		Name:          createReq.Name,
+		Provisioner:   createReq.Provisioner,
+		Region:        createReq.Region,
+		WorkspaceID:   workspaceID,
+		WorkspaceName: createReq.WorkspaceName,
+		Status:        models.ClusterProvisioning,
+		UserID:        userID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
 	err = cluster.SaveCluster()
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot create cluster", "Error": err.Error()})
 		return
 	}
-	context.JSON(http.StatusOK, gin.H{"Message": "Successfully saved cluster", "cluster": cluster})
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot start provisioning job", "Error": err.Error()})
+		return
+	}
+	job := models.ProvisioningJob{ClusterID: cluster.ID, ClusterName: cluster.Name, Provisioner: cluster.Provisioner, Action: models.ProvisioningCreate, Spec: specJSON, UserID: userID}
+	if err := job.Save(); err != nil {
+		if statusErr := models.UpdateClusterStatus(cluster.ID, models.ClusterFailed, err.Error(), userID); statusErr != nil {
+			log.Printf("Cannot update status of cluster %s: %v", cluster.ID, statusErr)
+		}
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot start provisioning job", "Error": err.Error()})
+		return
+	}
+	startProvisioning(driver, cluster, job.ID, spec)
+	context.JSON(http.StatusAccepted, gin.H{"Message": "Cluster provisioning started", "cluster": cluster, "job": job})
+}
+
+// deleteCluster deregisters a cluster. A cluster that active DR jobs replicate
+// from or to is refused unless force=true, which stops those jobs first. With
+// delete_kubeconfig=true the kubeconfig file the cluster was registered from
+// is removed as well, unless another cluster is registered with it. With deprovision=true a cluster kuber
+// provisioned is deleted by its provisioner in the background and
+// deregistered, with its kubeconfig, once that succeeded.
+func deleteCluster(context *gin.Context) {
+	userID := context.GetInt64("userID")
+	role, permission, err := models.GetPermission(userID)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Cannot get roles and permissions"})
+		return
+	}
+	if role != "admin" {
+		if permission != "write" && permission != "full" {
+			context.JSON(http.StatusBadRequest, gin.H{"Message": "No permission to delete cluster."})
+			return
+		}
+	}
+	force, err := strconv.ParseBool(context.DefaultQuery("force", "false"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "force must be true or false", "Error": err.Error()})
+		return
+	}
+	deleteKubeconfig, err := strconv.ParseBool(context.DefaultQuery("delete_kubeconfig", "false"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "delete_kubeconfig must be true or false", "Error": err.Error()})
+		return
+	}
+	deprovision, err := strconv.ParseBool(context.DefaultQuery("deprovision", "false"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "deprovision must be true or false", "Error": err.Error()})
+		return
+	}
+	id := context.Param("id")
+	running, err := models.GetRunningProvisioningJob(id)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot fetch provisioning jobs of cluster.", "Error": err.Error()})
+		return
+	}
+	if running != nil {
+		context.JSON(http.StatusConflict, gin.H{"Message": "Cluster has a running provisioning job. Wait for it to finish before deleting the cluster.", "provisioning_job": running.ID})
+		return
+	}
+	var driver provisioner.Provisioner
+	var spec provisioner.ClusterSpec
+	var specJSON json.RawMessage
+	if deprovision {
+		specJSON, err = models.GetClusterProvisioningSpec(id)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot fetch how the cluster was provisioned.", "Error": err.Error()})
+			return
+		}
+		if specJSON == nil {
+			context.JSON(http.StatusBadRequest, gin.H{"Message": "Cluster was not provisioned by kuber. Delete it without deprovision=true to deregister it."})
+			return
+		}
+		if err := json.Unmarshal(specJSON, &spec); err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"Message": "Invalid provisioning spec.", "Error": err.Error()})
+			return
+		}
+		provisionerName, err := models.GetProvisionerByID(id)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot fetch cluster provisioner.", "Error": err.Error()})
+			return
+		}
+		driver, err = provisioner.Get(provisionerName)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"Message": "Cannot deprovision cluster.", "Error": err.Error()})
+			return
+		}
+	}
+	jobs, err := models.GetActiveDRJobsForCluster(id)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot fetch DR jobs of cluster.", "Error": err.Error()})
+		return
+	}
+	jobIDs := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		jobIDs = append(jobIDs, job.ID)
+	}
+	if len(jobs) > 0 && !force {
+		context.JSON(http.StatusConflict, gin.H{"Message": "Cluster is part of active DR jobs. Stop them or retry with force=true.", "dr_jobs": jobIDs})
+		return
+	}
+	for _, job := range jobs {
+		err := DR.StopSession(job.ID)
+		if err != nil && !errors.Is(err, DR.ErrSessionNotFound) {
+			context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot stop DR job " + job.ID, "Error": err.Error()})
+			return
+		}
+		err = models.UpdateDRJobState(job.ID, DR.StateStopped, "cluster "+id+" was deleted")
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot stop DR job " + job.ID, "Error": err.Error()})
+			return
+		}
+	}
+	if deprovision {
+		err := models.UpdateClusterStatus(id, models.ClusterDeleting, "deprovisioning with "+driver.Name(), userID)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot delete cluster.", "Error": err.Error()})
+			return
+		}
+		job := models.ProvisioningJob{ClusterID: id, ClusterName: spec.Name, Provisioner: driver.Name(), Action: models.ProvisioningDelete, Spec: specJSON, UserID: userID}
+		if err := job.Save(); err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot start deprovisioning job", "Error": err.Error()})
+			return
+		}
+		startDeprovisioning(driver, id, job.ID, spec, userID)
+		context.JSON(http.StatusAccepted, gin.H{"Message": "Cluster deprovisioning started", "id": id, "stopped_dr_jobs": jobIDs, "job": job})
+		return
+	}
+	kubeconfigDeleted, kubeconfigError, err := deregisterCluster(id, userID, deleteKubeconfig)
+	if errors.Is(err, models.ErrClusterNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"Message": "Cluster not found."})
+		return
+	}
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot delete cluster.", "Error": err.Error()})
+		return
+	}
+	response := gin.H{"Message": "Successfully deleted cluster", "id": id, "stopped_dr_jobs": jobIDs, "kubeconfig_deleted": kubeconfigDeleted}
+	if kubeconfigError != "" {
+		response["kubeconfig_error"] = kubeconfigError
+	}
+	context.JSON(http.StatusOK, response)
+}
+
+// deregisterCluster removes a cluster record, with its stored kubeconfig,
+// and, when asked, the kubeconfig file it was registered from unless another
+// cluster is registered with it. It reports whether the kubeconfig was
+// deleted and why not if deleting it failed.
+func deregisterCluster(id string, userID int64, deleteKubeconfig bool) (bool, string, error) {
+	kubeconfigFilePath, shared, err := models.DeleteCluster(id, userID)
+	if err != nil {
+		return false, "", err
+	}
+	if kubeconfigFilePath == "" {
+		// The kubeconfig was only stored with the cluster record.
+		return true, "", nil
+	}
+	if !deleteKubeconfig {
+		return false, "", nil
+	}
+	if shared {
+		return false, "kubeconfig is used by other clusters", nil
+	}
+	err = os.Remove(kubeconfigFilePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Cannot delete kubeconfig of cluster %s: %v", id, err)
+		return false, err.Error(), nil
+	}
+	return true, "", nil
+}
+
+// ClusterUpdateRequest holds the fields of a cluster to change; omitted fields
+// are kept.
+type ClusterUpdateRequest struct {
+	Name          *string `json:"name"`
+	Region        *string `json:"region"`
+	WorkspaceName *string `json:"workspace_name"`
+	// Kubeconfig replaces the kubeconfig of the cluster with inline YAML.
+	Kubeconfig *string `json:"kubeconfig"`
+	// Status moves the cluster along its lifecycle; Reason is recorded with
+	// the transition.
+	Status *string `json:"status"`
+	Reason string  `json:"reason"`
+}
+
+// refreshClusterStatus probes a cluster and moves it to the status it is
+// observed in. It runs in the background after a cluster is registered or its
+// kubeconfig replaced, since an unreachable API server takes a while to time
+// out.
+func refreshClusterStatus(id string) {
+	status, reason := models.ProbeClusterStatus(id)
+	if err := models.UpdateClusterStatus(id, status, reason, 0); err != nil {
+		log.Printf("Cannot update status of cluster %s: %v", id, err)
+	}
+}
+
+func updateCluster(context *gin.Context) {
+	userID := context.GetInt64("userID")
+	role, permission, err := models.GetPermission(userID)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Cannot get roles and permissions"})
+		return
+	}
+	if role != "admin" {
+		if permission != "write" && permission != "full" {
+			context.JSON(http.StatusBadRequest, gin.H{"Message": "No permission to update cluster."})
+			return
+		}
+	}
+	var updateReq ClusterUpdateRequest
+	if err := context.ShouldBindJSON(&updateReq); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Check parameters", "Error": err.Error()})
+		return
+	}
+	id := context.Param("id")
+	update := models.ClusterUpdate{Region: updateReq.Region}
+	if updateReq.Name != nil {
+		if *updateReq.Name == "" {
+			context.JSON(http.StatusBadRequest, gin.H{"Message": "Cluster name cannot be empty"})
+			return
+		}
+		existingID, err := models.GetClusterIDByName(*updateReq.Name)
+		if err == nil && existingID != id {
+			context.JSON(http.StatusConflict, gin.H{"Message": "A cluster named " + *updateReq.Name + " already exists"})
+			return
+		}
+		update.Name = updateReq.Name
+	}
+	if updateReq.WorkspaceName != nil {
+		workspaceID, err := models.GetWorkspaceIDByName(*updateReq.WorkspaceName)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"Message": "Workspace not found", "Error": err.Error()})
+			return
+		}
+		update.WorkspaceID = &workspaceID
+	}
+	if updateReq.Kubeconfig != nil {
+		kubeconfig, err := models.NormalizeKubeconfig([]byte(*updateReq.Kubeconfig))
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"Message": "Invalid kubeconfig", "Error": err.Error()})
+			return
+		}
+		update.Kubeconfig = kubeconfig
+	}
+	if updateReq.Status != nil && !models.IsClusterStatus(*updateReq.Status) {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Unknown cluster status " + *updateReq.Status})
+		return
+	}
+	update.Status = updateReq.Status
+	update.StatusReason = updateReq.Reason
+	update.UserID = userID
+	err = models.UpdateCluster(id, update)
+	if errors.Is(err, models.ErrClusterNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"Message": "Cluster not found."})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidClusterStatusTransition) {
+		context.JSON(http.StatusConflict, gin.H{"Message": "Cannot change cluster status.", "Error": err.Error()})
+		return
+	}
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot update cluster.", "Error": err.Error()})
+		return
+	}
+	if updateReq.Status == nil && updateReq.Kubeconfig != nil {
+		go refreshClusterStatus(id)
+	}
+	context.JSON(http.StatusOK, gin.H{"Message": "Successfully updated cluster", "id": id})
+}
+
+func getClusterStatusHistory(context *gin.Context) {
+	limit, err := strconv.Atoi(context.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "limit must be a positive number"})
+		return
+	}
+	history, err := models.GetClusterStatusHistory(context.Param("id"), limit)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Could not fetch cluster status history.", "Error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"Message": "Successfully fetched cluster status history", "history": history})
 }
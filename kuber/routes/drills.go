@@ -0,0 +1,348 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"example.com/kuber/DR"
+	"example.com/kuber/models"
+	"github.com/gin-gonic/gin"
+)
+
+type DRDrillRequest struct {
+	// Schedule is a five-field cron expression evaluated in UTC, e.g.
+	// "0 3 * * 1" for every Monday at 03:00.
+	Schedule string `json:"schedule" binding:"required"`
+	// The drill scope on the destination; at least one must be set.
+	IncludeNamespaces []string `json:"include_namespaces"`
+	LabelSelector     string   `json:"label_selector"`
+	// How long to wait for the Deployments to become Available: 0 uses
+	// DR.DefaultDrillTimeout.
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// Enabled defaults to true; a disabled drill only runs on demand.
+	Enabled *bool `json:"enabled"`
+}
+
+func drillOptions(drill *models.DRDrill) DR.DrillOptions {
+	return DR.DrillOptions{
+		Scope: DR.Scope{
+			IncludeNamespaces: drill.IncludeNamespaces,
+			LabelSelector:     drill.LabelSelector,
+		},
+		Timeout: time.Duration(drill.TimeoutSeconds) * time.Second,
+	}
+}
+
+// authorizeDRChange writes the error response itself and reports false when
+// the user may not manage DR jobs.
+func authorizeDRChange(context *gin.Context) bool {
+	authorized, err := isAuthorized(context.GetInt64("userID"))
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Cannot get roles and permissions: " + err.Error(),
+		})
+		return false
+	}
+	if !authorized {
+		context.JSON(401, gin.H{
+			"error": "No permission to manage DR jobs",
+		})
+		return false
+	}
+	return true
+}
+
+// findDRJob looks up the DR job named by the :id parameter. It writes the
+// error response itself and returns nil when there is none.
+func findDRJob(context *gin.Context) *models.DRJob {
+	job, err := models.GetDRJobByID(context.Param("id"))
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to fetch DR job: " + err.Error(),
+		})
+		return nil
+	}
+	if job == nil {
+		context.JSON(404, gin.H{
+			"error": "DR job not found",
+		})
+		return nil
+	}
+	return job
+}
+
+// findDRDrill looks up the drill named by the :drill_id parameter within job.
+// It writes the error response itself and returns nil when there is none.
+func findDRDrill(context *gin.Context, job *models.DRJob) *models.DRDrill {
+	drill, err := models.GetDRDrillByID(context.Param("drill_id"))
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to fetch DR drill: " + err.Error(),
+		})
+		return nil
+	}
+	if drill == nil || drill.JobID != job.ID {
+		context.JSON(404, gin.H{
+			"error": "DR drill not found",
+		})
+		return nil
+	}
+	return drill
+}
+
+func createDRDrill(context *gin.Context) {
+	if !authorizeDRChange(context) {
+		return
+	}
+	job := findDRJob(context)
+	if job == nil {
+		return
+	}
+	if job.DRType != DR.DRTypeActivePassive {
+		context.JSON(400, gin.H{
+			"error": "Drills need an active-passive DR job",
+		})
+		return
+	}
+	var jobReq ClusterDRRequest
+	if err := json.Unmarshal(job.Options, &jobReq); err == nil && jobReq.isFanOut() {
+		context.JSON(400, gin.H{
+			"error": "Drills are not supported for a DR job with several destinations",
+		})
+		return
+	}
+	var drillReq DRDrillRequest
+	if err := context.ShouldBindJSON(&drillReq); err != nil {
+		context.JSON(400, gin.H{
+			"error": "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	schedule, err := DR.ParseCronSchedule(drillReq.Schedule)
+	if err != nil {
+		context.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	drill := models.DRDrill{
+		JobID:             job.ID,
+		Schedule:          drillReq.Schedule,
+		IncludeNamespaces: drillReq.IncludeNamespaces,
+		LabelSelector:     drillReq.LabelSelector,
+		TimeoutSeconds:    drillReq.TimeoutSeconds,
+		Enabled:           drillReq.Enabled == nil || *drillReq.Enabled,
+		UserID:            context.GetInt64("userID"),
+	}
+	if err := drillOptions(&drill).Validate(); err != nil {
+		context.JSON(400, gin.H{
+			"error": "Invalid drill: " + err.Error(),
+		})
+		return
+	}
+	if drill.Enabled {
+		next := schedule.Next(time.Now())
+		drill.NextRunAt = &next
+	}
+	if err := drill.Save(); err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to record DR drill: " + err.Error(),
+		})
+		return
+	}
+	if drill.Enabled {
+		DR.ScheduleDrill(drill.ID, schedule, func() { executeDRDrill(drill.ID) })
+	}
+	context.JSON(201, gin.H{
+		"message": "DR drill scheduled",
+		"drill":   drill,
+	})
+}
+
+func getDRDrills(context *gin.Context) {
+	job := findDRJob(context)
+	if job == nil {
+		return
+	}
+	drills, err := models.GetDRDrills(job.ID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to fetch DR drills: " + err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message": "Successfully fetched DR drills",
+		"job_id":  job.ID,
+		"drills":  drills,
+	})
+}
+
+// deleteDRDrill removes a drill schedule; its reports are kept.
+func deleteDRDrill(context *gin.Context) {
+	if !authorizeDRChange(context) {
+		return
+	}
+	job := findDRJob(context)
+	if job == nil {
+		return
+	}
+	drill := findDRDrill(context, job)
+	if drill == nil {
+		return
+	}
+	DR.UnscheduleDrill(drill.ID)
+	if err := models.DeleteDRDrill(drill.ID); err != nil {
+		context.JSON(500, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":  "DR drill deleted",
+		"drill_id": drill.ID,
+	})
+}
+
+// runDRDrill starts a drill right away, whether or not it is enabled. The
+// report is stored like that of a scheduled run.
+func runDRDrill(context *gin.Context) {
+	if !authorizeDRChange(context) {
+		return
+	}
+	job := findDRJob(context)
+	if job == nil {
+		return
+	}
+	drill := findDRDrill(context, job)
+	if drill == nil {
+		return
+	}
+	go executeDRDrill(drill.ID)
+	context.JSON(202, gin.H{
+		"message":  "DR drill started",
+		"drill_id": drill.ID,
+	})
+}
+
+// getDRDrillReports lists the drill reports of a job, newest first, and when a
+// drill last passed. ?drill_id= narrows it to one drill.
+func getDRDrillReports(context *gin.Context) {
+	limit, err := strconv.Atoi(context.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		context.JSON(400, gin.H{
+			"error": "limit must be a positive number",
+		})
+		return
+	}
+	job := findDRJob(context)
+	if job == nil {
+		return
+	}
+	reports, err := models.GetDRDrillReports(job.ID, context.Query("drill_id"), limit)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to fetch DR drill reports: " + err.Error(),
+		})
+		return
+	}
+	lastPassedAt, err := models.GetLastPassedDRDrillAt(job.ID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":        "Successfully fetched DR drill reports",
+		"job_id":         job.ID,
+		"last_passed_at": lastPassedAt,
+		"reports":        reports,
+	})
+}
+
+// ScheduleDRDrills schedules every enabled drill stored in the database. It is
+// called once at startup.
+func ScheduleDRDrills() {
+	drills, err := models.GetDRDrills("")
+	if err != nil {
+		log.Printf("Failed to load DR drills: %v", err)
+		return
+	}
+	for _, drill := range drills {
+		if !drill.Enabled {
+			continue
+		}
+		schedule, err := DR.ParseCronSchedule(drill.Schedule)
+		if err != nil {
+			log.Printf("Skipping DR drill %s: %v", drill.ID, err)
+			continue
+		}
+		drillID := drill.ID
+		DR.ScheduleDrill(drillID, schedule, func() { executeDRDrill(drillID) })
+	}
+}
+
+// executeDRDrill runs a drill against the destination of its job and stores
+// the report.
+func executeDRDrill(drillID string) {
+	drill, err := models.GetDRDrillByID(drillID)
+	if err != nil || drill == nil {
+		log.Printf("Cannot run DR drill %s: %v", drillID, err)
+		return
+	}
+	job, err := models.GetDRJobByID(drill.JobID)
+	if err != nil || job == nil {
+		log.Printf("Cannot run DR drill %s: DR job %s not found: %v", drillID, drill.JobID, err)
+		return
+	}
+
+	var report *DR.DrillReport
+	switch job.State {
+	case DR.StateFailedOver, DR.StateFailingBack:
+		err = errors.New("the destination has been promoted")
+	case DR.StateStopped, DR.StateFailed:
+		err = errors.New("the DR job is " + job.State)
+	}
+	if err == nil {
+		var clients *models.ClusterClients
+		clients, err = models.GetClusterClients(job.DestinationClusterID)
+		if err == nil {
+			report = DR.RunDrill(job.ID, clients.Kube, drillOptions(drill))
+		}
+	}
+	if report == nil {
+		now := time.Now()
+		report = &DR.DrillReport{JobID: job.ID, StartedAt: now, FinishedAt: now, Error: err.Error()}
+	}
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("Failed to encode report of DR drill %s: %v", drillID, err)
+	}
+	record := models.DRDrillReport{
+		DrillID:           drill.ID,
+		JobID:             job.ID,
+		Passed:            report.Passed,
+		StartedAt:         report.StartedAt,
+		FinishedAt:        report.FinishedAt,
+		DurationMs:        report.DurationMs,
+		TimeToAvailableMs: report.TimeToAvailableMs,
+		Error:             report.Error,
+		Report:            encoded,
+	}
+	if err := record.Save(); err != nil {
+		log.Printf("Failed to record report of DR drill %s: %v", drillID, err)
+	}
+	var next *time.Time
+	if schedule, err := DR.ParseCronSchedule(drill.Schedule); err == nil && drill.Enabled {
+		at := schedule.Next(time.Now())
+		next = &at
+	}
+	if err := models.RecordDRDrillRun(drill.ID, report.StartedAt, report.Passed, next); err != nil {
+		log.Printf("Failed to record run of DR drill %s: %v", drillID, err)
+	}
+}
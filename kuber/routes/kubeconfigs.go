@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"example.com/kuber/models"
+	"github.com/gin-gonic/gin"
+)
+
+// maxKubeconfigSize bounds an uploaded kubeconfig.
+const maxKubeconfigSize = 1 << 20
+
+// KubeconfigRequest replaces the kubeconfig of a cluster with inline YAML.
+// The kubeconfig can also be uploaded as a "kubeconfig" file in a multipart
+// form.
+type KubeconfigRequest struct {
+	Kubeconfig string `json:"kubeconfig" form:"kubeconfig"`
+}
+
+// uploadedKubeconfig returns the normalized kubeconfig of a request: the
+// inline YAML if given, else the "kubeconfig" file of a multipart form.
+func uploadedKubeconfig(context *gin.Context, inline string) ([]byte, error) {
+	data := []byte(inline)
+	if inline == "" && strings.HasPrefix(context.ContentType(), "multipart/form-data") {
+		file, err := context.FormFile("kubeconfig")
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig file is required: %w", err)
+		}
+		if file.Size > maxKubeconfigSize {
+			return nil, fmt.Errorf("kubeconfig is larger than %d bytes", maxKubeconfigSize)
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read kubeconfig: %w", err)
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(io.LimitReader(f, maxKubeconfigSize)); err != nil {
+			return nil, fmt.Errorf("cannot read kubeconfig: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil, errors.New("kubeconfig is required")
+	}
+	if len(data) > maxKubeconfigSize {
+		return nil, fmt.Errorf("kubeconfig is larger than %d bytes", maxKubeconfigSize)
+	}
+	return models.NormalizeKubeconfig(data)
+}
+
+// setClusterKubeconfig replaces the stored kubeconfig of a cluster, e.g. when
+// its credentials are rotated, and probes the cluster with it.
+func setClusterKubeconfig(context *gin.Context) {
+	userID := context.GetInt64("userID")
+	role, permission, err := models.GetPermission(userID)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Cannot get roles and permissions"})
+		return
+	}
+	if role != "admin" {
+		if permission != "write" && permission != "full" {
+			context.JSON(http.StatusBadRequest, gin.H{"Message": "No permission to update cluster."})
+			return
+		}
+	}
+	var kubeconfigReq KubeconfigRequest
+	if err := context.ShouldBind(&kubeconfigReq); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Check parameters", "Error": err.Error()})
+		return
+	}
+	kubeconfig, err := uploadedKubeconfig(context, kubeconfigReq.Kubeconfig)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "Invalid kubeconfig", "Error": err.Error()})
+		return
+	}
+	id := context.Param("id")
+	err = models.SetClusterKubeconfig(id, kubeconfig)
+	if errors.Is(err, models.ErrClusterNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"Message": "Cluster not found."})
+		return
+	}
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Cannot store kubeconfig.", "Error": err.Error()})
+		return
+	}
+	go refreshClusterStatus(id)
+	context.JSON(http.StatusOK, gin.H{"Message": "Successfully stored kubeconfig", "id": id})
+}
+
+// ImportKubeconfigFiles stores the kubeconfig files of clusters registered by
+// path before kubeconfigs were kept in the database. Clusters whose file
+// cannot be imported keep being read from it.
+func ImportKubeconfigFiles() {
+	imported, failed, err := models.ImportKubeconfigFiles()
+	if err != nil {
+		log.Printf("Cannot import kubeconfig files: %v", err)
+		return
+	}
+	if len(imported) > 0 {
+		log.Printf("Imported the kubeconfig files of %d clusters", len(imported))
+	}
+	for id, err := range failed {
+		log.Printf("Cannot import the kubeconfig file of cluster %s: %v", id, err)
+	}
+}
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+
+	"example.com/kuber/DR"
+	"github.com/gin-gonic/gin"
+)
+
+// endpoints returns the source and destination of a DR request as DR sees them.
+func (c *drClusters) endpoints() (DR.Endpoint, DR.Endpoint) {
+	return DR.Endpoint{Client: c.source, K8sClient: c.sourceK8s, Provisioner: c.sourceProvisioner},
+		DR.Endpoint{Client: c.destination, K8sClient: c.destinationK8s, Provisioner: c.destinationProvisioner}
+}
+
+// runDRPreflight checks one destination of a DR request. When the capacity of
+// the destination cannot be read the comparison is skipped with a warning.
+func runDRPreflight(source, destination DR.Endpoint, destinationClusterID string, options DR.Options) (*DR.PreflightReport, error) {
+	available, capacityErr := DR.AvailableCapacity(destination.K8sClient)
+	if capacityErr != nil {
+		log.Printf("Cannot read the capacity of cluster %s: %v", destinationClusterID, capacityErr)
+	}
+	report, err := DR.Preflight(source, destination, options, available)
+	if err != nil {
+		return nil, err
+	}
+	if capacityErr != nil {
+		report.Warnings = append(report.Warnings, DR.PreflightFinding{
+			Check:   DR.PreflightCapacity,
+			Message: "cannot compare with the destination capacity: " + capacityErr.Error(),
+		})
+	}
+	return report, nil
+}
+
+// destinationPreflight is the preflight report of one destination of a
+// fan-out request.
+type destinationPreflight struct {
+	DestinationClusterID string              `json:"destination_cluster_id"`
+	Report               *DR.PreflightReport `json:"report"`
+}
+
+// preflightFanOut checks every destination of a fan-out request and reports
+// whether all of them passed.
+func preflightFanOut(source DR.Endpoint, destinations []DR.Destination, options DR.Options) ([]destinationPreflight, bool, error) {
+	reports := make([]destinationPreflight, 0, len(destinations))
+	passed := true
+	for _, d := range destinations {
+		report, err := runDRPreflight(source, d.Endpoint, d.ID, d.Options(options))
+		if err != nil {
+			return nil, false, fmt.Errorf("destination %s: %w", d.ID, err)
+		}
+		passed = passed && report.Passed
+		reports = append(reports, destinationPreflight{DestinationClusterID: d.ID, Report: report})
+	}
+	return reports, passed, nil
+}
+
+// preflightDR checks whether the destination of a DR request can host what
+// it would replicate, without starting anything.
+func preflightDR(context *gin.Context) {
+	ClusterDRReq, options, ok := bindDRRequest(context)
+	if !ok {
+		return
+	}
+	if ClusterDRReq.isFanOut() {
+		source, destinations, ok := loadDRDestinations(context, ClusterDRReq, options)
+		if !ok {
+			return
+		}
+		reports, passed, err := preflightFanOut(source, destinations, options)
+		if err != nil {
+			context.JSON(500, gin.H{
+				"error": "Failed to run DR preflight checks: " + err.Error(),
+			})
+			return
+		}
+		context.JSON(200, gin.H{
+			"message":   "DR preflight checks finished",
+			"passed":    passed,
+			"preflight": reports,
+		})
+		return
+	}
+	clusters, ok := loadDRClusters(context, ClusterDRReq.SourceClusterID, ClusterDRReq.DestinationClusterID)
+	if !ok {
+		return
+	}
+	source, destination := clusters.endpoints()
+	report, err := runDRPreflight(source, destination, ClusterDRReq.DestinationClusterID, options)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to run DR preflight checks: " + err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":   "DR preflight checks finished",
+		"passed":    report.Passed,
+		"preflight": report,
+	})
+}
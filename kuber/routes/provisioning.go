@@ -0,0 +1,208 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/kuber/models"
+	"example.com/kuber/provisioner"
+	"github.com/gin-gonic/gin"
+)
+
+// provisioningTimeout bounds a whole provisioning job.
+const provisioningTimeout = 15 * time.Minute
+
+// CreateClusterRequest asks kuber to provision a new cluster rather than
+// register an existing one.
+type CreateClusterRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Provisioner   string `json:"provisioner" binding:"required"`
+	Region        string `json:"region"`
+	WorkspaceName string `json:"workspace_name"`
+	Workers       int    `json:"workers"`
+	// Options are specific to the provisioner, e.g. node_image for kind.
+	Options json.RawMessage `json:"options"`
+}
+
+func (r *CreateClusterRequest) spec() provisioner.ClusterSpec {
+	return provisioner.ClusterSpec{Name: r.Name, Region: r.Region, Workers: r.Workers, Options: r.Options}
+}
+
+// startProvisioning creates a cluster with its provisioner in the background,
+// stores its kubeconfig and moves the cluster to Ready or Failed when it is
+// done.
+func startProvisioning(driver provisioner.Provisioner, cluster models.Cluster, jobID string, spec provisioner.ClusterSpec) {
+	provisioner.StartJob(jobID, provisioningTimeout,
+		func(ctx context.Context, logs io.Writer) error {
+			if err := driver.Create(ctx, spec, logs); err != nil {
+				return err
+			}
+			kubeconfig, err := driver.GetKubeconfig(ctx, spec)
+			if err != nil {
+				return err
+			}
+			kubeconfig, err = models.NormalizeKubeconfig(kubeconfig)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(logs, "Storing kubeconfig")
+			return models.SetClusterKubeconfig(cluster.ID, kubeconfig)
+		},
+		func(logs string, err error) {
+			state, status, reason, lastError := models.ProvisioningSucceeded, models.ClusterReady, "cluster provisioned by "+driver.Name(), ""
+			if err != nil {
+				state, status, reason, lastError = models.ProvisioningFailed, models.ClusterFailed, err.Error(), err.Error()
+			}
+			if err := models.FinishProvisioningJob(jobID, state, logs, lastError); err != nil {
+				log.Printf("Cannot record the end of provisioning job %s: %v", jobID, err)
+			}
+			if err := models.UpdateClusterStatus(cluster.ID, status, reason, 0); err != nil {
+				log.Printf("Cannot update status of cluster %s: %v", cluster.ID, err)
+			}
+		})
+}
+
+// startDeprovisioning deletes a cluster with its provisioner in the
+// background and deregisters it, with its kubeconfig, once that succeeded. A
+// cluster that failed to be deleted moves to Failed and can be deleted again.
+func startDeprovisioning(driver provisioner.Provisioner, clusterID, jobID string, spec provisioner.ClusterSpec, userID int64) {
+	provisioner.StartJob(jobID, provisioningTimeout,
+		func(ctx context.Context, logs io.Writer) error {
+			if err := driver.Delete(ctx, spec, logs); err != nil {
+				return err
+			}
+			kubeconfigDeleted, kubeconfigError, err := deregisterCluster(clusterID, userID, true)
+			if err != nil {
+				return err
+			}
+			if kubeconfigDeleted {
+				fmt.Fprintln(logs, "Cluster deregistered and its kubeconfig deleted")
+			} else {
+				fmt.Fprintf(logs, "Cluster deregistered; kubeconfig kept: %s\n", kubeconfigError)
+			}
+			return nil
+		},
+		func(logs string, err error) {
+			state, lastError := models.ProvisioningSucceeded, ""
+			if err != nil {
+				state, lastError = models.ProvisioningFailed, err.Error()
+			}
+			if err := models.FinishProvisioningJob(jobID, state, logs, lastError); err != nil {
+				log.Printf("Cannot record the end of provisioning job %s: %v", jobID, err)
+			}
+			if err == nil {
+				return
+			}
+			reason := "deprovisioning failed: " + err.Error()
+			if err := models.UpdateClusterStatus(clusterID, models.ClusterFailed, reason, 0); err != nil {
+				log.Printf("Cannot update status of cluster %s: %v", clusterID, err)
+			}
+		})
+}
+
+// RecoverProvisioningJobs fails the provisioning jobs a server restart
+// interrupted, and the clusters they were creating or deleting, since nothing
+// is left to finish them.
+func RecoverProvisioningJobs() {
+	jobs, err := models.FailInterruptedProvisioningJobs()
+	if err != nil {
+		log.Printf("Cannot recover provisioning jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		reason := "provisioning interrupted by a server restart"
+		if job.Action == models.ProvisioningDelete {
+			reason = "deprovisioning interrupted by a server restart"
+		}
+		err := models.UpdateClusterStatus(job.ClusterID, models.ClusterFailed, reason, 0)
+		if err != nil {
+			log.Printf("Cannot update status of cluster %s: %v", job.ClusterID, err)
+		}
+	}
+}
+
+func getProvisioningJob(context *gin.Context) {
+	job, err := models.GetProvisioningJobByID(context.Param("id"))
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Could not fetch provisioning job.", "Error": err.Error()})
+		return
+	}
+	if job == nil {
+		context.JSON(http.StatusNotFound, gin.H{"Message": "Provisioning job not found."})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"Message": "Successfully fetched provisioning job", "job": job})
+}
+
+func getClusterProvisioningJobs(context *gin.Context) {
+	jobs, err := models.GetProvisioningJobs(context.Param("id"))
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Could not fetch provisioning jobs.", "Error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"Message": "Successfully fetched provisioning jobs", "jobs": jobs})
+}
+
+// getProvisioningJobLogs returns the log of a provisioning job. With
+// follow=true the log of a running job is streamed as plain text until the
+// job ends.
+func getProvisioningJobLogs(context *gin.Context) {
+	follow, err := strconv.ParseBool(context.DefaultQuery("follow", "false"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"Message": "follow must be true or false", "Error": err.Error()})
+		return
+	}
+	id := context.Param("id")
+	if job := provisioner.GetJob(id); job != nil {
+		if !follow {
+			logs, done, _ := job.Logs(0)
+			context.JSON(http.StatusOK, gin.H{"Message": "Successfully fetched provisioning job logs", "id": id, "done": done, "logs": string(logs)})
+			return
+		}
+		context.Header("Content-Type", "text/plain; charset=utf-8")
+		offset := 0
+		context.Stream(func(w io.Writer) bool {
+			chunk, done, changed := job.Logs(offset)
+			if len(chunk) > 0 {
+				offset += len(chunk)
+				_, err := w.Write(chunk)
+				return err == nil
+			}
+			if done {
+				return false
+			}
+			select {
+			case <-changed:
+				return true
+			case <-context.Request.Context().Done():
+				return false
+			}
+		})
+		return
+	}
+	stored, err := models.GetProvisioningJobByID(id)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Could not fetch provisioning job.", "Error": err.Error()})
+		return
+	}
+	if stored == nil {
+		context.JSON(http.StatusNotFound, gin.H{"Message": "Provisioning job not found."})
+		return
+	}
+	logs, err := models.GetProvisioningJobLogs(id)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"Message": "Could not fetch provisioning job logs.", "Error": err.Error()})
+		return
+	}
+	if follow {
+		context.String(http.StatusOK, logs)
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"Message": "Successfully fetched provisioning job logs", "id": id, "done": stored.State != models.ProvisioningRunning, "logs": logs})
+}
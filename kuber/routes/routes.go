@@ -26,12 +26,43 @@ func Routes(server *gin.Engine) {
 	authenticationGroups.GET("/kube/cluster/workspaces/:workspace_uuid", getClustersByWorkspace)
 	authenticationGroups.GET("/kube/users/list/permission", getPermissions)
 	authenticationGroups.DELETE("/users/:id/delete", deleteUser)
-	// authenticationGroups.DELETE("/kube/clusters/:id/delete", deleteCluster)
+	authenticationGroups.PATCH("/kube/clusters/:id", updateCluster)
+	authenticationGroups.DELETE("/kube/clusters/:id", deleteCluster)
+	authenticationGroups.PUT("/kube/clusters/:id/kubeconfig", setClusterKubeconfig)
+	authenticationGroups.GET("/kube/clusters/:id/status-history", getClusterStatusHistory)
+	authenticationGroups.GET("/kube/clusters/:id/provisioning-jobs", getClusterProvisioningJobs)
+	authenticationGroups.GET("/kube/provisioning-jobs/:id", getProvisioningJob)
+	authenticationGroups.GET("/kube/provisioning-jobs/:id/logs", getProvisioningJobLogs)
 	authenticationGroups.POST("/kube/infrastructure/aws", AWSInfra)
 	authenticationGroups.POST("/kube/infrastructure/nutanix", NutanixInfra)
 	// authenticationGroups.POST("/kube/infrastructure/vmware", VMwareInfra)
 
 	authenticationGroups.POST("/kube/dr/apply", clusterDR)
+	authenticationGroups.POST("/kube/dr/plan", planDR)
+	authenticationGroups.POST("/kube/dr/preflight", preflightDR)
+	authenticationGroups.GET("/kube/dr", getDRJobs)
+	authenticationGroups.GET("/kube/dr/presets", getDRPreset)
+	authenticationGroups.GET("/kube/dr/:id", getDRJobByID)
+	authenticationGroups.GET("/kube/dr/:id/repairs", getDRRepairs)
+	authenticationGroups.GET("/kube/dr/:id/objects", getDRJobObjects)
+	authenticationGroups.POST("/kube/dr/:id/stop", stopDRJob)
+	authenticationGroups.POST("/kube/dr/:id/pause", pauseDRJob)
+	authenticationGroups.POST("/kube/dr/:id/resume", resumeDRJob)
+	authenticationGroups.POST("/kube/dr/:id/failback", failbackDRJob)
+	authenticationGroups.POST("/kube/dr/:id/drills", createDRDrill)
+	authenticationGroups.GET("/kube/dr/:id/drills", getDRDrills)
+	authenticationGroups.DELETE("/kube/dr/:id/drills/:drill_id", deleteDRDrill)
+	authenticationGroups.POST("/kube/dr/:id/drills/:drill_id/run", runDRDrill)
+	authenticationGroups.GET("/kube/dr/:id/drill-reports", getDRDrillReports)
+	authenticationGroups.GET("/kube/dr/:id/secret-transfers", getDRSecretTransfers)
+	authenticationGroups.PUT("/kube/cluster/:id/dr-secret-overrides", setDRSecretOverrides)
+	authenticationGroups.GET("/kube/cluster/:id/dr-secret-overrides", getDRSecretOverrides)
+	authenticationGroups.DELETE("/kube/cluster/:id/dr-secret-overrides/:override_id", deleteDRSecretOverride)
+	authenticationGroups.POST("/kube/snapshots", createSnapshot)
+	authenticationGroups.GET("/kube/snapshots", getSnapshots)
+	authenticationGroups.GET("/kube/snapshots/:id", getSnapshotByID)
+	authenticationGroups.DELETE("/kube/snapshots/:id", deleteSnapshot)
+	authenticationGroups.POST("/kube/snapshots/:id/restore", restoreSnapshot)
 	clusterActionGroup := server.Group("/kube/cluster/actions")
 	clusterActionGroup.Use(Middleware.Authentication)
 	clusterActionGroup.GET(":id/services", getServices)
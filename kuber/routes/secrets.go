@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"log"
+	"strconv"
+
+	"example.com/kuber/DR"
+	"example.com/kuber/models"
+	"github.com/gin-gonic/gin"
+)
+
+type DRSecretOverrideRequest struct {
+	Namespace string `json:"namespace" binding:"required"`
+	Name      string `json:"name" binding:"required"`
+	// Values replace the values of these keys of the Secret on the cluster.
+	Values map[string]string `json:"values" binding:"required"`
+}
+
+// drSecretOverrides reads the overrides store of a destination cluster on
+// every Secret write, so changes apply without restarting the job.
+func drSecretOverrides(clusterID string) func(namespace, name string) (map[string][]byte, error) {
+	return func(namespace, name string) (map[string][]byte, error) {
+		return models.GetDRSecretOverrideValues(clusterID, namespace, name)
+	}
+}
+
+// recordDRSecretTransfer returns the audit function of the Secrets a job
+// writes to clusterID, or to the destination of a fan-out job the transfer
+// names.
+func recordDRSecretTransfer(clusterID string) func(DR.SecretTransfer) {
+	return func(transfer DR.SecretTransfer) {
+		record := models.DRSecretTransfer{
+			JobID:          transfer.JobID,
+			ClusterID:      clusterID,
+			Namespace:      transfer.Namespace,
+			Name:           transfer.Name,
+			SecretType:     transfer.Type,
+			Action:         transfer.Action,
+			OverriddenKeys: transfer.OverriddenKeys,
+			TransferredAt:  transfer.TransferredAt,
+		}
+		if transfer.DestinationID != "" {
+			record.ClusterID = transfer.DestinationID
+		}
+		if err := record.Save(); err != nil {
+			log.Printf("Failed to record DR secret transfer for job %s: %v", transfer.JobID, err)
+		}
+	}
+}
+
+// findCluster looks up the cluster named by the :id parameter. It writes the
+// error response itself and returns false when there is none.
+func findCluster(context *gin.Context) (string, bool) {
+	cluster, err := models.GetClusterByID(context.Param("id"))
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to get cluster: " + err.Error(),
+		})
+		return "", false
+	}
+	if cluster == nil {
+		context.JSON(404, gin.H{
+			"error": "Cluster not found",
+		})
+		return "", false
+	}
+	return context.Param("id"), true
+}
+
+// setDRSecretOverrides stores values that replace those of a Secret whenever
+// DR replicates it to the cluster.
+func setDRSecretOverrides(context *gin.Context) {
+	if !authorizeDRChange(context) {
+		return
+	}
+	clusterID, ok := findCluster(context)
+	if !ok {
+		return
+	}
+	var overrideReq DRSecretOverrideRequest
+	if err := context.ShouldBindJSON(&overrideReq); err != nil {
+		context.JSON(400, gin.H{
+			"error": "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	overrides := make([]*models.DRSecretOverride, 0, len(overrideReq.Values))
+	for key, value := range overrideReq.Values {
+		if key == "" {
+			context.JSON(400, gin.H{
+				"error": "Secret keys cannot be empty",
+			})
+			return
+		}
+		overrides = append(overrides, &models.DRSecretOverride{
+			ClusterID: clusterID,
+			Namespace: overrideReq.Namespace,
+			Name:      overrideReq.Name,
+			Key:       key,
+			Value:     value,
+			UserID:    context.GetInt64("userID"),
+		})
+	}
+	for _, override := range overrides {
+		if err := override.Save(); err != nil {
+			context.JSON(500, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	context.JSON(200, gin.H{
+		"message":   "DR secret overrides saved",
+		"overrides": overrides,
+	})
+}
+
+func getDRSecretOverrides(context *gin.Context) {
+	clusterID, ok := findCluster(context)
+	if !ok {
+		return
+	}
+	overrides, err := models.GetDRSecretOverrides(clusterID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":    "Successfully fetched DR secret overrides",
+		"cluster_id": clusterID,
+		"overrides":  overrides,
+	})
+}
+
+func deleteDRSecretOverride(context *gin.Context) {
+	if !authorizeDRChange(context) {
+		return
+	}
+	overrideID, err := strconv.ParseInt(context.Param("override_id"), 10, 64)
+	if err != nil {
+		context.JSON(400, gin.H{
+			"error": "Invalid override ID",
+		})
+		return
+	}
+	deleted, err := models.DeleteDRSecretOverride(context.Param("id"), overrideID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !deleted {
+		context.JSON(404, gin.H{
+			"error": "DR secret override not found",
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":     "DR secret override deleted",
+		"override_id": overrideID,
+	})
+}
+
+// getDRSecretTransfers lists which Secrets a DR job copied, sealed, skipped
+// or deleted, newest first.
+func getDRSecretTransfers(context *gin.Context) {
+	limit, err := strconv.Atoi(context.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		context.JSON(400, gin.H{
+			"error": "limit must be a positive number",
+		})
+		return
+	}
+	job := findDRJob(context)
+	if job == nil {
+		return
+	}
+	transfers, err := models.GetDRSecretTransfers(job.ID, limit)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to fetch DR secret transfers: " + err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":   "Successfully fetched DR secret transfers",
+		"job_id":    job.ID,
+		"transfers": transfers,
+	})
+}
@@ -0,0 +1,329 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"example.com/kuber/DR"
+	"example.com/kuber/db"
+	"example.com/kuber/models"
+	"github.com/gin-gonic/gin"
+)
+
+type SnapshotRequest struct {
+	ClusterID string `json:"cluster_id" binding:"required"`
+	// "local" (default) or "s3".
+	Store             string   `json:"store"`
+	IncludeNamespaces []string `json:"include_namespaces"`
+	ExcludeNamespaces []string `json:"exclude_namespaces"`
+	LabelSelector     string   `json:"label_selector"`
+	IncludeResources  []string `json:"include_resources"`
+	ExcludeResources  []string `json:"exclude_resources"`
+}
+
+type RestoreSnapshotRequest struct {
+	// ClusterID is the registered cluster to restore into.
+	ClusterID string `json:"cluster_id" binding:"required"`
+	// NamespaceMap renames namespaces from the snapshot, e.g. {"shop": "shop-restored"}.
+	NamespaceMap   map[string]string `json:"namespace_map"`
+	ConflictPolicy string            `json:"conflict_policy"`
+}
+
+// authorizeSnapshotChange writes the error response itself and reports false
+// when the user may not change snapshots or restore them.
+func authorizeSnapshotChange(context *gin.Context) bool {
+	authorized, err := isAuthorized(context.GetInt64("userID"))
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Cannot get roles and permissions: " + err.Error(),
+		})
+		return false
+	}
+	if !authorized {
+		context.JSON(401, gin.H{
+			"error": "No permission to manage snapshots",
+		})
+		return false
+	}
+	return true
+}
+
+func createSnapshot(context *gin.Context) {
+	if !authorizeSnapshotChange(context) {
+		return
+	}
+	var snapshotReq SnapshotRequest
+	if err := context.ShouldBindJSON(&snapshotReq); err != nil {
+		context.JSON(400, gin.H{
+			"error": "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	if snapshotReq.Store == "" {
+		snapshotReq.Store = DR.StoreLocal
+	}
+	options := DR.SnapshotOptions{
+		Scope: DR.Scope{
+			IncludeNamespaces: snapshotReq.IncludeNamespaces,
+			ExcludeNamespaces: snapshotReq.ExcludeNamespaces,
+			LabelSelector:     snapshotReq.LabelSelector,
+		},
+		Resources: DR.ResourceFilter{
+			Include: snapshotReq.IncludeResources,
+			Exclude: snapshotReq.ExcludeResources,
+		},
+	}
+	if err := options.Scope.Validate(); err != nil {
+		context.JSON(400, gin.H{
+			"error": "Invalid scope: " + err.Error(),
+		})
+		return
+	}
+	if err := options.Resources.Validate(); err != nil {
+		context.JSON(400, gin.H{
+			"error": "Invalid resource filter: " + err.Error(),
+		})
+		return
+	}
+	store, err := DR.NewSnapshotStore(snapshotReq.Store)
+	if err != nil {
+		context.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	client, k8sClient, ok := loadClusterClients(context, snapshotReq.ClusterID, "source")
+	if !ok {
+		return
+	}
+	clusterName, err := models.GetClusterNameByID(snapshotReq.ClusterID)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to get cluster name: " + err.Error(),
+		})
+		return
+	}
+
+	archive, err := os.CreateTemp("", "kuber-snapshot-*.tar.gz")
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to create snapshot file: " + err.Error(),
+		})
+		return
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	manifest, err := DR.TakeSnapshot(client, k8sClient, options, archive)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to take snapshot: " + err.Error(),
+		})
+		return
+	}
+	size, err := archive.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = archive.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to read snapshot file: " + err.Error(),
+		})
+		return
+	}
+	snapshotID, err := db.GetUUID()
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to generate snapshot ID: " + err.Error(),
+		})
+		return
+	}
+	key := fmt.Sprintf("%s/%s-%s.tar.gz", snapshotReq.ClusterID, manifest.CreatedAt.Format("20060102T150405Z"), snapshotID)
+	if err := store.Put(key, archive, size); err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to store snapshot: " + err.Error(),
+		})
+		return
+	}
+
+	optionsJSON, err := json.Marshal(manifest.Options)
+	if err != nil {
+		log.Printf("Failed to encode options of snapshot %s: %v", key, err)
+	}
+	snapshot := models.Snapshot{
+		ID:            snapshotID,
+		ClusterID:     snapshotReq.ClusterID,
+		ClusterName:   clusterName,
+		Store:         snapshotReq.Store,
+		ObjectKey:     key,
+		SizeBytes:     size,
+		FormatVersion: manifest.FormatVersion,
+		ObjectCounts:  manifest.ObjectCounts,
+		Options:       optionsJSON,
+		UserID:        context.GetInt64("userID"),
+		CreatedAt:     manifest.CreatedAt,
+	}
+	if err := snapshot.Save(); err != nil {
+		if deleteErr := store.Delete(key); deleteErr != nil {
+			log.Printf("Failed to remove unrecorded snapshot %s: %v", key, deleteErr)
+		}
+		context.JSON(500, gin.H{
+			"error": "Failed to record snapshot: " + err.Error(),
+		})
+		return
+	}
+	context.JSON(201, gin.H{
+		"message":  "Snapshot created",
+		"snapshot": snapshot,
+	})
+}
+
+func getSnapshots(context *gin.Context) {
+	snapshots, err := models.GetSnapshots(context.Query("cluster_id"))
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to fetch snapshots: " + err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":   "Successfully fetched snapshots",
+		"snapshots": snapshots,
+	})
+}
+
+// findSnapshot writes the error response itself and returns nil when the
+// snapshot of the :id parameter cannot be loaded.
+func findSnapshot(context *gin.Context) *models.Snapshot {
+	snapshot, err := models.GetSnapshotByID(context.Param("id"))
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to fetch snapshot: " + err.Error(),
+		})
+		return nil
+	}
+	if snapshot == nil {
+		context.JSON(404, gin.H{
+			"error": "Snapshot not found",
+		})
+		return nil
+	}
+	return snapshot
+}
+
+func getSnapshotByID(context *gin.Context) {
+	snapshot := findSnapshot(context)
+	if snapshot == nil {
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":  "Successfully fetched snapshot",
+		"snapshot": snapshot,
+	})
+}
+
+func deleteSnapshot(context *gin.Context) {
+	if !authorizeSnapshotChange(context) {
+		return
+	}
+	snapshot := findSnapshot(context)
+	if snapshot == nil {
+		return
+	}
+	store, err := DR.NewSnapshotStore(snapshot.Store)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := store.Delete(snapshot.ObjectKey); err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to delete snapshot archive: " + err.Error(),
+		})
+		return
+	}
+	if err := models.DeleteSnapshot(snapshot.ID); err != nil {
+		context.JSON(500, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	context.JSON(200, gin.H{
+		"message":     "Snapshot deleted",
+		"snapshot_id": snapshot.ID,
+	})
+}
+
+func restoreSnapshot(context *gin.Context) {
+	if !authorizeSnapshotChange(context) {
+		return
+	}
+	var restoreReq RestoreSnapshotRequest
+	if err := context.ShouldBindJSON(&restoreReq); err != nil {
+		context.JSON(400, gin.H{
+			"error": "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	if err := DR.ValidateConflictPolicy(restoreReq.ConflictPolicy); err != nil {
+		context.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	snapshot := findSnapshot(context)
+	if snapshot == nil {
+		return
+	}
+	store, err := DR.NewSnapshotStore(snapshot.Store)
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	client, _, ok := loadClusterClients(context, restoreReq.ClusterID, "target")
+	if !ok {
+		return
+	}
+	archive, err := store.Get(snapshot.ObjectKey)
+	if errors.Is(err, DR.ErrSnapshotNotFound) {
+		context.JSON(410, gin.H{
+			"error": "Snapshot archive no longer exists in the " + snapshot.Store + " store",
+		})
+		return
+	}
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to read snapshot archive: " + err.Error(),
+		})
+		return
+	}
+	defer archive.Close()
+
+	report, err := DR.RestoreSnapshot(archive, client, DR.RestoreOptions{
+		NamespaceMap:   restoreReq.NamespaceMap,
+		ConflictPolicy: restoreReq.ConflictPolicy,
+	})
+	if err != nil {
+		context.JSON(500, gin.H{
+			"error": "Failed to restore snapshot: " + err.Error(),
+		})
+		return
+	}
+	message := "Snapshot restored"
+	if len(report.Errors) > 0 {
+		message = "Snapshot restored with errors"
+	}
+	context.JSON(200, gin.H{
+		"message":     message,
+		"snapshot_id": snapshot.ID,
+		"cluster_id":  restoreReq.ClusterID,
+		"report":      report,
+	})
+}